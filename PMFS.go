@@ -5,14 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime"
 	"net/http"
 
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pelletier/go-toml/v2"
@@ -31,22 +34,17 @@ const (
 	productsDir   = "products"
 	indexFilename = "index.toml"
 	projectTOML   = "project.toml"
+	baselinesDir  = "baselines"
 	envBaseDir    = "PMFS_BASEDIR"
 )
 
 var (
-	baseDir         = defaultBaseDir()
-	baseProductsDir string
-	indexPath       string
-
 	ErrProductNotFound = errors.New("product not found")
 	ErrProjectNotFound = errors.New("project not found")
+	// ErrAttachmentNotFound is returned when no attachment has the given ID.
+	ErrAttachmentNotFound = errors.New("attachment not found")
 )
 
-func init() {
-	setBaseDir(baseDir)
-}
-
 func defaultBaseDir() string {
 	if dir := os.Getenv(envBaseDir); dir != "" {
 		return dir
@@ -54,74 +52,164 @@ func defaultBaseDir() string {
 	return "database"
 }
 
-// SetBaseDir overrides the base data directory and updates internal paths.
+// SetBaseDir replaces the package default DB with an empty database backed
+// by the filesystem at dir. Nothing is read from disk; use LoadSetup to load
+// an existing database.
+//
+// Deprecated: open a Database with LoadSetup or Open and work with its
+// products and projects, which carry their own storage.
 func SetBaseDir(dir string) {
-	baseDir = dir
-	setBaseDir(dir)
-}
-
-func setBaseDir(dir string) {
-	baseProductsDir = filepath.Join(dir, productsDir)
-	indexPath = filepath.Join(baseProductsDir, indexFilename)
+	DB = newDatabase(NewFSStore(dir))
+	DB.BaseDir = dir
 }
 
 // Database holds the products and the base directory from which it was loaded.
-// The BaseDir field is not persisted to disk.
+// The BaseDir field is not persisted to disk. Each Database carries its own
+// store and LLM client, so several databases can be open side by side.
 type Database struct {
 	BaseDir  string        `toml:"-"`
 	Products []ProductType `toml:"products"`
 	LLM      llm.Client    `toml:"-" json:"-"`
+	// NextProductID is the ID the next new product receives. It is kept in
+	// index.toml so IDs of deleted products are never handed out again.
+	NextProductID int `toml:"-"`
+	// User is recorded in the change history of requirements changed through
+	// this database. When empty, ActorSystem is recorded.
+	User string `toml:"-" json:"-"`
+
+	store    Store
+	migrated []MigrationStep // index migrations applied in memory by the last load
+
+	mu           sync.RWMutex // see Lock and RLock
+	locksMu      sync.Mutex
+	projectLocks map[[2]int]*sync.RWMutex
 }
 
-// DB is the package-wide database instance used by helper functions.
+// DB is the most recently opened database. It only serves package-level
+// helpers without a project (such as Deduplicate) and projects or products
+// constructed by hand instead of being loaded from a Database.
 var DB *Database
 
+// defaultDB returns DB, pointing it at PMFS_BASEDIR (or "database") when no
+// database has been opened yet.
+func defaultDB() *Database {
+	if DB == nil {
+		SetBaseDir(defaultBaseDir())
+	}
+	return DB
+}
+
+// newDatabase returns an empty database using s and the default LLM client.
+func newDatabase(s Store) *Database {
+	return &Database{Products: []ProductType{}, LLM: llm.DefaultClient, store: s}
+}
+
+// bind points every product and project at db so they persist through its
+// store and use its LLM client.
+func (db *Database) bind() {
+	for i := range db.Products {
+		prd := &db.Products[i]
+		prd.db = db
+		for j := range prd.Projects {
+			prd.Projects[j].ProductID = prd.ID
+			prd.Projects[j].db = db
+		}
+	}
+}
+
+// client returns the database's LLM client, falling back to the default.
+func (db *Database) client() llm.Client {
+	if db.LLM != nil {
+		return db.LLM
+	}
+	return llm.DefaultClient
+}
+
 // DesignAspectGateGroup lists gate IDs evaluated for design aspect templates.
 var DesignAspectGateGroup = []string{
 	"clarity-form-1",
 	"duplicate-1",
 }
 
-// LoadSetup initialises the database at the provided path. It sets the
-// PMFS_BASEDIR environment variable, prepares the on-disk layout and loads the
-// index into memory.
+// LoadSetup initialises the filesystem database at the provided path,
+// preparing the on-disk layout and loading the index into memory.
 func LoadSetup(path string) (*Database, error) {
-	// Export base directory for any helpers relying on the environment
-	// variable and update internal path bookkeeping.
-	if err := os.Setenv(envBaseDir, path); err != nil {
+	db, err := Open(NewFSStore(path))
+	if err != nil {
 		return nil, err
 	}
-	SetBaseDir(path)
+	db.BaseDir = path
+	return db, nil
+}
 
-	if err := ensureLayout(); err != nil {
-		return nil, err
+// Open loads the database kept in s, writing an empty index first when the
+// store is new. Databases written with an older SchemaVersion are migrated
+// (see Migrate). The returned database uses the default LLM client and also
+// becomes the package default DB.
+func Open(s Store) (*Database, error) {
+	db := newDatabase(s)
+	if err := s.LoadIndex(db); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read index.toml: %w", err)
+		}
+		db = newDatabase(s)
+		if err := s.SaveIndex(db); err != nil {
+			return nil, fmt.Errorf("write index.toml: %w", err)
+		}
 	}
-	db, err := loadDatabase()
-	if err != nil {
-		return nil, err
+	if len(db.migrated) > 0 {
+		// The schema changed since the database was written: upgrade every
+		// document on disk, with a backup, before handing it out.
+		if _, err := Migrate(s); err != nil {
+			return nil, fmt.Errorf("migrate schema: %w", err)
+		}
+		db.migrated = nil
 	}
-	db.BaseDir = path
-	db.LLM = llm.DefaultClient
+	if ls, ok := s.(*FSStore); ok {
+		db.BaseDir = ls.BaseDir()
+	}
+	db.bind()
 	DB = db
-
 	return db, nil
 }
 
-// Save persists the in-memory database back to disk.
+// Store returns the storage backend of the database.
+func (db *Database) Store() Store {
+	return db.store
+}
+
+// Save persists the in-memory database back to disk. Products and projects
+// other processes added or deleted in the meantime are merged in; see
+// editIndex.
 func (db *Database) Save() error {
-	return writeTOML(indexPath, db)
+	return db.editIndex(func() error { return nil })
 }
 
 // -----------------------------------------------------------------------------
 // Memory model
 // -----------------------------------------------------------------------------
 
-// ProductType represents a product within the database. Next IDs are derived
-// from len(db.Products)+1.
+// ProductType represents a product within the database. New product and
+// project IDs come from Database.NextProductID and NextProjectID, which never
+// hand out an ID twice.
 type ProductType struct {
 	ID       int           `toml:"id"`
 	Name     string        `toml:"name"`
+	Archived bool          `toml:"archived"`
 	Projects []ProjectType `toml:"projects"`
+	// NextProjectID is the ID the next new project receives. IDs of
+	// deleted projects are never handed out again.
+	NextProjectID int `toml:"next_project_id"`
+
+	db *Database
+}
+
+// database returns the database the product belongs to.
+func (prd *ProductType) database() *Database {
+	if prd.db != nil {
+		return prd.db
+	}
+	return defaultDB()
 }
 
 // ProjectType is the project's memory model placeholder.
@@ -129,10 +217,18 @@ type ProjectType struct {
 	ID        int    `json:"id" toml:"id"`
 	ProductID int    `json:"productid" toml:"productid"`
 	Name      string `json:"name" toml:"name"`
+	Archived  bool   `json:"archived" toml:"archived"`
 	// D contains the heavy project data and is stored only in each
 	// project's individual TOML file. The field is skipped when the
 	// index is written to disk so the index remains lightweight.
 	D ProjectData `json:"projectdata" toml:"-"`
+	// Revision is incremented by every save and persisted in project.toml.
+	// It holds the revision read by the last Load or written by the last
+	// Save and is used for optimistic concurrency (see SaveIfRevision).
+	Revision int `json:"revision" toml:"-"`
+
+	db       *Database
+	migrated []MigrationStep // migrations applied in memory by the last Load
 }
 
 type ProjectData struct {
@@ -146,15 +242,63 @@ type ProjectData struct {
 	Attachments  []Attachment  `json:"attachments" toml:"attachments"`
 	// Intelligence holds data extracted from attachments (e.g., screenshots, documents).
 	Intelligence []Intelligence `json:"intelligence" toml:"intelligence"`
-	// IntelligenceLinks connect extracted intelligence with confirmed requirements.
-	//	IntelligenceLinks []IntelligenceLink `json:"intelligence_links" toml:"intelligence_links"`
-	// RequirementRelations holds the LLM-scored relationships between requirements.
-	//	RequirementRelations  []RequirementRelation `json:"requirement_relations" toml:"requirement_relations"`
-	//	RequirementCategories []string              `json:"requirement_Categories" toml:"requirement_Categories"`
+	// IntelligenceLinks trace requirements back to the intelligence and
+	// attachments they were produced from.
+	IntelligenceLinks []IntelligenceLink `json:"intelligence_links" toml:"intelligence_links"`
+	// RequirementRelations holds the typed, optionally LLM-scored edges
+	// between requirements; see AddRelation.
+	RequirementRelations []RequirementRelation `json:"requirement_relations" toml:"requirement_relations"`
+	// RequirementCategories is the project's category catalog; see AddCategory.
+	RequirementCategories []Category `json:"requirement_Categories" toml:"requirement_Categories"`
+	// FixedCategories restricts requirement categories to the catalog when
+	// adding, importing or editing requirements.
 	FixedCategories bool `json:"requirement_FixedCategories" toml:"requirement_FixedCategories"`
+	// KeyPrefix starts the keys of requirements created in this project.
+	// It defaults to "PRD<product>-PRJ<project>". NewProject and
+	// ModifyProject reject prefixes, including the default, that another
+	// project of the database uses or still holds keys of with
+	// ErrDuplicateKeyPrefix.
+	KeyPrefix string `json:"key_prefix,omitempty" toml:"key_prefix"`
+	// NextKeySeq is the sequence number of the next requirement key.
+	NextKeySeq int `json:"next_key_seq" toml:"next_key_seq"`
+	// NextRequirementID is the ID of the next requirement added. IDs of
+	// removed requirements are never handed out again.
+	NextRequirementID int `json:"next_requirement_id" toml:"next_requirement_id"`
+	// AttributeSchema defines the custom attributes requirements may carry.
+	AttributeSchema []AttributeDef `json:"attribute_schema" toml:"attribute_schema"`
+	// Workflow is the requirement state machine; nil uses DefaultWorkflow.
+	Workflow *Workflow `json:"workflow,omitempty" toml:"workflow,omitempty"`
+	// Comments holds the review threads on the project's requirements; see
+	// AddComment.
+	Comments []Comment `json:"comments" toml:"comments"`
+	// NextCommentID is the ID of the next comment added. IDs of removed
+	// comments are never handed out again.
+	NextCommentID int `json:"next_comment_id" toml:"next_comment_id"`
+	// ApprovalPolicy lists the sign-offs requirements need before the
+	// "approved" workflow guard lets them become active.
+	ApprovalPolicy []ApprovalRule `json:"approval_policy" toml:"approval_policy"`
+	// Glossary defines the project's terms and acronyms. It is included in
+	// the prompts of the glossary gates run through the project.
+	Glossary []GlossaryEntry `json:"glossary" toml:"glossary"`
+	// Risks is the project's risk register; see AddRisk.
+	Risks []Risk `json:"risks" toml:"risks"`
+	// NextRiskID is the ID of the next risk added. IDs of removed risks are
+	// never handed out again.
+	NextRiskID int `json:"next_risk_id" toml:"next_risk_id"`
+	// Releases are the planned deliveries requirements are assigned to.
+	Releases []Release `json:"releases" toml:"releases"`
+	// NextReleaseID is the ID of the next release added. IDs of removed
+	// releases are never handed out again.
+	NextReleaseID int `json:"next_release_id" toml:"next_release_id"`
+	// TestCases verify the project's requirements; see Coverage.
+	TestCases []TestCase `json:"test_cases" toml:"test_cases"`
+	// NextTestCaseID is the ID of the next test case added. IDs of removed
+	// test cases are never handed out again.
+	NextTestCaseID int `json:"next_test_case_id" toml:"next_test_case_id"`
 }
 
-// ConditionType represents the state of a requirement.
+// ConditionType represents the state of a requirement. Proposed, Active and
+// Deleted follow the requirement's workflow state.
 type ConditionType struct {
 	Proposed    bool            `json:"proposed" toml:"proposed"`
 	AIgenerated bool            `json:"aigenerated" toml:"aigenerated"`
@@ -166,26 +310,42 @@ type ConditionType struct {
 
 // Requirement represents a confirmed requirement with detailed metadata.
 type Requirement struct {
-	ID                 int             `json:"id" toml:"id"`
-	Name               string          `json:"name" toml:"name"`
-	Description        string          `json:"description" toml:"description"`
-	Priority           int             `json:"priority" toml:"priority"` // 1 (highest) to 8 (lowest)
-	Level              int             `json:"level" toml:"level"`       // Hierarchical level within requirements.
-	User               string          `json:"user" toml:"user"`
-	Status             string          `json:"status" toml:"status"` // e.g., "Draft", "Confirmed"
-	CreatedAt          time.Time       `json:"created_at" toml:"created_at"`
-	UpdatedAt          time.Time       `json:"updated_at" toml:"updated_at"`
-	ParentID           int             `json:"parent_id" toml:"parent_id"` // index of originating requirement
-	AttachmentIndex    int             `json:"attachment_index" toml:"attachment_index"`
-	Category           string          `json:"category" toml:"category"` // e.g., "System Requirements"
-	History            []ChangeLog     `json:"history" toml:"history"`   // Record of changes to the requirement.
-	IntelligenceLink   []*Intelligence `json:"intelligence_links" toml:"intelligence_links"`
-	GateResults        []gates.Result  `json:"gate_results,omitempty" toml:"gate_results"`
-	RecommendedChanges []DesignAspect  `json:"RequirementImprovements" toml:"requirementdesignaspects"`
-	DesignAspects      []DesignAspect  `json:"design_aspects" toml:"design_aspects"`
-	Condition          ConditionType   `json:"condition" toml:"condition"`
+	ID                 int            `json:"id" toml:"id"`   // unique within the project
+	Key                string         `json:"key" toml:"key"` // unique in the database, e.g. "PRD1-PRJ2-REQ-0017"; kept across moves
+	Name               string         `json:"name" toml:"name"`
+	Description        string         `json:"description" toml:"description"`
+	Priority           int            `json:"priority" toml:"priority"` // 1 (highest) to 8 (lowest)
+	Level              int            `json:"level" toml:"level"`       // derived from ParentID on save; 1 for top-level requirements
+	User               string         `json:"user" toml:"user"`
+	Status             string         `json:"status" toml:"status"` // workflow state, e.g. "Draft"; see Transition
+	CreatedAt          time.Time      `json:"created_at" toml:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at" toml:"updated_at"`
+	ParentID           int            `json:"parent_id" toml:"parent_id"` // ID of the parent requirement; 0 at the top level
+	AttachmentIndex    int            `json:"attachment_index" toml:"attachment_index"`
+	Category           string         `json:"category" toml:"category"` // e.g., "System Requirements"
+	History            []ChangeLog    `json:"history" toml:"history"`   // Record of changes to the requirement.
+	GateResults        []gates.Result `json:"gate_results,omitempty" toml:"gate_results"`
+	RecommendedChanges []DesignAspect `json:"recommended_changes" toml:"recommended_changes"`
+	DesignAspects      []DesignAspect `json:"design_aspects" toml:"design_aspects"`
+	Condition          ConditionType  `json:"condition" toml:"condition"`
 	// Optional: Tags can help with flexible categorization or filtering.
 	Tags []string `json:"tags,omitempty" toml:"tags"`
+	// Attributes holds values of the project's custom attributes by name,
+	// in the normalized form described by AttributeDef.Normalize.
+	Attributes map[string]string `json:"attributes,omitempty" toml:"attributes"`
+	// AcceptanceCriteria lists the conditions testers verify the requirement by.
+	AcceptanceCriteria []AcceptanceCriterion `json:"acceptance_criteria,omitempty" toml:"acceptance_criteria"`
+	// Approvals holds the sign-offs given under the project's approval
+	// policy; see Approve.
+	Approvals []SignOff `json:"approvals,omitempty" toml:"approvals"`
+	// ReleaseID is the release the requirement is planned in; 0 when
+	// unplanned. See AssignRelease.
+	ReleaseID int `json:"release_id,omitempty" toml:"release_id"`
+	// Factors holds the inputs of the scoring models by factor name, e.g.
+	// "value" or "effort"; see RankedBacklog.
+	Factors map[string]float64 `json:"factors,omitempty" toml:"factors"`
+	// FactorJustification explains the factor values.
+	FactorJustification string `json:"factor_justification,omitempty" toml:"factor_justification"`
 }
 
 // A DesignAspect is a take on the requirement, as a way to improve this,  as with the following example:
@@ -221,15 +381,30 @@ func FromGemini(req gemini.Requirement) Requirement {
 }
 
 // Analyze sends the requirement description to the provided role/question pair
-// using the database's configured LLM and returns the result.
+// using the default database's LLM and returns the result. Use
+// ProjectType.AnalyzeRequirement to go through the project's database.
 func (r *Requirement) Analyze(role, questionID string) (bool, string, error) {
-	return interact.RunQuestion(DB.LLM, role, questionID, r.Description)
+	return r.analyze(defaultDB().client(), role, questionID)
+}
+
+func (r *Requirement) analyze(c llm.Client, role, questionID string) (bool, string, error) {
+	return interact.RunQuestion(c, role, questionID, r.Description)
 }
 
 // EvaluateGates runs the specified gates against the requirement description
-// using the database's configured LLM and stores the results on the requirement.
+// using the default database's LLM and stores the results on the requirement.
+// Changed results are recorded in the history as made by ActorAI.
 func (r *Requirement) EvaluateGates(gateIDs []string) error {
-	res, err := gates.Evaluate(DB.LLM, gateIDs, r.Description)
+	c := defaultDB().client()
+	return r.track(ActorAI, "gate evaluation", func() error {
+		return r.evaluateGates(c, gateIDs, nil)
+	})
+}
+
+// evaluateGates runs the gates with the project data in ctx, which may be
+// nil.
+func (r *Requirement) evaluateGates(c llm.Client, gateIDs []string, ctx gates.Context) error {
+	res, err := gates.EvaluateWithContext(c, gateIDs, r.Description, ctx)
 
 	if err != nil {
 		return err
@@ -247,22 +422,30 @@ func (r *Requirement) EvaluateGates(gateIDs []string) error {
 // QualityControlAI runs Analyze and EvaluateGates on the requirement.
 // It returns the result of Analyze and stores gate evaluation results on the requirement.
 func (r *Requirement) QualityControlAI(role, questionID string, gateIDs []string) (bool, string, error) {
-	pass, ans, err := r.Analyze(role, questionID)
+	return r.qualityControl(defaultDB().client(), role, questionID, gateIDs, nil)
+}
+
+func (r *Requirement) qualityControl(c llm.Client, role, questionID string, gateIDs []string, ctx gates.Context) (bool, string, error) {
+	pass, ans, err := r.analyze(c, role, questionID)
 	if err != nil {
 		return pass, ans, err
 	}
-	if err := r.EvaluateGates(gateIDs); err != nil {
-		return pass, ans, err
-	}
-	r.Condition.AIanalyzed = true
-	return pass, ans, nil
+	err = r.track(ActorAI, "quality control", func() error {
+		if err := r.evaluateGates(c, gateIDs, ctx); err != nil {
+			return err
+		}
+		r.Condition.AIanalyzed = true
+		return nil
+	})
+	return pass, ans, err
 }
 
 // EvaluateDesignGates runs the specified gates against each template requirement
-// in the design aspect using the database's configured LLM.
+// in the design aspect using the default database's LLM.
 func (da *DesignAspect) EvaluateDesignGates(gateIDs []string) error {
+	c := defaultDB().client()
 	for i := range da.Templates {
-		if err := da.Templates[i].EvaluateGates(gateIDs); err != nil {
+		if err := da.Templates[i].evaluateGates(c, gateIDs, nil); err != nil {
 			return err
 		}
 	}
@@ -274,13 +457,36 @@ func (da *DesignAspect) EvaluateDesignGates(gateIDs []string) error {
 // comparison of names and descriptions is used. Requirements marked as deleted are
 // skipped entirely. If ignoreProposed is true, requirements marked as proposed are
 // also skipped during duplicate comparison (but are still returned).
+// Merges are recorded in the surviving requirement's history.
+// The default database's LLM is used. References to merged and skipped
+// requirements are left alone; ProjectType.Deduplicate also removes them.
 func Deduplicate(reqs []Requirement, ignoreProposed bool) []Requirement {
+	var c llm.Client
+	if DB != nil {
+		c = DB.LLM
+	}
+	out, _ := deduplicate(c, reqs, ignoreProposed)
+	return out
+}
+
+// deduplicate implements Deduplicate with an explicit client. A nil client
+// selects the case-insensitive comparison. The second result maps each input
+// to the index of the output requirement it ended up in, or -1 when it was
+// dropped as deleted.
+func deduplicate(c llm.Client, reqs []Requirement, ignoreProposed bool) ([]Requirement, []int) {
+	actor := ActorAI
+	if c == nil {
+		actor = ActorSystem
+	}
 	var out []Requirement
-	for _, r := range reqs {
+	into := make([]int, len(reqs))
+	for j, r := range reqs {
+		into[j] = -1
 		if r.Condition.Deleted {
 			continue
 		}
 		if ignoreProposed && r.Condition.Proposed {
+			into[j] = len(out)
 			out = append(out, r)
 			continue
 		}
@@ -290,9 +496,9 @@ func Deduplicate(reqs []Requirement, ignoreProposed bool) []Requirement {
 				continue
 			}
 			same := false
-			if DB != nil && DB.LLM != nil {
+			if c != nil {
 				prompt := fmt.Sprintf("Are the following two requirements essentially the same? Respond with 'yes' or 'no'.\n1. %s\n2. %s", out[i].Description, r.Description)
-				if resp, err := DB.LLM.Ask(prompt); err == nil {
+				if resp, err := c.Ask(prompt); err == nil {
 					resp = strings.ToLower(strings.TrimSpace(resp))
 					if strings.HasPrefix(resp, "yes") {
 						same = true
@@ -302,21 +508,53 @@ func Deduplicate(reqs []Requirement, ignoreProposed bool) []Requirement {
 				same = strings.EqualFold(out[i].Description, r.Description) || strings.EqualFold(out[i].Name, r.Name)
 			}
 			if same {
+				before := out[i].snapshot()
 				if out[i].Description == "" && r.Description != "" {
 					out[i].Description = r.Description
 				}
 				if out[i].Name == "" && r.Name != "" {
 					out[i].Name = r.Name
 				}
+				out[i].recordSince(before, actor, "merged duplicate "+r.Name)
+				into[j] = i
 				merged = true
 				break
 			}
 		}
 		if !merged {
+			into[j] = len(out)
 			out = append(out, r)
 		}
 	}
-	return out
+	return out, into
+}
+
+// Deduplicate merges the project's near-identical requirements like the
+// package-level Deduplicate, using the project's LLM client. Merged and
+// deleted requirements leave the project with their relations, links and
+// comments; their children move up to their parent. IDs are assigned to requirements
+// missing one. The project is not saved.
+func (prj *ProjectType) Deduplicate(ignoreProposed bool) {
+	prj.deduplicate(prj.llm(), ignoreProposed)
+}
+
+// deduplicate implements Deduplicate with an explicit client and returns,
+// for each requirement, the index of the requirement it ended up in or -1.
+func (prj *ProjectType) deduplicate(c llm.Client, ignoreProposed bool) []int {
+	reqs := prj.D.Requirements
+	out, into := deduplicate(c, reqs, ignoreProposed)
+	prj.D.Requirements = out
+	for j, r := range reqs {
+		switch {
+		case r.ID == 0:
+		case into[j] < 0:
+			prj.forgetRequirement(r.ID, r.ParentID, fmt.Sprintf("parent %d removed", r.ID))
+		case out[into[j]].ID != r.ID:
+			prj.forgetRequirement(r.ID, r.ParentID, fmt.Sprintf("parent %d merged into %d", r.ID, out[into[j]].ID))
+		}
+	}
+	prj.ensureRequirementIDs()
+	return into
 }
 
 // parseLLMJSON extracts the first valid JSON array from the LLM response.
@@ -393,9 +631,20 @@ func (att *Attachment) GenerateRequirements(prj *ProjectType, strategy string) e
 		strategy = "gemini"
 	}
 
-	full := filepath.Join(projectDir(prj.ProductID, prj.ID), att.RelPath)
-
-	reqs, err := DB.LLM.AnalyzeAttachment(full)
+	c := prj.llm()
+	var (
+		reqs    []gemini.Requirement
+		content string
+	)
+	err := withAttachmentFile(prj.store(), prj, att.RelPath, func(full string) error {
+		var err error
+		reqs, err = c.AnalyzeAttachment(full)
+		if err != nil {
+			return err
+		}
+		content, err = attachmentText(full, reqs)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -414,51 +663,40 @@ func (att *Attachment) GenerateRequirements(prj *ProjectType, strategy string) e
 		nr.Condition.AIgenerated = true
 		newReqs = append(newReqs, nr)
 	}
-	prj.D.Requirements = Deduplicate(append(prj.D.Requirements, newReqs...), false)
-	prj.ensureRequirementIDs()
+	base := len(prj.D.Requirements)
+	prj.D.Requirements = append(prj.D.Requirements, newReqs...)
+	into := prj.deduplicate(c, false)
 	att.Analyzed = true
 
 	// Summarize attachment content into an Intelligence entry.
-	mt := mime.TypeByExtension(strings.ToLower(filepath.Ext(full)))
-	if i := strings.Index(mt, ";"); i >= 0 {
-		mt = mt[:i]
-	}
-	var content string
-	if strings.HasPrefix(mt, "text/") {
-		b, err := os.ReadFile(full)
-		if err != nil {
-			return err
-		}
-		content = string(b)
-	} else {
-		var sb strings.Builder
-		for _, r := range reqs {
-			sb.WriteString(r.Name)
-			sb.WriteString(": ")
-			sb.WriteString(r.Description)
-			sb.WriteString("\n")
-		}
-		content = sb.String()
-	}
-	summary, err := summarizeContent(content)
+	summary, err := summarizeContent(c, content)
 	if err != nil {
 		return err
 	}
 	intel := Intelligence{
-		ID:          len(prj.D.Intelligence) + 1,
-		Filepath:    att.RelPath,
-		Content:     content,
-		Description: summary,
-		ExtractedAt: time.Now(),
+		ID:           prj.nextIntelligenceID(),
+		AttachmentID: att.ID,
+		Filepath:     att.RelPath,
+		Content:      content,
+		Description:  summary,
+		ExtractedAt:  time.Now(),
 	}
 
-	aspects, err := designAspectsFromSummary(summary)
+	aspects, err := designAspectsFromSummary(c, summary)
 	if err != nil {
 		return err
 	}
 	intel.DesignAngles = append(intel.DesignAngles, aspects...)
 	prj.D.Intelligence = append(prj.D.Intelligence, intel)
 
+	// Trace every produced requirement, including existing ones a new
+	// requirement was merged into, back to the intelligence.
+	for _, i := range into[base:] {
+		if i >= 0 {
+			prj.addIntelligenceLink(IntelligenceLink{IntelligenceID: intel.ID, AttachmentID: att.ID, RequirementID: prj.D.Requirements[i].ID})
+		}
+	}
+
 	// Persist newly added potential requirements and intelligence immediately.
 	if err := prj.Save(); err != nil {
 		return err
@@ -471,46 +709,80 @@ func (att *Attachment) GenerateRequirements(prj *ProjectType, strategy string) e
 // logic is used to extract textual content before querying the LLM.
 
 func (att *Attachment) AnalyzeWithRole(role, questionID string, prj *ProjectType) (bool, string, error) {
+	c := prj.llm()
+	var content string
+	err := withAttachmentFile(prj.store(), prj, att.RelPath, func(full string) error {
+		if isTextFile(full) {
+			b, err := os.ReadFile(full)
+			if err != nil {
+				return err
+			}
+			content = string(b)
+			return nil
+		}
+		reqs, err := c.AnalyzeAttachment(full)
+		if err != nil {
+			return err
+		}
+		content = requirementsText(reqs)
+		return nil
+	})
+	if err != nil {
+		return false, "", err
+	}
+	return interact.RunQuestion(c, role, questionID, content)
+}
 
-	full := filepath.Join(projectDir(prj.ProductID, prj.ID), att.RelPath)
-	mt := mime.TypeByExtension(strings.ToLower(filepath.Ext(full)))
+// isTextFile reports whether the file extension maps to a text/* mimetype.
+func isTextFile(path string) bool {
+	mt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
 	if i := strings.Index(mt, ";"); i >= 0 {
 		mt = mt[:i]
 	}
-	var content string
-	if strings.HasPrefix(mt, "text/") {
-		b, err := os.ReadFile(full)
-		if err != nil {
-			return false, "", err
-		}
-		content = string(b)
-	} else {
-		reqs, err := DB.LLM.AnalyzeAttachment(full)
+	return strings.HasPrefix(mt, "text/")
+}
+
+// attachmentText returns the raw content of text files, or a listing of the
+// extracted requirements for other file types.
+func attachmentText(path string, reqs []gemini.Requirement) (string, error) {
+	if isTextFile(path) {
+		b, err := os.ReadFile(path)
 		if err != nil {
-			return false, "", err
-		}
-		var sb strings.Builder
-		for _, r := range reqs {
-			sb.WriteString(r.Name)
-			sb.WriteString(": ")
-			sb.WriteString(r.Description)
-			sb.WriteString("\n")
+			return "", err
 		}
-		content = sb.String()
+		return string(b), nil
 	}
-	return interact.RunQuestion(DB.LLM, role, questionID, content)
+	return requirementsText(reqs), nil
 }
 
-// ChangeLog records a change made to a requirement.
+// requirementsText renders requirements as "name: description" lines.
+func requirementsText(reqs []gemini.Requirement) string {
+	var sb strings.Builder
+	for _, r := range reqs {
+		sb.WriteString(r.Name)
+		sb.WriteString(": ")
+		sb.WriteString(r.Description)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ChangeLog records a change made to a requirement. Entries are appended
+// automatically by the package's mutators; see Requirement.Timeline.
 type ChangeLog struct {
 	Timestamp time.Time `json:"timestamp" toml:"timestamp"`
 	User      string    `json:"user" toml:"user"`
 	Comment   string    `json:"comment" toml:"comment"`
+	// Fields lists the fields changed, with their values before and after.
+	Fields []FieldChange `json:"fields,omitempty" toml:"fields"`
 }
 
 // Intelligence represents data extracted from an attachment.
 type Intelligence struct {
 	ID int `json:"id" toml:"id"`
+	// AttachmentID is the attachment the intelligence was extracted from, or
+	// 0 when unknown.
+	AttachmentID int `json:"attachment_id" toml:"attachment_id"`
 	// Source describes the type of attachment (e.g., "screenshot", "document").
 	Filepath string `json:"Filepath" toml:"Filepath"`
 	// Content contains the extracted text or metadata.
@@ -521,47 +793,6 @@ type Intelligence struct {
 	DesignAngles []DesignAspect `json:"DesignAngles_DesignAspects" toml:"DesignAngles_DesignAspects"`
 }
 
-// -----------------------------------------------------------------------------
-// Init helpers
-// -----------------------------------------------------------------------------
-//
-// ensureLayout creates base folder structure and ensures index.toml exists.
-func ensureLayout() error {
-	if err := os.MkdirAll(baseProductsDir, 0o755); err != nil {
-		return fmt.Errorf("mkdir %s: %w", baseProductsDir, err)
-	}
-	// Create empty index if missing.
-	if ok, err := fileExists(indexPath); err != nil {
-		return err
-	} else if !ok {
-		db := Database{Products: []ProductType{}}
-		if err := writeTOML(indexPath, &db); err != nil {
-			return fmt.Errorf("write index.toml: %w", err)
-		}
-	}
-	return nil
-}
-
-// loadDatabase reads index.toml into the database model.
-func loadDatabase() (*Database, error) {
-	var db Database
-	if err := readTOML(indexPath, &db); err != nil {
-		if os.IsNotExist(err) {
-			// Create a fresh one if missing (keeps flow simple)
-			db = Database{Products: []ProductType{}}
-			if werr := writeTOML(indexPath, &db); werr != nil {
-				return nil, werr
-			}
-			return &db, nil
-		}
-		return nil, fmt.Errorf("read index.toml: %w", err)
-	}
-	if db.Products == nil {
-		db.Products = []ProductType{}
-	}
-	return &db, nil
-}
-
 // -----------------------------------------------------------------------------
 // Public ops
 // -----------------------------------------------------------------------------
@@ -578,15 +809,16 @@ func (db *Database) NewProduct(data ProductData) (int, error) {
 		return 0, errors.New("product name cannot be empty")
 	}
 
-	newID := len(db.Products) + 1
-	pDir := productDir(newID)
-	if err := os.MkdirAll(filepath.Join(pDir, "projects"), 0o755); err != nil {
-
-		return 0, fmt.Errorf("mkdir product/projects: %w", err)
-	}
-	prd := ProductType{ID: newID, Name: data.Name, Projects: []ProjectType{}}
-	db.Products = append(db.Products, prd)
-	if err := db.Save(); err != nil {
+	var newID int
+	err := db.editIndex(func() error {
+		newID = db.allocProductID()
+		if err := db.Store().InitProduct(newID); err != nil {
+			return err
+		}
+		db.Products = append(db.Products, ProductType{ID: newID, Name: data.Name, Projects: []ProjectType{}, db: db})
+		return nil
+	})
+	if err != nil {
 		return 0, err
 	}
 	return newID, nil
@@ -609,34 +841,44 @@ func (db *Database) ModifyProduct(data ProductData) (int, error) {
 }
 
 // NewProject appends a project to the product, persists it to project.toml and
-// updates the database index. The new project ID is len(product.Projects)+1.
+// updates the database index. The new project ID comes from the product's
+// NextProjectID counter.
 func (prd *ProductType) NewProject(data ProjectData) (int, error) {
 	// basic validation
 	if strings.TrimSpace(data.Name) == "" {
 		return 0, errors.New("project name cannot be empty")
 	}
 
-	newPrjID := len(prd.Projects) + 1
-	prjDir := projectDir(prd.ID, newPrjID)
-
-	// ensure directory exists
-	if err := os.MkdirAll(prjDir, 0o755); err != nil {
-		return 0, fmt.Errorf("mkdir project dir: %w", err)
-	}
-
-	prj := ProjectType{
-		ID:        newPrjID,
-		ProductID: prd.ID,
-		Name:      data.Name,
-		D:         data,
-	}
-
-	if err := prj.Save(); err != nil {
-		return 0, fmt.Errorf("error saving TOML, NewProject function: %w", err)
-	}
-
-	prd.Projects = append(prd.Projects, prj)
-	if err := DB.Save(); err != nil {
+	db := prd.database()
+	var newPrjID int
+	err := db.editIndex(func() error {
+		if data.KeyPrefix != "" {
+			if err := db.checkKeyPrefix(prd.ID, 0, data.KeyPrefix); err != nil {
+				return err
+			}
+		}
+		newPrjID = prd.allocProjectID()
+		prj := ProjectType{
+			ID:        newPrjID,
+			ProductID: prd.ID,
+			Name:      data.Name,
+			D:         data,
+			db:        db,
+		}
+		// Another project may have taken the default prefix. Its ID stays
+		// allocated, so a retry gets the next one.
+		if data.KeyPrefix == "" {
+			if err := db.checkKeyPrefix(prd.ID, newPrjID, prj.keyPrefix()); err != nil {
+				return err
+			}
+		}
+		if err := prj.Save(); err != nil {
+			return fmt.Errorf("error saving TOML, NewProject function: %w", err)
+		}
+		prd.Projects = append(prd.Projects, prj)
+		return nil
+	})
+	if err != nil {
 		return 0, err
 	}
 	return newPrjID, nil
@@ -652,12 +894,18 @@ func (prd *ProductType) ModifyProject(id int, data ProjectData) (int, error) {
 			} else {
 				data.Name = prd.Projects[i].D.Name
 			}
+			if data.KeyPrefix != prd.Projects[i].D.KeyPrefix {
+				next := ProjectType{ID: id, ProductID: prd.ID, D: ProjectData{KeyPrefix: data.KeyPrefix}}
+				if err := prd.database().checkKeyPrefix(prd.ID, id, next.keyPrefix()); err != nil {
+					return 0, err
+				}
+			}
 			prd.Projects[i].D = data
 
 			if err := prd.Projects[i].Save(); err != nil {
 				return 0, err
 			}
-			if err := DB.Save(); err != nil {
+			if err := prd.database().Save(); err != nil {
 				return 0, err
 			}
 			return id, nil
@@ -666,63 +914,71 @@ func (prd *ProductType) ModifyProject(id int, data ProjectData) (int, error) {
 	return 0, ErrProjectNotFound
 }
 
-// Save writes the project's data to its project.toml.
+// Save writes the project's data to its project.toml. The last writer wins;
+// the stored revision is advanced past whatever revision is on disk. Use
+// SaveIfRevision or Edit to avoid overwriting concurrent changes. Requirement
+// levels are derived from ParentID; parent cycles fail with ErrHierarchyCycle.
+// Statuses must be states of the project's workflow, which also sets the
+// condition flags, and attributes must fit the project's attribute schema.
 func (prj *ProjectType) Save() error {
-	prjDir := projectDir(prj.ProductID, prj.ID)
-	if err := os.MkdirAll(prjDir, 0o755); err != nil {
-		return fmt.Errorf("mkdir project dir: %w", err)
+	if err := prj.prepareSave(); err != nil {
+		return fmt.Errorf("error writing project TOML: %w", err)
 	}
-	tomlPath := filepath.Join(prjDir, projectTOML)
-
-	// Use a helper struct so ProjectData is included even though the
-	// field is tagged with toml:"-" in ProjectType.
-	type diskProject struct {
-		ID        int         `toml:"id"`
-		ProductID int         `toml:"productid"`
-		Name      string      `toml:"name"`
-		D         ProjectData `toml:"projectdata"`
+	cur, err := storedRevision(prj.store(), prj.ProductID, prj.ID)
+	if err != nil {
+		return fmt.Errorf("error writing project TOML: %w", err)
 	}
+	return prj.saveRevision(max(cur, prj.Revision) + 1)
+}
 
-	dp := diskProject{
-		ID:        prj.ID,
-		ProductID: prj.ProductID,
-		Name:      prj.Name,
-		D:         prj.D,
+// prepareSave derives the fields kept in sync on every write and checks the
+// invariants a stored project satisfies. Save and SaveIfRevision both call it.
+func (prj *ProjectType) prepareSave() error {
+	prj.ensureRequirementIDs()
+	prj.ensureRequirementKeys()
+	if err := prj.ensureHierarchy(); err != nil {
+		return err
 	}
-
-	if err := writeTOML(tomlPath, &dp); err != nil {
-		return fmt.Errorf("error writing project TOML: %w", err)
+	if err := prj.ensureWorkflow(); err != nil {
+		return err
 	}
+	if err := prj.ensureAttributes(); err != nil {
+		return err
+	}
+	prj.ensureApprovals()
 	return nil
 }
 
 // Load loads a single project's TOML for this product.
 func (prj *ProjectType) Load() error {
-	prjDir := projectDir(prj.ProductID, prj.ID)
-	tomlPath := filepath.Join(prjDir, projectTOML)
-
-	type diskProject struct {
-		ID        int         `toml:"id"`
-		ProductID int         `toml:"productid"`
-		Name      string      `toml:"name"`
-		D         ProjectData `toml:"projectdata"`
-	}
-
-	var dp diskProject
-	if err := readTOML(tomlPath, &dp); err != nil {
-		if os.IsNotExist(err) {
+	if err := prj.store().LoadProject(prj); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			return ErrProjectNotFound
 		}
-		return fmt.Errorf("read project %s: %w", tomlPath, err)
+		return fmt.Errorf("read project %s: %w", projectFileKey(prj.ProductID, prj.ID), err)
 	}
-
-	prj.ID = dp.ID
-	prj.ProductID = dp.ProductID
-	prj.Name = dp.Name
-	prj.D = dp.D
 	return nil
 }
 
+// database returns the database the project belongs to, or the package
+// default for projects constructed by hand.
+func (prj *ProjectType) database() *Database {
+	if prj.db != nil {
+		return prj.db
+	}
+	return defaultDB()
+}
+
+// store returns the storage backend for the project.
+func (prj *ProjectType) store() Store {
+	return prj.database().Store()
+}
+
+// llm returns the LLM client of the project's database.
+func (prj *ProjectType) llm() llm.Client {
+	return prj.database().client()
+}
+
 // Project returns the project with the given ID for this product by loading it
 // from its on-disk TOML. If the project is not listed in the product, an
 // ErrProjectNotFound is returned.
@@ -730,6 +986,9 @@ func (prd *ProductType) Project(id int) (*ProjectType, error) {
 	for i := range prd.Projects {
 		if prd.Projects[i].ID == id {
 			prd.Projects[i].ProductID = prd.ID
+			if prd.Projects[i].db == nil {
+				prd.Projects[i].db = prd.db
+			}
 			if err := prd.Projects[i].Load(); err != nil {
 				return nil, err
 			}
@@ -746,6 +1005,9 @@ func (prd *ProductType) LoadProjects() error {
 	}
 	for i := range prd.Projects {
 		prd.Projects[i].ProductID = prd.ID
+		if prd.Projects[i].db == nil {
+			prd.Projects[i].db = prd.db
+		}
 		if err := prd.Projects[i].Load(); err != nil {
 			return err
 		}
@@ -771,18 +1033,6 @@ func (db *Database) LoadAllProjects() error {
 //
 // -----------------------------------------------------------------------------
 
-func productDir(productID int) string {
-	return filepath.Join(baseProductsDir, strconv.Itoa(productID))
-}
-
-func projectDir(productID, projectID int) string {
-	return filepath.Join(productDir(productID), "projects", strconv.Itoa(projectID))
-}
-
-func attachmentDir(productID, projectID int) string {
-	return filepath.Join(productDir(productID), "projects", strconv.Itoa(projectID), "attachments")
-}
-
 func fileExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -794,20 +1044,20 @@ func fileExists(path string) (bool, error) {
 	return false, err
 }
 
+// writeTOML marshals v and atomically replaces path with the result, keeping
+// the previous generation as path+".bak".
 func writeTOML(path string, v any) error {
 	data, err := toml.Marshal(v)
 	if err != nil {
 		return fmt.Errorf("toml marshal: %w", err)
 	}
-	return os.WriteFile(path, data, 0o644)
+	return writeFileAtomic(path, data, 0o644)
 }
 
+// readTOML decodes path into v, recovering from path+".bak" when the file is
+// corrupt.
 func readTOML(path string, v any) error {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return err
-	}
-	return toml.Unmarshal(b, v)
+	return readTOMLRecover(path, v)
 }
 
 // (Optional) helper if you ever need numeric subdirs; kept simple & unused here.
@@ -911,6 +1161,24 @@ func (prj *ProjectType) IngestInputDir(inputDir string) ([]Attachment, error) {
 	return ingested, nil
 }
 
+// nextAttachmentID allocates the next numeric attachment folder ID.
+func (prj *ProjectType) nextAttachmentID() (int, error) {
+	ids, err := prj.store().AttachmentIDs(prj.ProductID, prj.ID)
+	if err != nil {
+		return 0, err
+	}
+	nextID := 1
+	if len(ids) > 0 {
+		nextID = ids[len(ids)-1] + 1
+	}
+	for _, a := range prj.D.Attachments {
+		if a.ID >= nextID {
+			nextID = a.ID + 1
+		}
+	}
+	return nextID, nil
+}
+
 // AddAttachmentFromInput moves a single file from inputDir into this project's
 // attachments/<id>/ folder, records minimal metadata, and saves the project.
 func (prj *ProjectType) AddAttachmentFromInput(inputDir, filename string) (Attachment, error) {
@@ -921,94 +1189,76 @@ func (prj *ProjectType) AddAttachmentFromInput(inputDir, filename string) (Attac
 		return Attachment{}, fmt.Errorf("input file not found: %s", inputPath)
 	}
 
-	// Prepare destination base: .../projects/<prjID>/attachments/
-	attBaseDir := attachmentDir(prj.ProductID, prj.ID)
-	if err := os.MkdirAll(attBaseDir, 0o755); err != nil {
-		return Attachment{}, fmt.Errorf("mkdir attachments: %w", err)
-	}
-
-	// Allocate next numeric ID using existing helper
-	ids, err := numericSubdirs(attBaseDir)
+	nextID, err := prj.nextAttachmentID()
 	if err != nil {
 		return Attachment{}, err
 	}
-	nextID := 1
-	if len(ids) > 0 {
-		nextID = ids[len(ids)-1] + 1
-	}
-
-	// Create the destination directory and final path
-	attDir := filepath.Join(attBaseDir, strconv.Itoa(nextID))
-	if err := os.MkdirAll(attDir, 0o755); err != nil {
-		return Attachment{}, fmt.Errorf("mkdir attachment dir: %w", err)
-	}
 	base := filepath.Base(filename)
-	dstPath := filepath.Join(attDir, base)
+	rel := path.Join("attachments", strconv.Itoa(nextID), base)
 
-	// Move (rename with cross-device copy fallback)
-	if err := moveFile(inputPath, dstPath); err != nil {
-		return Attachment{}, fmt.Errorf("move file: %w", err)
-	}
+	// Detect mimetype before the file leaves the input folder.
+	mt := detectMimeType(inputPath)
 
-	// Detect mimetype
-	mt := detectMimeType(dstPath)
-
-	// Record attachment using a relative path for portability
-	rel := filepath.ToSlash(filepath.Join("attachments", strconv.Itoa(nextID), base))
-	att := Attachment{
-		ID:       nextID,
-		Filename: base,
-		RelPath:  rel,
-		Mimetype: mt,
-		AddedAt:  time.Now(),
-		Analyzed: false,
-	}
-	prj.D.Attachments = append(prj.D.Attachments, att)
-	ptr := &prj.D.Attachments[len(prj.D.Attachments)-1]
-	if err := ptr.Analyze(prj); err != nil {
-		return *ptr, err
-	}
-
-	// Persist to project.toml
-	if err := prj.Save(); err != nil {
-		return *ptr, err
+	// Move (rename with cross-device copy fallback) when the store keeps
+	// plain files, otherwise copy the content into the store.
+	s := prj.store()
+	if ls, ok := s.(localStore); ok {
+		if err := ls.ImportAttachment(prj.ProductID, prj.ID, rel, inputPath); err != nil {
+			return Attachment{}, fmt.Errorf("move file: %w", err)
+		}
+	} else {
+		data, err := os.ReadFile(inputPath)
+		if err != nil {
+			return Attachment{}, err
+		}
+		if err := s.WriteAttachment(prj.ProductID, prj.ID, rel, data); err != nil {
+			return Attachment{}, err
+		}
+		if err := os.Remove(inputPath); err != nil {
+			return Attachment{}, err
+		}
 	}
-	return *ptr, nil
+	return prj.recordAttachment(nextID, base, rel, mt)
 }
 
 // AddAttachmentFromText creates a new attachment from the provided text
 // content and analyzes it using the configured LLM.
 func (prj *ProjectType) AddAttachmentFromText(text string) (Attachment, error) {
-	attBaseDir := attachmentDir(prj.ProductID, prj.ID)
-	if err := os.MkdirAll(attBaseDir, 0o755); err != nil {
-		return Attachment{}, fmt.Errorf("mkdir attachments: %w", err)
+	return prj.addAttachmentData("note.txt", []byte(text), "text/plain")
+}
+
+// AddAttachmentData stores data as a new attachment named filename, analyzes
+// it using the configured LLM and saves the project.
+func (prj *ProjectType) AddAttachmentData(filename string, data []byte) (Attachment, error) {
+	mt := http.DetectContentType(data)
+	if mt == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(filename)); byExt != "" {
+			mt = byExt
+		}
 	}
+	return prj.addAttachmentData(filepath.Base(filename), data, mt)
+}
 
-	ids, err := numericSubdirs(attBaseDir)
+func (prj *ProjectType) addAttachmentData(filename string, data []byte, mt string) (Attachment, error) {
+	nextID, err := prj.nextAttachmentID()
 	if err != nil {
 		return Attachment{}, err
 	}
-	nextID := 1
-	if len(ids) > 0 {
-		nextID = ids[len(ids)-1] + 1
-	}
-
-	attDir := filepath.Join(attBaseDir, strconv.Itoa(nextID))
-	if err := os.MkdirAll(attDir, 0o755); err != nil {
-		return Attachment{}, fmt.Errorf("mkdir attachment dir: %w", err)
-	}
-	filename := "note.txt"
-	dstPath := filepath.Join(attDir, filename)
-	if err := os.WriteFile(dstPath, []byte(text), 0o644); err != nil {
+	rel := path.Join("attachments", strconv.Itoa(nextID), filename)
+	if err := prj.store().WriteAttachment(prj.ProductID, prj.ID, rel, data); err != nil {
 		return Attachment{}, err
 	}
+	return prj.recordAttachment(nextID, filename, rel, mt)
+}
 
-	rel := filepath.ToSlash(filepath.Join("attachments", strconv.Itoa(nextID), filename))
+// recordAttachment appends the metadata for a stored attachment, analyzes it
+// and persists the project.
+func (prj *ProjectType) recordAttachment(id int, filename, rel, mt string) (Attachment, error) {
 	att := Attachment{
-		ID:       nextID,
+		ID:       id,
 		Filename: filename,
 		RelPath:  rel,
-		Mimetype: "text/plain",
+		Mimetype: mt,
 		AddedAt:  time.Now(),
 		Analyzed: false,
 	}
@@ -1017,97 +1267,127 @@ func (prj *ProjectType) AddAttachmentFromText(text string) (Attachment, error) {
 	if err := ptr.Analyze(prj); err != nil {
 		return *ptr, err
 	}
+
+	// Persist to project.toml
 	if err := prj.Save(); err != nil {
 		return *ptr, err
 	}
 	return *ptr, nil
 }
 
-// ActivateRequirementByID activates the requirement with the given ID.
-// It sets Proposed to false and Active to true.
-func (prj *ProjectType) ActivateRequirementByID(id int) {
-	for i := range prj.D.Requirements {
-		if prj.D.Requirements[i].ID == id {
-			prj.D.Requirements[i].Condition.Proposed = false
-			prj.D.Requirements[i].Condition.Active = true
-			_ = prj.Save()
-			return
+// ReadAttachment returns the stored content of the attachment with the given ID.
+func (prj *ProjectType) ReadAttachment(id int) (Attachment, []byte, error) {
+	for _, a := range prj.D.Attachments {
+		if a.ID == id {
+			data, err := prj.store().ReadAttachment(prj.ProductID, prj.ID, a.RelPath)
+			return a, data, err
 		}
 	}
+	return Attachment{}, nil, ErrAttachmentNotFound
 }
 
-// ActivateRequirementsWhere activates all requirements for which pred returns true.
-// It toggles Proposed to false and Active to true for matches.
-func (prj *ProjectType) ActivateRequirementsWhere(pred func(Requirement) bool) {
-	for i := range prj.D.Requirements {
-		if pred(prj.D.Requirements[i]) {
-			prj.D.Requirements[i].Condition.Proposed = false
-			prj.D.Requirements[i].Condition.Active = true
+// RemoveAttachment deletes the attachment with the given ID from storage and
+// from the project metadata, then saves the project.
+func (prj *ProjectType) RemoveAttachment(id int) error {
+	for i := range prj.D.Attachments {
+		if prj.D.Attachments[i].ID != id {
+			continue
 		}
+		err := prj.store().RemoveAttachment(prj.ProductID, prj.ID, prj.D.Attachments[i].RelPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		prj.D.Attachments = append(prj.D.Attachments[:i], prj.D.Attachments[i+1:]...)
+		return prj.Save()
 	}
-	_ = prj.Save()
+	return ErrAttachmentNotFound
 }
 
-// DeleteRequirementByID marks the requirement with the given ID as deleted.
-// The change is persisted to disk.
-func (prj *ProjectType) DeleteRequirementByID(id int) {
-	for i := range prj.D.Requirements {
-		if prj.D.Requirements[i].ID == id {
-			prj.D.Requirements[i].Condition.Deleted = true
-			_ = prj.Save()
-			return
-		}
-	}
+// ActivateRequirementByID moves the requirement with the given ID into the
+// nearest active state of its workflow, Approved by default, and persists
+// the project. A Draft requirement passes through Review on the way; the
+// guards of every step apply.
+func (prj *ProjectType) ActivateRequirementByID(id int) error {
+	return prj.Update(func(tx *ProjectTx) error { return tx.Activate(id) })
 }
 
-// RestoreRequirementByID clears the deleted flag on the requirement with the given ID.
-// The change is persisted to disk.
-func (prj *ProjectType) RestoreRequirementByID(id int) {
-	for i := range prj.D.Requirements {
-		if prj.D.Requirements[i].ID == id {
-			prj.D.Requirements[i].Condition.Deleted = false
-			_ = prj.Save()
-			return
+// ActivateRequirementsWhere activates all requirements for which pred returns
+// true, like ActivateRequirementByID, and persists the project once.
+// Requirements that cannot be activated are left unchanged and reported in
+// the returned error.
+func (prj *ProjectType) ActivateRequirementsWhere(pred func(Requirement) bool) error {
+	var errs []error
+	err := prj.Update(func(tx *ProjectTx) error {
+		for _, r := range tx.Requirements() {
+			if pred(r) {
+				if err := tx.Activate(r.ID); err != nil {
+					errs = append(errs, err)
+				}
+			}
 		}
-	}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// DeleteRequirementByID retires the requirement with the given ID, which
+// marks it deleted. The change is persisted to disk.
+func (prj *ProjectType) DeleteRequirementByID(id int) error {
+	return prj.Update(func(tx *ProjectTx) error { return tx.Delete(id) })
+}
+
+// RestoreRequirementByID moves a retired requirement along the first
+// transition out of its state, back to Draft by default. The change is
+// persisted to disk.
+func (prj *ProjectType) RestoreRequirementByID(id int) error {
+	return prj.Update(func(tx *ProjectTx) error { return tx.Restore(id) })
 }
 
-// ensureRequirementIDs assigns monotonically increasing IDs to any requirements
-// missing one. It preserves existing IDs and fills gaps based on the current
-// maximum ID.
+// ensureRequirementIDs gives requirements missing an ID the next IDs of the
+// project's counter. The counter is raised past the IDs in use first, so
+// projects edited by hand cannot get duplicate IDs either.
 func (prj *ProjectType) ensureRequirementIDs() {
-	maxID := 0
-	for i := range prj.D.Requirements {
-		if prj.D.Requirements[i].ID > maxID {
-			maxID = prj.D.Requirements[i].ID
-		}
+	next := max(prj.D.NextRequirementID, 1)
+	for _, r := range prj.D.Requirements {
+		next = max(next, r.ID+1)
 	}
 	for i := range prj.D.Requirements {
 		if prj.D.Requirements[i].ID == 0 {
-			maxID++
-			prj.D.Requirements[i].ID = maxID
+			prj.D.Requirements[i].ID = next
+			next++
 		}
 	}
+	prj.D.NextRequirementID = next
 }
 
-// AddRequirement appends a requirement to the project and persists it.
+// forgetRequirement removes every reference to the requirement with the given
+// ID before it leaves the project: its relations, intelligence links, review
+// comments, risk and test case links. Its children move up to parentID.
+func (prj *ProjectType) forgetRequirement(id, parentID int, comment string) {
+	prj.removeRelationsOf(id)
+	prj.removeIntelligenceLinksOf(id)
+	prj.removeCommentsOf(id)
+	prj.removeRiskLinksOf(id)
+	prj.removeTestLinksOf(id)
+	prj.detachChildren(id, parentID, comment)
+}
+
+// AddRequirement appends a requirement to the project and persists it. With
+// FixedCategories set, categories outside the catalog fail with
+// ErrUnknownCategory.
 func (prj *ProjectType) AddRequirement(r Requirement) error {
-	maxID := 0
-	for i := range prj.D.Requirements {
-		if prj.D.Requirements[i].ID > maxID {
-			maxID = prj.D.Requirements[i].ID
-		}
-	}
-	r.ID = maxID + 1
-	prj.D.Requirements = append(prj.D.Requirements, r)
-	return prj.Save()
+	return prj.Update(func(tx *ProjectTx) error {
+		_, err := tx.AddRequirement(r)
+		return err
+	})
 }
 
 // GenerateDesignAspectsAll runs GenerateDesignAspects for every requirement in
 // the project and persists the results.
 func (prj *ProjectType) GenerateDesignAspectsAll() error {
+	c := prj.llm()
 	for i := range prj.D.Requirements {
-		if _, err := prj.D.Requirements[i].GenerateDesignAspects(); err != nil {
+		if _, err := prj.D.Requirements[i].generateDesignAspects(c); err != nil {
 			return err
 		}
 	}
@@ -1117,12 +1397,13 @@ func (prj *ProjectType) GenerateDesignAspectsAll() error {
 // QualityControlPending runs QualityControlAI on each active requirement that
 // has not yet been analyzed. Proposed or deleted requirements are skipped.
 func (prj *ProjectType) QualityControlPending(role, questionID string, gateIDs []string) error {
+	c := prj.llm()
 	for i := range prj.D.Requirements {
 		req := &prj.D.Requirements[i]
 		if req.Condition.Proposed || req.Condition.Deleted || req.Condition.AIanalyzed {
 			continue
 		}
-		if _, _, err := req.QualityControlAI(role, questionID, gateIDs); err != nil {
+		if _, _, err := req.qualityControl(c, role, questionID, gateIDs, prj.gateContext()); err != nil {
 			return err
 		}
 	}
@@ -1135,12 +1416,13 @@ func (prj *ProjectType) QualityControlPending(role, questionID string, gateIDs [
 func (prj *ProjectType) AnalyzeAll(role, questionID string, gateIDs []string) error {
 	var firstErr error
 
+	c := prj.llm()
 	for i := range prj.D.Requirements {
 		req := &prj.D.Requirements[i]
 		if req.Condition.Proposed || req.Condition.Deleted || req.Condition.AIanalyzed {
 			continue
 		}
-		if _, _, err := req.QualityControlAI(role, questionID, gateIDs); err != nil && firstErr == nil {
+		if _, _, err := req.qualityControl(c, role, questionID, gateIDs, prj.gateContext()); err != nil && firstErr == nil {
 			firstErr = err
 		}
 	}
@@ -1151,3 +1433,31 @@ func (prj *ProjectType) AnalyzeAll(role, questionID string, gateIDs []string) er
 
 	return firstErr
 }
+
+// EvaluateGates runs the specified gates against the requirement with the
+// given ID using the project's LLM client and glossary, and persists the
+// results. Changed results are recorded as made by ActorAI.
+func (prj *ProjectType) EvaluateGates(id int, gateIDs []string) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	c, ctx := prj.llm(), prj.gateContext()
+	if err := r.track(ActorAI, "gate evaluation", func() error {
+		return r.evaluateGates(c, gateIDs, ctx)
+	}); err != nil {
+		return err
+	}
+	return prj.Save()
+}
+
+// AnalyzeRequirement runs Analyze for the requirement with the given ID using
+// the project's LLM client.
+func (prj *ProjectType) AnalyzeRequirement(id int, role, questionID string) (bool, string, error) {
+	for i := range prj.D.Requirements {
+		if prj.D.Requirements[i].ID == id {
+			return prj.D.Requirements[i].analyze(prj.llm(), role, questionID)
+		}
+	}
+	return false, "", fmt.Errorf("requirement %d not found", id)
+}
@@ -275,7 +275,7 @@ func TestAttachmentGenerateRequirements(t *testing.T) {
 	att := Attachment{RelPath: filepath.ToSlash(filepath.Join("attachments", "1", "f.txt"))}
 	prj.D.Attachments = []Attachment{att}
 	ptr := &prj.D.Attachments[0]
-	expected = filepath.Join(projectDir(prj.ProductID, prj.ID), att.RelPath)
+	expected = filepath.Join(NewFSStore(dir).ProjectPath(prj.ProductID, prj.ID), att.RelPath)
 	if err := os.MkdirAll(filepath.Dir(expected), 0o755); err != nil {
 		t.Fatalf("MkdirAll: %v", err)
 	}
@@ -311,7 +311,7 @@ func TestAttachmentGenerateRequirements(t *testing.T) {
 	var dp struct {
 		D ProjectData `toml:"projectdata"`
 	}
-	p := filepath.Join(projectDir(prj.ProductID, prj.ID), projectTOML)
+	p := filepath.Join(NewFSStore(dir).ProjectPath(prj.ProductID, prj.ID), projectTOML)
 	if err := readTOML(p, &dp); err != nil {
 		t.Fatalf("readTOML: %v", err)
 	}
@@ -0,0 +1,131 @@
+package PMFS
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
+)
+
+// ErrMissingAcceptanceCriteria is returned by CheckAcceptanceCriteria and the
+// "has-acceptance-criteria" workflow guard.
+var ErrMissingAcceptanceCriteria = errors.New("missing acceptance criteria")
+
+// AcceptanceCriterion is one testable condition of a requirement, either as
+// Given/When/Then steps or, when Text is set, free-form.
+type AcceptanceCriterion struct {
+	Given string `json:"given,omitempty" toml:"given"`
+	When  string `json:"when,omitempty" toml:"when"`
+	Then  string `json:"then,omitempty" toml:"then"`
+	Text  string `json:"text,omitempty" toml:"text"` // free-form criterion
+}
+
+// FreeForm reports whether the criterion is free text rather than steps.
+func (c AcceptanceCriterion) FreeForm() bool {
+	return c.Text != ""
+}
+
+// Empty reports whether the criterion states nothing.
+func (c AcceptanceCriterion) Empty() bool {
+	return strings.TrimSpace(c.Given+c.When+c.Then+c.Text) == ""
+}
+
+// String renders the criterion on one line.
+func (c AcceptanceCriterion) String() string {
+	if c.FreeForm() {
+		return c.Text
+	}
+	var parts []string
+	for _, p := range []struct{ kw, s string }{{"Given", c.Given}, {"When", c.When}, {"Then", c.Then}} {
+		if p.s != "" {
+			parts = append(parts, p.kw+" "+p.s)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	RegisterGuard("has-acceptance-criteria", func(_ *ProjectType, r *Requirement) error {
+		if !r.hasAcceptanceCriteria() {
+			return ErrMissingAcceptanceCriteria
+		}
+		return nil
+	})
+}
+
+// hasAcceptanceCriteria reports whether r has at least one non-empty criterion.
+func (r *Requirement) hasAcceptanceCriteria() bool {
+	for _, c := range r.AcceptanceCriteria {
+		if !c.Empty() {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAcceptanceCriteria is the project-level gate for testers: it fails
+// with ErrMissingAcceptanceCriteria, naming the requirements, when an active
+// requirement has no acceptance criterion.
+func (prj *ProjectType) CheckAcceptanceCriteria() error {
+	var ids []string
+	for _, r := range prj.D.Requirements {
+		if r.Condition.Active && !r.Condition.Deleted && !r.hasAcceptanceCriteria() {
+			ids = append(ids, fmt.Sprint(r.ID))
+		}
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("requirements %s: %w", strings.Join(ids, ", "), ErrMissingAcceptanceCriteria)
+	}
+	return nil
+}
+
+// DraftAcceptanceCriteria asks the client for acceptance criteria based on
+// the requirement's description. Returned criteria are appended to the
+// requirement, recorded in its history as made by ActorAI and returned to
+// the caller. The default database's LLM client is used;
+// ProjectType.DraftAcceptanceCriteria uses the project's and saves.
+func (r *Requirement) DraftAcceptanceCriteria() ([]AcceptanceCriterion, error) {
+	return r.draftAcceptanceCriteria(defaultDB().client())
+}
+
+func (r *Requirement) draftAcceptanceCriteria(c llm.Client) ([]AcceptanceCriterion, error) {
+	prompt := fmt.Sprintf("Given the requirement %q, draft acceptance criteria a tester can verify (JSON array with `given`, `when` and `then`; use `text` instead for a criterion that does not fit those steps).", r.Description)
+	resp, err := c.Ask(prompt)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := parseLLMJSON(resp)
+	if err != nil {
+		return nil, err
+	}
+	var drafted []AcceptanceCriterion
+	if err := json.Unmarshal(raw, &drafted); err != nil {
+		return nil, err
+	}
+	out := drafted[:0]
+	for _, ac := range drafted {
+		if !ac.Empty() {
+			out = append(out, ac)
+		}
+	}
+	before := r.snapshot()
+	r.AcceptanceCriteria = append(r.AcceptanceCriteria, out...)
+	r.recordSince(before, ActorAI, "drafted acceptance criteria")
+	return out, nil
+}
+
+// DraftAcceptanceCriteria drafts acceptance criteria for the requirement with
+// the given ID using the project's LLM client and persists the project.
+func (prj *ProjectType) DraftAcceptanceCriteria(id int) ([]AcceptanceCriterion, error) {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.draftAcceptanceCriteria(prj.llm())
+	if err != nil {
+		return nil, err
+	}
+	return out, prj.Save()
+}
@@ -0,0 +1,73 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestDraftAcceptanceCriteria(t *testing.T) {
+	db, prj, _ := newKeysDB(t)
+	db.LLM = gemini.ClientFunc{AskFunc: func(string) (string, error) {
+		return "```json\n[{\"given\":\"a running belt\",\"when\":\"stop is pressed\",\"then\":\"it halts within 1 s\"},{\"text\":\"Meets EN 620\"},{}]\n```", nil
+	}}
+	prj.D.Requirements = []Requirement{{ID: 1, Description: "The belt stops on demand."}}
+
+	out, err := prj.DraftAcceptanceCriteria(1)
+	if err != nil {
+		t.Fatalf("DraftAcceptanceCriteria: %v", err)
+	}
+	if len(out) != 2 || out[0].FreeForm() || !out[1].FreeForm() {
+		t.Fatalf("unexpected criteria: %#v", out)
+	}
+	if got := out[0].String(); got != "Given a running belt, When stop is pressed, Then it halts within 1 s" {
+		t.Fatalf("String = %q", got)
+	}
+	r := &prj.D.Requirements[0]
+	if len(r.AcceptanceCriteria) != 2 || lastChange(t, r).User != ActorAI {
+		t.Fatalf("criteria not stored: %#v", r)
+	}
+
+	path := filepath.Join(t.TempDir(), "ac.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	pd, err := ImportProjectExcel(path)
+	if err != nil {
+		t.Fatalf("ImportProjectExcel: %v", err)
+	}
+	if ac := pd.Requirements[0].AcceptanceCriteria; len(ac) != 2 || ac[0] != out[0] || ac[1] != out[1] {
+		t.Fatalf("criteria not round-tripped: %#v", ac)
+	}
+}
+
+func TestCheckAcceptanceCriteria(t *testing.T) {
+	prj := newRelationsProject(t)
+	for i := range prj.D.Requirements[:2] {
+		prj.D.Requirements[i].Condition.Active = true
+	}
+	prj.D.Requirements[0].AcceptanceCriteria = []AcceptanceCriterion{{Text: "works"}}
+	if err := prj.CheckAcceptanceCriteria(); !errors.Is(err, ErrMissingAcceptanceCriteria) || err.Error() != "requirements 2: missing acceptance criteria" {
+		t.Fatalf("CheckAcceptanceCriteria = %v", err)
+	}
+	prj.D.Requirements[1].AcceptanceCriteria = []AcceptanceCriterion{{When: "x", Then: "y"}}
+	if err := prj.CheckAcceptanceCriteria(); err != nil {
+		t.Fatalf("CheckAcceptanceCriteria: %v", err)
+	}
+
+	// The guard can require criteria before a workflow transition.
+	wf := DefaultWorkflow()
+	for i := range wf.Transitions {
+		if wf.Transitions[i].To == "Review" {
+			wf.Transitions[i].Guards = append(wf.Transitions[i].Guards, "has-acceptance-criteria")
+		}
+	}
+	if err := prj.SetWorkflow(wf); err != nil {
+		t.Fatalf("SetWorkflow: %v", err)
+	}
+	if err := prj.Transition(3, "Review"); !errors.Is(err, ErrMissingAcceptanceCriteria) || !errors.Is(err, ErrGuardFailed) {
+		t.Fatalf("expected guard to block Review, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package PMFS
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rjboer/PMFS/pmfs/llm/prompts"
+)
+
+var (
+	// ErrUnknownRole is returned for approval roles that are not registered
+	// in the prompts package.
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrNotApproved is returned by the "approved" workflow guard while the
+	// project's approval policy is not met.
+	ErrNotApproved = errors.New("approval policy not met")
+)
+
+// ApprovalRule requires Count distinct users to sign off a requirement in
+// Role, a role name from the prompts package such as "qa_lead".
+type ApprovalRule struct {
+	Role  string `json:"role" toml:"role"`
+	Count int    `json:"count,omitempty" toml:"count"` // 1 when zero
+}
+
+// SignOff records a user's approval of a requirement's content.
+type SignOff struct {
+	Role     string    `json:"role" toml:"role"`
+	User     string    `json:"user" toml:"user"`
+	SignedAt time.Time `json:"signed_at" toml:"signed_at"`
+	// Hash is the requirement's ContentHash at sign-off.
+	Hash string `json:"hash" toml:"hash"`
+	// Invalidated is set on save once the description no longer matches Hash.
+	Invalidated bool `json:"invalidated,omitempty" toml:"invalidated"`
+}
+
+func init() {
+	RegisterGuard("approved", func(prj *ProjectType, r *Requirement) error {
+		if missing := prj.missingApprovals(r); len(missing) > 0 {
+			var roles []string
+			for _, m := range missing {
+				roles = append(roles, fmt.Sprintf("%s (%d more)", m.Role, m.Count))
+			}
+			return fmt.Errorf("%w: %s", ErrNotApproved, strings.Join(roles, ", "))
+		}
+		return nil
+	})
+}
+
+// ContentHash returns the SHA-256 of the requirement's description, the
+// content sign-offs approve.
+func (r *Requirement) ContentHash() string {
+	sum := sha256.Sum256([]byte(r.Description))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApprovalPolicy returns the project's approval rules. An empty policy
+// requires no approvals.
+func (prj *ProjectType) ApprovalPolicy() []ApprovalRule {
+	return prj.D.ApprovalPolicy
+}
+
+// SetApprovalPolicy replaces the project's approval rules and persists the
+// project. Roles must be registered in the prompts package.
+func (prj *ProjectType) SetApprovalPolicy(rules []ApprovalRule) error {
+	out := make([]ApprovalRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Role = strings.ToLower(strings.TrimSpace(rule.Role))
+		if !slices.Contains(prompts.Roles(), rule.Role) {
+			return fmt.Errorf("%q: %w", rule.Role, ErrUnknownRole)
+		}
+		if rule.Count < 0 {
+			return fmt.Errorf("%s: negative count %d", rule.Role, rule.Count)
+		}
+		out = append(out, rule)
+	}
+	prj.D.ApprovalPolicy = out
+	return prj.Save()
+}
+
+// Approve signs the requirement off in role for user, or for the database
+// user when empty, and persists the project. Signing again in the same role
+// renews the user's sign-off for the current content.
+func (prj *ProjectType) Approve(id int, role, user string) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	role = strings.ToLower(strings.TrimSpace(role))
+	if !slices.ContainsFunc(prj.D.ApprovalPolicy, func(rule ApprovalRule) bool { return rule.Role == role }) {
+		return fmt.Errorf("%q is not in the approval policy: %w", role, ErrUnknownRole)
+	}
+	if user == "" {
+		user = prj.user()
+	}
+	before := r.snapshot()
+	r.Approvals = slices.DeleteFunc(r.Approvals, func(s SignOff) bool { return s.Role == role && s.User == user })
+	r.Approvals = append(r.Approvals, SignOff{Role: role, User: user, SignedAt: time.Now().UTC(), Hash: r.ContentHash()})
+	r.recordSince(before, user, "signed off as "+role)
+	return prj.Save()
+}
+
+// MissingApprovals returns the policy rules the requirement does not meet
+// yet, with Count set to the number of sign-offs still needed.
+func (prj *ProjectType) MissingApprovals(id int) ([]ApprovalRule, error) {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return prj.missingApprovals(r), nil
+}
+
+func (prj *ProjectType) missingApprovals(r *Requirement) []ApprovalRule {
+	hash := r.ContentHash()
+	out := []ApprovalRule{}
+	for _, rule := range prj.D.ApprovalPolicy {
+		need := max(rule.Count, 1)
+		var users []string
+		for _, s := range r.Approvals {
+			if s.Role == rule.Role && !s.Invalidated && s.Hash == hash && !slices.Contains(users, s.User) {
+				users = append(users, s.User)
+			}
+		}
+		if len(users) < need {
+			out = append(out, ApprovalRule{Role: rule.Role, Count: need - len(users)})
+		}
+	}
+	return out
+}
+
+// ensureApprovals invalidates sign-offs whose content hash no longer matches
+// the requirement.
+func (prj *ProjectType) ensureApprovals() {
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		hash := r.ContentHash()
+		if !slices.ContainsFunc(r.Approvals, func(s SignOff) bool { return !s.Invalidated && s.Hash != hash }) {
+			continue
+		}
+		before := r.snapshot()
+		for j := range r.Approvals {
+			if r.Approvals[j].Hash != hash {
+				r.Approvals[j].Invalidated = true
+			}
+		}
+		r.recordSince(before, ActorSystem, "approvals invalidated: description changed")
+	}
+}
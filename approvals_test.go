@@ -0,0 +1,72 @@
+package PMFS
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApprovalPolicy(t *testing.T) {
+	prj := newRelationsProject(t)
+	if err := prj.SetApprovalPolicy([]ApprovalRule{{Role: "release_manager"}}); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected ErrUnknownRole, got %v", err)
+	}
+	if err := prj.SetApprovalPolicy([]ApprovalRule{{Role: "QA_Lead"}, {Role: "product_manager", Count: 2}}); err != nil {
+		t.Fatalf("SetApprovalPolicy: %v", err)
+	}
+	if err := prj.Transition(1, "Review"); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	if err := prj.Transition(1, "Approved"); !errors.Is(err, ErrNotApproved) || !errors.Is(err, ErrGuardFailed) {
+		t.Fatalf("expected approval guard to block, got %v", err)
+	}
+	if err := prj.Approve(1, "cto", "erin"); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected role outside the policy to be rejected, got %v", err)
+	}
+	for _, s := range []struct{ role, user string }{{"qa_lead", "quinn"}, {"product_manager", "pat"}, {"product_manager", "pat"}} {
+		if err := prj.Approve(1, s.role, s.user); err != nil {
+			t.Fatalf("Approve: %v", err)
+		}
+	}
+	missing, err := prj.MissingApprovals(1)
+	if err != nil || len(missing) != 1 || missing[0] != (ApprovalRule{Role: "product_manager", Count: 1}) {
+		t.Fatalf("MissingApprovals = %v, %v", missing, err)
+	}
+	if err := prj.Approve(1, "product_manager", "sam"); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	r := &prj.D.Requirements[0]
+	if s := r.Approvals[0]; s.User != "quinn" || s.Hash != r.ContentHash() || s.SignedAt.IsZero() || lastChange(t, r).User != "sam" {
+		t.Fatalf("unexpected sign-off: %#v", r.Approvals)
+	}
+
+	// Changing the description invalidates every sign-off on save.
+	r.Description = "changed after sign-off"
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	for _, s := range r.Approvals {
+		if !s.Invalidated {
+			t.Fatalf("sign-off not invalidated: %#v", s)
+		}
+	}
+	if ch := lastChange(t, r); ch.User != ActorSystem {
+		t.Fatalf("invalidation not recorded: %#v", ch)
+	}
+	if missing, _ := prj.MissingApprovals(1); len(missing) != 2 {
+		t.Fatalf("MissingApprovals after change = %v", missing)
+	}
+	if err := prj.Transition(1, "Approved"); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("expected invalidated approvals to block, got %v", err)
+	}
+	for _, s := range []struct{ role, user string }{{"qa_lead", "quinn"}, {"product_manager", "pat"}, {"product_manager", "sam"}} {
+		if err := prj.Approve(1, s.role, s.user); err != nil {
+			t.Fatalf("Approve: %v", err)
+		}
+	}
+	if err := prj.Transition(1, "Approved"); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	if !r.Condition.Active {
+		t.Fatalf("requirement not active: %#v", r.Condition)
+	}
+}
@@ -0,0 +1,164 @@
+package PMFS
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const (
+	backupSuffix  = ".bak"
+	corruptSuffix = ".corrupt"
+)
+
+// writeFileAtomic replaces path with data without ever exposing a partially
+// written file. The data is written to a temporary file in the same directory,
+// fsynced and renamed over path. The previous generation, if any, is kept as
+// path+".bak" so a later corruption can be recovered.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return replaceFile(path, data, perm, true)
+}
+
+// replaceFile implements writeFileAtomic. When rotate is false the existing
+// backup is left untouched.
+func replaceFile(path string, data []byte, perm os.FileMode, rotate bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	// Remove the temp file on any failure below; after a successful rename
+	// this is a no-op.
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+
+	if ok, err := fileExists(path); err != nil {
+		return err
+	} else if ok && rotate {
+		if err := keepBackup(path); err != nil {
+			return fmt.Errorf("backup %s: %w", path, err)
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// keepBackup preserves the current contents of path as path+".bak". A hard
+// link is used where possible so no data is copied; otherwise the file is
+// copied and fsynced.
+func keepBackup(path string) error {
+	bak := path + backupSuffix
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(bak, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir flushes directory metadata so a completed rename survives a crash.
+// Errors are ignored because not every platform supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// decodeTOMLStrict unmarshals b into v, treating an empty document as
+// corruption. A truncated write typically leaves either an empty file or a
+// syntax error behind; both must trigger recovery rather than silently
+// loading an empty project.
+func decodeTOMLStrict(b []byte, v any) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return fmt.Errorf("empty document")
+	}
+	return toml.Unmarshal(b, v)
+}
+
+// readTOMLRecover reads path into v. When the file exists but cannot be
+// decoded, the previous generation is loaded from path+".bak" instead. On a
+// successful recovery the corrupt file is preserved as path+".corrupt" and
+// the backup is written back to path. Errors for a missing file are returned
+// unchanged so os.IsNotExist keeps working for callers.
+func readTOMLRecover(path string, v any) error {
+	return readRecover(path, func(b []byte) error {
+		// Discard anything a corrupt generation managed to decode.
+		reflect.ValueOf(v).Elem().SetZero()
+		return decodeTOMLStrict(b, v)
+	})
+}
+
+// readRecover implements readTOMLRecover with a caller-supplied decoder,
+// which is tried on the file and then on its backup.
+func readRecover(path string, decode func([]byte) error) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decErr := decode(b)
+	if decErr == nil {
+		return nil
+	}
+
+	bak, err := os.ReadFile(path + backupSuffix)
+	if err != nil {
+		return fmt.Errorf("%s is corrupt and no backup is available: %w", path, decErr)
+	}
+	if err := decode(bak); err != nil {
+		return fmt.Errorf("%s is corrupt and its backup is unreadable: %w", path, decErr)
+	}
+	if err := os.WriteFile(path+corruptSuffix, b, 0o644); err != nil {
+		return fmt.Errorf("preserve corrupt %s: %w", path, err)
+	}
+	// Restore without rotating the backup: the corrupt file must not
+	// replace the last good generation.
+	if err := replaceFile(path, bak, 0o644, false); err != nil {
+		return fmt.Errorf("restore %s from backup: %w", path, err)
+	}
+	return nil
+}
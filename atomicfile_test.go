@@ -0,0 +1,124 @@
+package PMFS
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTOMLKeepsBackupAndNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "doc.toml")
+	type doc struct {
+		Name string `toml:"name"`
+	}
+	if err := writeTOML(p, &doc{Name: "first"}); err != nil {
+		t.Fatalf("writeTOML: %v", err)
+	}
+	if _, err := os.Stat(p + backupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("unexpected backup after first write: %v", err)
+	}
+	if err := writeTOML(p, &doc{Name: "second"}); err != nil {
+		t.Fatalf("writeTOML: %v", err)
+	}
+	var cur, prev doc
+	if err := readTOML(p, &cur); err != nil || cur.Name != "second" {
+		t.Fatalf("current generation = %#v, %v", cur, err)
+	}
+	if err := readTOML(p+backupSuffix, &prev); err != nil || prev.Name != "first" {
+		t.Fatalf("backup generation = %#v, %v", prev, err)
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, e := range ents {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestProjectLoadRecoversFromBackup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	prd := &db.Products[0]
+	if _, err := prd.NewProject(ProjectData{Name: "prj"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	prj := &prd.Projects[0]
+	prj.D.Requirements = []Requirement{{ID: 1, Name: "kept"}}
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	prj.D.Requirements = append(prj.D.Requirements, Requirement{ID: 2, Name: "lost"})
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Simulate a torn write of the latest generation.
+	p := filepath.Join(NewFSStore(dir).ProjectPath(prj.ProductID, prj.ID), projectTOML)
+	if err := os.WriteFile(p, []byte("[projectdata\nname = "), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	reload := ProjectType{ID: prj.ID, ProductID: prj.ProductID}
+	if err := reload.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(reload.D.Requirements) != 1 || reload.D.Requirements[0].Name != "kept" {
+		t.Fatalf("project not recovered from backup: %#v", reload.D.Requirements)
+	}
+	if _, err := os.Stat(p + corruptSuffix); err != nil {
+		t.Fatalf("corrupt file not preserved: %v", err)
+	}
+	// The restored file must be readable on its own.
+	var again ProjectType
+	again.ID, again.ProductID = prj.ID, prj.ProductID
+	if err := again.Load(); err != nil || again.Name != "prj" {
+		t.Fatalf("restored project unreadable: %#v, %v", again, err)
+	}
+}
+
+func TestLoadSetupRecoversTruncatedIndex(t *testing.T) {
+	dir := t.TempDir()
+	db, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod1"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod2"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	idx := filepath.Join(dir, productsDir, indexFilename)
+	if err := os.Truncate(idx, 0); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	db2, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup after truncation: %v", err)
+	}
+	if len(db2.Products) != 1 || db2.Products[0].Name != "prod1" {
+		t.Fatalf("index not recovered from backup: %#v", db2.Products)
+	}
+}
+
+func TestReadTOMLCorruptWithoutBackup(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "doc.toml")
+	if err := os.WriteFile(p, []byte("= broken"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	var v struct{}
+	if err := readTOML(p, &v); err == nil {
+		t.Fatalf("expected error for corrupt file without backup")
+	}
+}
@@ -18,9 +18,15 @@ func (prj *ProjectType) Attachments() AttachmentManager {
 
 // AddFromInputFolder scans the project's default "input" directory and ingests
 // all regular files into the project's attachments directory.
-// Files are moved into attachments/ and project.toml is updated.
+// Files are moved into attachments/ and project.toml is updated. The input
+// folder only exists for filesystem-backed stores; other stores return
+// ErrNoLocalFiles.
 func (am AttachmentManager) AddFromInputFolder() ([]Attachment, error) {
-	inputDir := filepath.Join(projectDir(am.prj.ProductID, am.prj.ID), "input")
+	ls, ok := am.prj.store().(localStore)
+	if !ok {
+		return nil, ErrNoLocalFiles
+	}
+	inputDir := filepath.Join(ls.ProjectPath(am.prj.ProductID, am.prj.ID), "input")
 
 	entries, err := os.ReadDir(inputDir)
 	if err != nil {
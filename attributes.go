@@ -0,0 +1,284 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownAttribute is returned for attributes missing from the
+	// project's schema.
+	ErrUnknownAttribute = errors.New("unknown attribute")
+	// ErrInvalidAttribute is returned for attribute values or definitions
+	// that do not fit their type.
+	ErrInvalidAttribute = errors.New("invalid attribute")
+)
+
+// AttributeType is the value type of a custom requirement attribute.
+type AttributeType string
+
+const (
+	AttrString AttributeType = "string"
+	AttrInt    AttributeType = "int"
+	AttrEnum   AttributeType = "enum" // one of AttributeDef.Values
+	AttrDate   AttributeType = "date" // YYYY-MM-DD
+	AttrBool   AttributeType = "bool"
+)
+
+// dateLayout is the stored form of AttrDate values.
+const dateLayout = "2006-01-02"
+
+// AttributeDef defines a custom attribute requirements of a project may
+// carry, such as an ASIL level or a cost center.
+type AttributeDef struct {
+	Name        string        `json:"name" toml:"name"`
+	Type        AttributeType `json:"type" toml:"type"`
+	Values      []string      `json:"values,omitempty" toml:"values"` // allowed values of an enum
+	Description string        `json:"description,omitempty" toml:"description"`
+}
+
+// validate checks the definition itself.
+func (d AttributeDef) validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("attribute name is empty: %w", ErrInvalidAttribute)
+	}
+	switch d.Type {
+	case AttrString, AttrInt, AttrDate, AttrBool:
+	case AttrEnum:
+		if len(d.Values) == 0 {
+			return fmt.Errorf("%s: enum without values: %w", d.Name, ErrInvalidAttribute)
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %q: %w", d.Name, d.Type, ErrInvalidAttribute)
+	}
+	return nil
+}
+
+// Normalize checks value against the definition and returns its stored
+// form: integers in decimal, dates as YYYY-MM-DD, booleans as "true" or
+// "false" and enum values as spelled in Values. The empty string is always
+// valid and means no value.
+func (d AttributeDef) Normalize(value string) (string, error) {
+	v := strings.TrimSpace(value)
+	if v == "" {
+		return "", nil
+	}
+	invalid := func() (string, error) {
+		return "", fmt.Errorf("%s: %q is not a valid %s: %w", d.Name, value, d.Type, ErrInvalidAttribute)
+	}
+	switch d.Type {
+	case AttrString:
+		return value, nil
+	case AttrInt:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return invalid()
+		}
+		return strconv.Itoa(n), nil
+	case AttrEnum:
+		for _, allowed := range d.Values {
+			if strings.EqualFold(allowed, v) {
+				return allowed, nil
+			}
+		}
+		return invalid()
+	case AttrDate:
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			// Spreadsheets often hand dates back as RFC 3339 timestamps.
+			if t, err = time.Parse(time.RFC3339, v); err != nil {
+				return invalid()
+			}
+		}
+		return t.Format(dateLayout), nil
+	case AttrBool:
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			return "true", nil
+		case "false", "0", "no":
+			return "false", nil
+		}
+		return invalid()
+	}
+	return invalid()
+}
+
+// Parse returns the typed value of a stored attribute: string, int,
+// time.Time or bool. It returns nil for the empty string.
+func (d AttributeDef) Parse(value string) (any, error) {
+	v, err := d.Normalize(value)
+	if err != nil || v == "" {
+		return nil, err
+	}
+	switch d.Type {
+	case AttrInt:
+		return strconv.Atoi(v)
+	case AttrDate:
+		return time.Parse(dateLayout, v)
+	case AttrBool:
+		return v == "true", nil
+	}
+	return v, nil
+}
+
+// attributeDef returns the project's definition of the named attribute.
+func (prj *ProjectType) attributeDef(name string) (AttributeDef, bool) {
+	return findAttributeDef(prj.D.AttributeSchema, name)
+}
+
+func findAttributeDef(schema []AttributeDef, name string) (AttributeDef, bool) {
+	for _, d := range schema {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return AttributeDef{}, false
+}
+
+// DefineAttribute adds d to the project's attribute schema, or replaces the
+// definition with the same name, and persists the project. Existing values
+// must fit the new definition.
+func (prj *ProjectType) DefineAttribute(d AttributeDef) error {
+	d.Name = strings.TrimSpace(d.Name)
+	if err := d.validate(); err != nil {
+		return err
+	}
+	schema := slices.Clone(prj.D.AttributeSchema)
+	if i := slices.IndexFunc(schema, func(ex AttributeDef) bool { return ex.Name == d.Name }); i >= 0 {
+		schema[i] = d
+	} else {
+		schema = append(schema, d)
+	}
+	for _, r := range prj.D.Requirements {
+		if err := validateAttributes(schema, r.Attributes); err != nil {
+			return fmt.Errorf("requirement %d: %w", r.ID, err)
+		}
+	}
+	prj.D.AttributeSchema = schema
+	return prj.Save()
+}
+
+// RemoveAttribute drops the named attribute from the schema and its values
+// from every requirement, and persists the project.
+func (prj *ProjectType) RemoveAttribute(name string) error {
+	i := slices.IndexFunc(prj.D.AttributeSchema, func(d AttributeDef) bool { return d.Name == name })
+	if i < 0 {
+		return fmt.Errorf("%s: %w", name, ErrUnknownAttribute)
+	}
+	prj.D.AttributeSchema = slices.Delete(prj.D.AttributeSchema, i, i+1)
+	for j := range prj.D.Requirements {
+		r := &prj.D.Requirements[j]
+		if _, ok := r.Attributes[name]; ok {
+			before := r.snapshot()
+			delete(r.Attributes, name)
+			r.recordSince(before, prj.user(), "attribute "+name+" removed")
+		}
+	}
+	return prj.Save()
+}
+
+// SetAttribute validates value against the schema, stores it on the
+// requirement in its normalized form and persists the project. An empty
+// value clears the attribute.
+func (prj *ProjectType) SetAttribute(id int, name, value string) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	d, ok := prj.attributeDef(name)
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrUnknownAttribute)
+	}
+	v, err := d.Normalize(value)
+	if err != nil {
+		return err
+	}
+	before := r.snapshot()
+	if v == "" {
+		delete(r.Attributes, name)
+	} else {
+		if r.Attributes == nil {
+			r.Attributes = map[string]string{}
+		}
+		r.Attributes[name] = v
+	}
+	r.recordSince(before, prj.user(), "attribute "+name)
+	return prj.Save()
+}
+
+// Attribute returns the typed value of the named attribute on the
+// requirement, or nil when it has none.
+func (prj *ProjectType) Attribute(id int, name string) (any, error) {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := prj.attributeDef(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownAttribute)
+	}
+	return d.Parse(r.Attributes[name])
+}
+
+// validateAttributes checks every value against the schema.
+func validateAttributes(schema []AttributeDef, attrs map[string]string) error {
+	var errs []error
+	for _, name := range sortedKeys(attrs) {
+		d, ok := findAttributeDef(schema, name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", name, ErrUnknownAttribute))
+			continue
+		}
+		if _, err := d.Normalize(attrs[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ensureAttributes validates and normalizes the attributes of every
+// requirement. Empty values are dropped.
+func (prj *ProjectType) ensureAttributes() error {
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		if err := validateAttributes(prj.D.AttributeSchema, r.Attributes); err != nil {
+			return fmt.Errorf("requirement %d: %w", r.ID, err)
+		}
+		for name, value := range r.Attributes {
+			d, _ := prj.attributeDef(name)
+			if r.Attributes[name], _ = d.Normalize(value); r.Attributes[name] == "" {
+				delete(r.Attributes, name)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchAttribute reports whether the requirement's attribute equals value
+// after both are normalized.
+func (prj *ProjectType) MatchAttribute(r Requirement, name, value string) (bool, error) {
+	d, ok := prj.attributeDef(name)
+	if !ok {
+		return false, fmt.Errorf("%s: %w", name, ErrUnknownAttribute)
+	}
+	want, err := d.Normalize(value)
+	if err != nil {
+		return false, err
+	}
+	have, _ := d.Normalize(r.Attributes[name])
+	return have == want, nil
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAttributeNormalize(t *testing.T) {
+	cases := []struct {
+		def  AttributeDef
+		in   string
+		want string
+		ok   bool
+	}{
+		{AttributeDef{Name: "n", Type: AttrInt}, " 042", "42", true},
+		{AttributeDef{Name: "n", Type: AttrInt}, "4.2", "", false},
+		{AttributeDef{Name: "e", Type: AttrEnum, Values: []string{"QM", "ASIL-D"}}, "asil-d", "ASIL-D", true},
+		{AttributeDef{Name: "e", Type: AttrEnum, Values: []string{"QM"}}, "B", "", false},
+		{AttributeDef{Name: "d", Type: AttrDate}, "2025-03-01T00:00:00Z", "2025-03-01", true},
+		{AttributeDef{Name: "d", Type: AttrDate}, "01/03/2025", "", false},
+		{AttributeDef{Name: "b", Type: AttrBool}, "Yes", "true", true},
+		{AttributeDef{Name: "s", Type: AttrString}, "", "", true},
+	}
+	for _, c := range cases {
+		got, err := c.def.Normalize(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("%s.Normalize(%q) = %q, %v", c.def.Type, c.in, got, err)
+		}
+		if !c.ok && !errors.Is(err, ErrInvalidAttribute) {
+			t.Errorf("%s.Normalize(%q): expected ErrInvalidAttribute, got %v", c.def.Type, c.in, err)
+		}
+	}
+}
+
+func TestRequirementAttributes(t *testing.T) {
+	prj := newRelationsProject(t)
+	if err := prj.DefineAttribute(AttributeDef{Name: "ASIL", Type: AttrEnum}); !errors.Is(err, ErrInvalidAttribute) {
+		t.Fatalf("expected enum without values to be rejected, got %v", err)
+	}
+	for _, d := range []AttributeDef{
+		{Name: "ASIL", Type: AttrEnum, Values: []string{"QM", "A", "B", "C", "D"}},
+		{Name: "Due", Type: AttrDate},
+		{Name: "Cost", Type: AttrInt},
+	} {
+		if err := prj.DefineAttribute(d); err != nil {
+			t.Fatalf("DefineAttribute(%s): %v", d.Name, err)
+		}
+	}
+	if err := prj.SetAttribute(1, "ASIL", "d"); err != nil {
+		t.Fatalf("SetAttribute: %v", err)
+	}
+	if err := prj.SetAttribute(1, "Due", "2025-06-30"); err != nil {
+		t.Fatalf("SetAttribute: %v", err)
+	}
+	if err := prj.SetAttribute(2, "Cost", "lots"); !errors.Is(err, ErrInvalidAttribute) {
+		t.Fatalf("expected ErrInvalidAttribute, got %v", err)
+	}
+	if err := prj.SetAttribute(2, "Owner", "x"); !errors.Is(err, ErrUnknownAttribute) {
+		t.Fatalf("expected ErrUnknownAttribute, got %v", err)
+	}
+	if v, err := prj.Attribute(1, "Due"); err != nil || !v.(time.Time).Equal(time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Attribute = %v, %v", v, err)
+	}
+	if ok, _ := prj.MatchAttribute(prj.D.Requirements[0], "ASIL", "D"); !ok {
+		t.Fatalf("MatchAttribute did not match: %#v", prj.D.Requirements[0].Attributes)
+	}
+
+	// Writes are validated on save as well.
+	prj.D.Requirements[1].Attributes = map[string]string{"Cost": "cheap"}
+	if err := prj.Save(); !errors.Is(err, ErrInvalidAttribute) {
+		t.Fatalf("expected Save to reject the value, got %v", err)
+	}
+	prj.D.Requirements[1].Attributes = map[string]string{"Cost": " 12"}
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := prj.D.Requirements[1].Attributes["Cost"]; got != "12" {
+		t.Fatalf("value not normalized: %q", got)
+	}
+	if err := prj.DefineAttribute(AttributeDef{Name: "ASIL", Type: AttrEnum, Values: []string{"QM"}}); !errors.Is(err, ErrInvalidAttribute) {
+		t.Fatalf("expected redefinition to be checked against existing values, got %v", err)
+	}
+
+	// Attributes round-trip through Excel as extra columns.
+	path := filepath.Join(t.TempDir(), "attrs.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	pd, err := ImportProjectExcel(path)
+	if err != nil {
+		t.Fatalf("ImportProjectExcel: %v", err)
+	}
+	if len(pd.AttributeSchema) != 3 || pd.Requirements[0].Attributes["ASIL"] != "D" || pd.Requirements[1].Attributes["Cost"] != "12" {
+		t.Fatalf("attributes not imported: %#v %#v", pd.AttributeSchema, pd.Requirements)
+	}
+
+	if err := prj.RemoveAttribute("ASIL"); err != nil {
+		t.Fatalf("RemoveAttribute: %v", err)
+	}
+	if _, ok := prj.D.Requirements[0].Attributes["ASIL"]; ok {
+		t.Fatalf("value kept after RemoveAttribute: %#v", prj.D.Requirements[0].Attributes)
+	}
+	// The workbook still carries the definition, so importing restores it.
+	if err := prj.ImportExcel(path, false); err != nil {
+		t.Fatalf("ImportExcel: %v", err)
+	}
+	if prj.D.Requirements[0].Attributes["ASIL"] != "D" {
+		t.Fatalf("attribute not merged: %#v", prj.D.Requirements[0].Attributes)
+	}
+}
@@ -0,0 +1,158 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrBaselineExists is returned when creating a baseline whose name is
+	// already taken. Baselines are never overwritten.
+	ErrBaselineExists = errors.New("baseline already exists")
+	// ErrBaselineNotFound is returned when a named baseline does not exist.
+	ErrBaselineNotFound = errors.New("baseline not found")
+)
+
+// Baseline is an immutable snapshot of a project's data, typically taken when
+// a customer signs off on a requirement set. Baselines are stored next to
+// project.toml under baselines/<name>.toml.
+type Baseline struct {
+	Name      string      `json:"name"`
+	CreatedAt time.Time   `json:"created_at"`
+	CreatedBy string      `json:"created_by"`
+	Revision  int         `json:"revision"` // project revision the snapshot was taken from
+	D         ProjectData `json:"projectdata"`
+}
+
+// CreateBaseline freezes the project's current in-memory data under name.
+// Names may contain letters, digits, '.', '_' and '-'. Requirements are given
+// keys first so later diffs can follow them across renumbering.
+func (prj *ProjectType) CreateBaseline(name string) (*Baseline, error) {
+	prj.ensureRequirementKeys()
+	bl := &Baseline{
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: prj.user(),
+		Revision:  prj.Revision,
+		D:         prj.D,
+	}
+	if err := prj.store().SaveBaseline(prj.ProductID, prj.ID, bl); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s: %w", name, ErrBaselineExists)
+		}
+		return nil, fmt.Errorf("save baseline %s: %w", name, err)
+	}
+	// Hand out the stored copy so the caller cannot alias project data.
+	return prj.Baseline(name)
+}
+
+// Baseline loads the named baseline of the project.
+func (prj *ProjectType) Baseline(name string) (*Baseline, error) {
+	bl, err := prj.store().LoadBaseline(prj.ProductID, prj.ID, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", name, ErrBaselineNotFound)
+		}
+		return nil, fmt.Errorf("read baseline %s: %w", name, err)
+	}
+	return bl, nil
+}
+
+// BaselineNames lists the project's baselines in ascending order.
+func (prj *ProjectType) BaselineNames() ([]string, error) {
+	return prj.store().BaselineNames(prj.ProductID, prj.ID)
+}
+
+// RequirementDiff lists the fields of a requirement that differ between two
+// baselines.
+type RequirementDiff struct {
+	Key    string        `json:"key"`
+	ID     int           `json:"id"` // ID in the newer baseline
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// BaselineDiff reports the requirements added, removed or modified between
+// two baselines. Requirements are matched by key.
+type BaselineDiff struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Added    []Requirement     `json:"added"`
+	Removed  []Requirement     `json:"removed"`
+	Modified []RequirementDiff `json:"modified"`
+}
+
+// Empty reports whether the two baselines hold the same requirements.
+func (d *BaselineDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffBaselines compares baseline a with baseline b. An empty name stands for
+// the project's current in-memory data, so DiffBaselines("signed-off", "")
+// shows what changed since sign-off.
+func (prj *ProjectType) DiffBaselines(a, b string) (*BaselineDiff, error) {
+	from, err := prj.baselineData(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := prj.baselineData(b)
+	if err != nil {
+		return nil, err
+	}
+	d := diffRequirements(from, to)
+	d.From, d.To = a, b
+	return d, nil
+}
+
+// baselineData returns the requirements of the named baseline, or of the
+// project itself when name is empty.
+func (prj *ProjectType) baselineData(name string) ([]Requirement, error) {
+	if name == "" {
+		prj.ensureRequirementKeys()
+		return prj.D.Requirements, nil
+	}
+	bl, err := prj.Baseline(name)
+	if err != nil {
+		return nil, err
+	}
+	return bl.D.Requirements, nil
+}
+
+// diffRequirements compares two requirement sets by key. Requirements
+// without a key, which only occur in hand-built data, are matched by ID.
+func diffRequirements(from, to []Requirement) *BaselineDiff {
+	d := &BaselineDiff{Added: []Requirement{}, Removed: []Requirement{}, Modified: []RequirementDiff{}}
+	match := func(r *Requirement) string {
+		if r.Key != "" {
+			return r.Key
+		}
+		return "#" + strconv.Itoa(r.ID)
+	}
+	old := make(map[string]*Requirement, len(from))
+	for i := range from {
+		old[match(&from[i])] = &from[i]
+	}
+	seen := make(map[string]bool, len(to))
+	for i := range to {
+		r := &to[i]
+		k := match(r)
+		seen[k] = true
+		prev, ok := old[k]
+		if !ok {
+			d.Added = append(d.Added, *r)
+			continue
+		}
+		if fields := diffSnapshots(prev.snapshot(), r.snapshot()); len(fields) > 0 {
+			d.Modified = append(d.Modified, RequirementDiff{Key: r.Key, ID: r.ID, Name: r.Name, Fields: fields})
+		}
+	}
+	for i := range from {
+		if !seen[match(&from[i])] {
+			d.Removed = append(d.Removed, from[i])
+		}
+	}
+	return d
+}
@@ -0,0 +1,83 @@
+package PMFS
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBaselineDiff(t *testing.T) {
+	for name, newStore := range storeCases(t) {
+		t.Run(name, func(t *testing.T) {
+			db, err := Open(newStore())
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			db.User = "alice"
+			if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+				t.Fatalf("NewProduct: %v", err)
+			}
+			if _, err := db.Products[0].NewProject(ProjectData{Name: "prj"}); err != nil {
+				t.Fatalf("NewProject: %v", err)
+			}
+			prj, err := db.Products[0].Project(1)
+			if err != nil {
+				t.Fatalf("Project: %v", err)
+			}
+			prj.D.Requirements = []Requirement{{Name: "R1", Description: "a"}, {Name: "R2"}}
+			prj.ensureRequirementIDs()
+			if err := prj.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			bl, err := prj.CreateBaseline("signed-off")
+			if err != nil {
+				t.Fatalf("CreateBaseline: %v", err)
+			}
+			if bl.CreatedBy != "alice" || len(bl.D.Requirements) != 2 {
+				t.Fatalf("unexpected baseline: %#v", bl)
+			}
+			if _, err := prj.CreateBaseline("signed-off"); !errors.Is(err, ErrBaselineExists) {
+				t.Fatalf("expected ErrBaselineExists, got %v", err)
+			}
+			if _, err := prj.CreateBaseline("../escape"); err == nil {
+				t.Fatalf("invalid name accepted")
+			}
+
+			prj.D.Requirements[0].Description = "b"
+			prj.D.Requirements = append(prj.D.Requirements[:1], Requirement{Name: "R3"})
+			prj.ensureRequirementIDs()
+			if _, err := prj.CreateBaseline("v2"); err != nil {
+				t.Fatalf("CreateBaseline: %v", err)
+			}
+
+			d, err := prj.DiffBaselines("signed-off", "v2")
+			if err != nil {
+				t.Fatalf("DiffBaselines: %v", err)
+			}
+			if len(d.Added) != 1 || d.Added[0].Name != "R3" {
+				t.Fatalf("added = %#v", d.Added)
+			}
+			if len(d.Removed) != 1 || d.Removed[0].Name != "R2" {
+				t.Fatalf("removed = %#v", d.Removed)
+			}
+			if len(d.Modified) != 1 || d.Modified[0].Key != "PRD1-PRJ1-REQ-0001" {
+				t.Fatalf("modified = %#v", d.Modified)
+			}
+			if f := d.Modified[0].Fields; len(f) != 1 || f[0] != (FieldChange{Field: "description", Before: "a", After: "b"}) {
+				t.Fatalf("fields = %#v", f)
+			}
+
+			// The current project equals the latest baseline.
+			if d, err := prj.DiffBaselines("v2", ""); err != nil || !d.Empty() {
+				t.Fatalf("expected no changes since v2: %#v %v", d, err)
+			}
+			names, err := prj.BaselineNames()
+			if err != nil || len(names) != 2 || names[0] != "signed-off" || names[1] != "v2" {
+				t.Fatalf("BaselineNames = %v, %v", names, err)
+			}
+			if _, err := prj.Baseline("missing"); !errors.Is(err, ErrBaselineNotFound) {
+				t.Fatalf("expected ErrBaselineNotFound, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
+)
+
+var (
+	// ErrUnknownCategory is returned when a category is not in the project's
+	// catalog while FixedCategories is set, or when a catalog entry is missing.
+	ErrUnknownCategory = errors.New("unknown category")
+	// ErrCategoryExists is returned when adding a category name twice.
+	ErrCategoryExists = errors.New("category already exists")
+	// ErrCategoryInUse is returned when removing a category that requirements
+	// or subcategories still use.
+	ErrCategoryInUse = errors.New("category in use")
+)
+
+// Category is an entry of a project's requirement category catalog. Names
+// are unique within the project; Parent names the enclosing category, empty
+// at the top level.
+type Category struct {
+	Name        string `json:"name" toml:"name"`
+	Parent      string `json:"parent,omitempty" toml:"parent"`
+	Description string `json:"description,omitempty" toml:"description"`
+}
+
+// category returns the catalog entry with the given name.
+func (prj *ProjectType) category(name string) (*Category, bool) {
+	for i := range prj.D.RequirementCategories {
+		if prj.D.RequirementCategories[i].Name == name {
+			return &prj.D.RequirementCategories[i], true
+		}
+	}
+	return nil, false
+}
+
+// Categories returns the project's category catalog in the order added.
+func (prj *ProjectType) Categories() []Category {
+	return append([]Category{}, prj.D.RequirementCategories...)
+}
+
+// AddCategory adds c to the catalog and persists the project. Its parent must
+// already be in the catalog.
+func (prj *ProjectType) AddCategory(c Category) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return errors.New("category name is empty")
+	}
+	if _, ok := prj.category(c.Name); ok {
+		return fmt.Errorf("%s: %w", c.Name, ErrCategoryExists)
+	}
+	if _, ok := prj.category(c.Parent); c.Parent != "" && !ok {
+		return fmt.Errorf("parent %s: %w", c.Parent, ErrUnknownCategory)
+	}
+	prj.D.RequirementCategories = append(prj.D.RequirementCategories, c)
+	return prj.Save()
+}
+
+// RemoveCategory removes the named category from the catalog and persists the
+// project. Categories with subcategories or requirements cannot be removed.
+func (prj *ProjectType) RemoveCategory(name string) error {
+	if _, ok := prj.category(name); !ok {
+		return fmt.Errorf("%s: %w", name, ErrUnknownCategory)
+	}
+	for _, c := range prj.D.RequirementCategories {
+		if c.Parent == name {
+			return fmt.Errorf("%s: subcategory %s: %w", name, c.Name, ErrCategoryInUse)
+		}
+	}
+	for _, r := range prj.D.Requirements {
+		if r.Category == name && !r.Condition.Deleted {
+			return fmt.Errorf("%s: requirement %d: %w", name, r.ID, ErrCategoryInUse)
+		}
+	}
+	out := prj.D.RequirementCategories[:0]
+	for _, c := range prj.D.RequirementCategories {
+		if c.Name != name {
+			out = append(out, c)
+		}
+	}
+	prj.D.RequirementCategories = out
+	return prj.Save()
+}
+
+// CategoryPath returns the names from the top-level category down to name.
+func (prj *ProjectType) CategoryPath(name string) ([]string, error) {
+	var path []string
+	seen := map[string]bool{}
+	for n := name; n != "" && !seen[n]; {
+		seen[n] = true
+		c, ok := prj.category(n)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", n, ErrUnknownCategory)
+		}
+		path = append([]string{c.Name}, path...)
+		n = c.Parent
+	}
+	return path, nil
+}
+
+// CheckCategory reports ErrUnknownCategory when FixedCategories is set and
+// name is neither empty nor in the catalog.
+func (prj *ProjectType) CheckCategory(name string) error {
+	if !prj.D.FixedCategories || name == "" {
+		return nil
+	}
+	if _, ok := prj.category(name); !ok {
+		return fmt.Errorf("%q: %w", name, ErrUnknownCategory)
+	}
+	return nil
+}
+
+// ClassifyRequirements asks the project's LLM to pick a catalog category for
+// every uncategorized, AI-generated requirement that is not deleted and
+// persists the project. Answers outside the catalog are ignored. It returns
+// the number of requirements classified.
+func (prj *ProjectType) ClassifyRequirements() (int, error) {
+	if len(prj.D.RequirementCategories) == 0 {
+		return 0, nil
+	}
+	c := prj.llm()
+	n := 0
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		if r.Category != "" || !r.Condition.AIgenerated || r.Condition.Deleted {
+			continue
+		}
+		name, err := prj.classify(c, r)
+		if err != nil {
+			return n, err
+		}
+		if name == "" {
+			continue
+		}
+		before := r.snapshot()
+		r.Category = name
+		r.recordSince(before, ActorAI, "classified")
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, prj.Save()
+}
+
+// classify returns the catalog category the client picks for r, or "" when
+// its answer names none.
+func (prj *ProjectType) classify(c llm.Client, r *Requirement) (string, error) {
+	var b strings.Builder
+	for _, cat := range prj.D.RequirementCategories {
+		fmt.Fprintf(&b, "- %s", cat.Name)
+		if cat.Description != "" {
+			fmt.Fprintf(&b, ": %s", cat.Description)
+		}
+		b.WriteString("\n")
+	}
+	prompt := fmt.Sprintf("Classify the requirement %q into exactly one of these categories:\n%sAnswer with the category name only.", r.Name+": "+r.Description, b.String())
+	resp, err := c.Ask(prompt)
+	if err != nil {
+		return "", err
+	}
+	answer := strings.Trim(strings.TrimSpace(resp), "\"'.`")
+	for _, cat := range prj.D.RequirementCategories {
+		if strings.EqualFold(cat.Name, answer) {
+			return cat.Name, nil
+		}
+	}
+	return "", nil
+}
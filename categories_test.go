@@ -0,0 +1,84 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestCategoryCatalog(t *testing.T) {
+	_, prj, _ := newKeysDB(t)
+	for _, c := range []Category{{Name: "System"}, {Name: "Safety", Parent: "System"}} {
+		if err := prj.AddCategory(c); err != nil {
+			t.Fatalf("AddCategory(%s): %v", c.Name, err)
+		}
+	}
+	if err := prj.AddCategory(Category{Name: "Safety"}); !errors.Is(err, ErrCategoryExists) {
+		t.Fatalf("expected ErrCategoryExists, got %v", err)
+	}
+	if err := prj.AddCategory(Category{Name: "UI", Parent: "Frontend"}); !errors.Is(err, ErrUnknownCategory) {
+		t.Fatalf("expected ErrUnknownCategory, got %v", err)
+	}
+	if path, err := prj.CategoryPath("Safety"); err != nil || !slices.Equal(path, []string{"System", "Safety"}) {
+		t.Fatalf("CategoryPath = %v, %v", path, err)
+	}
+	if err := prj.RemoveCategory("System"); !errors.Is(err, ErrCategoryInUse) {
+		t.Fatalf("expected ErrCategoryInUse, got %v", err)
+	}
+
+	// Free categories are accepted until the catalog is fixed.
+	if err := prj.AddRequirement(Requirement{Name: "R1", Category: "Misc"}); err != nil {
+		t.Fatalf("AddRequirement: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "prj.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	prj.D.FixedCategories = true
+	if err := prj.AddRequirement(Requirement{Name: "R2", Category: "Misc"}); !errors.Is(err, ErrUnknownCategory) {
+		t.Fatalf("expected ErrUnknownCategory, got %v", err)
+	}
+	if err := prj.AddRequirement(Requirement{Name: "R2", Category: "Safety"}); err != nil {
+		t.Fatalf("AddRequirement: %v", err)
+	}
+	if err := prj.ImportExcel(path, true); !errors.Is(err, ErrUnknownCategory) {
+		t.Fatalf("expected ImportExcel to reject unknown categories, got %v", err)
+	}
+	if len(prj.D.Requirements) != 2 {
+		t.Fatalf("rejected import changed requirements: %#v", prj.D.Requirements)
+	}
+}
+
+func TestClassifyRequirements(t *testing.T) {
+	db, prj, _ := newKeysDB(t)
+	db.LLM = gemini.ClientFunc{AskFunc: func(prompt string) (string, error) {
+		if !strings.Contains(prompt, "- Safety: hazards\n") {
+			return "", errors.New("catalog missing from prompt")
+		}
+		if strings.Contains(prompt, "stop") {
+			return " \"safety\"\n", nil
+		}
+		return "Unsure", nil
+	}}
+	prj.D.RequirementCategories = []Category{{Name: "Performance"}, {Name: "Safety", Description: "hazards"}}
+	prj.D.Requirements = []Requirement{
+		{ID: 1, Description: "emergency stop", Condition: ConditionType{AIgenerated: true}},
+		{ID: 2, Description: "stop quickly"},
+		{ID: 3, Description: "something", Condition: ConditionType{AIgenerated: true}},
+	}
+	n, err := prj.ClassifyRequirements()
+	if err != nil || n != 1 {
+		t.Fatalf("ClassifyRequirements = %d, %v", n, err)
+	}
+	r := prj.D.Requirements
+	if r[0].Category != "Safety" || r[1].Category != "" || r[2].Category != "" {
+		t.Fatalf("unexpected categories: %#v", r)
+	}
+	if ch := lastChange(t, &r[0]); ch.User != ActorAI {
+		t.Fatalf("classification not recorded as AI: %#v", ch)
+	}
+}
@@ -0,0 +1,216 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrCommentNotFound is returned for comment IDs missing from the project.
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrUnresolvedComments is returned by the "comments-resolved" workflow
+	// guard while a requirement has open review threads.
+	ErrUnresolvedComments = errors.New("unresolved comments")
+)
+
+// Comment is a review comment on a requirement. Comments with a ParentID are
+// replies; a thread is the root comment and its replies, and is resolved or
+// reopened as a whole through its root.
+type Comment struct {
+	ID            int       `json:"id" toml:"id"`
+	RequirementID int       `json:"requirement_id" toml:"requirement_id"`
+	ParentID      int       `json:"parent_id,omitempty" toml:"parent_id"` // 0 for thread roots
+	Author        string    `json:"author" toml:"author"`
+	Text          string    `json:"text" toml:"text"`
+	Mentions      []string  `json:"mentions,omitempty" toml:"mentions"` // users named with @user
+	CreatedAt     time.Time `json:"created_at" toml:"created_at"`
+	Resolved      bool      `json:"resolved" toml:"resolved"`
+	ResolvedBy    string    `json:"resolved_by,omitempty" toml:"resolved_by"`
+	ResolvedAt    time.Time `json:"resolved_at,omitempty" toml:"resolved_at"`
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w][\w.-]*)`)
+
+// parseMentions returns the users named with @user in text, in order of
+// first appearance.
+func parseMentions(text string) []string {
+	var out []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[1], ".-")
+		if name != "" && !slices.Contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func init() {
+	RegisterGuard("comments-resolved", func(prj *ProjectType, r *Requirement) error {
+		if n := len(prj.UnresolvedComments(r.ID)); n > 0 {
+			return fmt.Errorf("%d open: %w", n, ErrUnresolvedComments)
+		}
+		return nil
+	})
+}
+
+// comment returns the comment with the given ID.
+func (prj *ProjectType) comment(id int) (*Comment, error) {
+	for i := range prj.D.Comments {
+		if prj.D.Comments[i].ID == id {
+			return &prj.D.Comments[i], nil
+		}
+	}
+	return nil, fmt.Errorf("comment %d: %w", id, ErrCommentNotFound)
+}
+
+// nextCommentID returns the next comment ID and advances the project's
+// counter, raising it past existing IDs for projects edited by hand.
+func (prj *ProjectType) nextCommentID() int {
+	id := max(prj.D.NextCommentID, 1)
+	for _, c := range prj.D.Comments {
+		id = max(id, c.ID+1)
+	}
+	prj.D.NextCommentID = id + 1
+	return id
+}
+
+// AddComment starts a review thread on the requirement and persists the
+// project. An empty author records the database user.
+func (prj *ProjectType) AddComment(requirementID int, author, text string) (*Comment, error) {
+	if _, err := prj.RequirementByID(requirementID); err != nil {
+		return nil, err
+	}
+	return prj.addComment(Comment{RequirementID: requirementID, Author: author, Text: text})
+}
+
+// Reply answers the thread containing the given comment and persists the
+// project. An empty author records the database user.
+func (prj *ProjectType) Reply(commentID int, author, text string) (*Comment, error) {
+	root, err := prj.threadRoot(commentID)
+	if err != nil {
+		return nil, err
+	}
+	return prj.addComment(Comment{RequirementID: root.RequirementID, ParentID: root.ID, Author: author, Text: text})
+}
+
+func (prj *ProjectType) addComment(c Comment) (*Comment, error) {
+	if strings.TrimSpace(c.Text) == "" {
+		return nil, fmt.Errorf("comment text is empty")
+	}
+	c.ID = prj.nextCommentID()
+	if c.Author == "" {
+		c.Author = prj.user()
+	}
+	c.Mentions = parseMentions(c.Text)
+	c.CreatedAt = time.Now().UTC()
+	prj.D.Comments = append(prj.D.Comments, c)
+	if err := prj.Save(); err != nil {
+		return nil, err
+	}
+	return &prj.D.Comments[len(prj.D.Comments)-1], nil
+}
+
+// threadRoot returns the root comment of the thread containing id.
+func (prj *ProjectType) threadRoot(id int) (*Comment, error) {
+	c, err := prj.comment(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.ParentID == 0 {
+		return c, nil
+	}
+	return prj.comment(c.ParentID)
+}
+
+// ResolveComment marks the thread containing the comment as resolved by the
+// given user, or the database user when empty, and persists the project.
+func (prj *ProjectType) ResolveComment(id int, by string) error {
+	if by == "" {
+		by = prj.user()
+	}
+	return prj.setResolved(id, by)
+}
+
+// ReopenComment marks the thread containing the comment as unresolved again
+// and persists the project.
+func (prj *ProjectType) ReopenComment(id int) error {
+	return prj.setResolved(id, "")
+}
+
+// setResolved resolves the thread containing id by the given user, or
+// reopens it when by is empty.
+func (prj *ProjectType) setResolved(id int, by string) error {
+	root, err := prj.threadRoot(id)
+	if err != nil {
+		return err
+	}
+	root.Resolved, root.ResolvedBy, root.ResolvedAt = by != "", by, time.Time{}
+	if root.Resolved {
+		root.ResolvedAt = time.Now().UTC()
+	}
+	return prj.Save()
+}
+
+// Comments returns the comments on the requirement grouped by thread: each
+// root followed by its replies, oldest first.
+func (prj *ProjectType) Comments(requirementID int) []Comment {
+	out := []Comment{}
+	for _, root := range prj.D.Comments {
+		if root.RequirementID != requirementID || root.ParentID != 0 {
+			continue
+		}
+		out = append(out, root)
+		for _, c := range prj.D.Comments {
+			if c.ParentID == root.ID {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// UnresolvedComments returns the roots of the requirement's open threads.
+func (prj *ProjectType) UnresolvedComments(requirementID int) []Comment {
+	out := []Comment{}
+	for _, c := range prj.D.Comments {
+		if c.RequirementID == requirementID && c.ParentID == 0 && !c.Resolved {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Mentioning returns the project's comments that mention the user.
+func (prj *ProjectType) Mentioning(user string) []Comment {
+	out := []Comment{}
+	for _, c := range prj.D.Comments {
+		if slices.Contains(c.Mentions, user) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// copyCommentsTo copies the comments on requirement id to requirement newID
+// of dst, renumbering them in dst.
+func (prj *ProjectType) copyCommentsTo(id int, dst *ProjectType, newID int) {
+	ids := map[int]int{}
+	for _, c := range prj.D.Comments {
+		if c.RequirementID != id {
+			continue
+		}
+		ids[c.ID] = dst.nextCommentID()
+		c.ID, c.RequirementID, c.ParentID = ids[c.ID], newID, ids[c.ParentID]
+		c.Mentions = slices.Clone(c.Mentions)
+		dst.D.Comments = append(dst.D.Comments, c)
+	}
+}
+
+// removeCommentsOf drops every comment on the requirement.
+func (prj *ProjectType) removeCommentsOf(id int) {
+	prj.D.Comments = slices.DeleteFunc(prj.D.Comments, func(c Comment) bool { return c.RequirementID == id })
+}
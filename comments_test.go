@@ -0,0 +1,126 @@
+package PMFS
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	got := parseMentions("@alice please check with @bob.smith. Mail bob@example.com, cc @alice")
+	if !slices.Equal(got, []string{"alice", "bob.smith"}) {
+		t.Fatalf("parseMentions = %v", got)
+	}
+}
+
+func TestCommentThreads(t *testing.T) {
+	prj := newRelationsProject(t)
+	prj.database().User = "carol"
+
+	root, err := prj.AddComment(1, "", "Is 5 ms realistic, @dave?")
+	if err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	if root.Author != "carol" || !slices.Equal(root.Mentions, []string{"dave"}) {
+		t.Fatalf("unexpected comment: %#v", root)
+	}
+	rootID := root.ID
+	reply, err := prj.Reply(rootID, "dave", "Yes, measured on the bench.")
+	if err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if _, err := prj.AddComment(2, "", "Other requirement"); err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	if _, err := prj.AddComment(99, "", "x"); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected ErrRequirementNotFound, got %v", err)
+	}
+	if _, err := prj.Reply(42, "", "x"); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("expected ErrCommentNotFound, got %v", err)
+	}
+
+	thread := prj.Comments(1)
+	if len(thread) != 2 || thread[0].ID != rootID || thread[1].ParentID != rootID || thread[1].Author != "dave" {
+		t.Fatalf("unexpected thread: %#v", thread)
+	}
+	if got := prj.Mentioning("dave"); len(got) != 1 || got[0].ID != rootID {
+		t.Fatalf("Mentioning = %#v", got)
+	}
+
+	// Open threads block a guarded transition until resolved.
+	wf := DefaultWorkflow()
+	for i := range wf.Transitions {
+		if wf.Transitions[i].From == "Draft" && wf.Transitions[i].To == "Review" {
+			wf.Transitions[i].Guards = []string{"comments-resolved"}
+		}
+	}
+	if err := prj.SetWorkflow(wf); err != nil {
+		t.Fatalf("SetWorkflow: %v", err)
+	}
+	if err := prj.Transition(1, "Review"); !errors.Is(err, ErrUnresolvedComments) || !errors.Is(err, ErrGuardFailed) {
+		t.Fatalf("expected open thread to block Review, got %v", err)
+	}
+	// Resolving through a reply resolves the whole thread.
+	if err := prj.ResolveComment(reply.ID, "dave"); err != nil {
+		t.Fatalf("ResolveComment: %v", err)
+	}
+	if c := prj.Comments(1)[0]; !c.Resolved || c.ResolvedBy != "dave" || c.ResolvedAt.IsZero() {
+		t.Fatalf("thread not resolved: %#v", c)
+	}
+	if err := prj.Transition(1, "Review"); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	if err := prj.ReopenComment(rootID); err != nil {
+		t.Fatalf("ReopenComment: %v", err)
+	}
+	if open := prj.UnresolvedComments(1); len(open) != 1 || open[0].ResolvedBy != "" {
+		t.Fatalf("thread not reopened: %#v", open)
+	}
+}
+
+func TestMoveRequirementKeepsComments(t *testing.T) {
+	db, a, b := newKeysDB(t)
+	a.D.Requirements = []Requirement{{Name: "R1"}, {Name: "R2"}}
+	a.ensureRequirementIDs()
+	b.D.Requirements = []Requirement{{Name: "B1"}}
+	b.ensureRequirementIDs()
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := b.AddComment(1, "", "stays"); err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	c, err := a.AddComment(2, "", "moves")
+	if err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	if _, err := a.Reply(c.ID, "", "with its reply"); err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+
+	moved, err := db.MoveRequirement(a.D.Requirements[1].Key, 1, 2)
+	if err != nil {
+		t.Fatalf("MoveRequirement: %v", err)
+	}
+	dst, err := db.Products[0].Project(2)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	got := dst.Comments(moved.ID)
+	if len(got) != 2 || got[0].ID != 2 || got[1].ParentID != 2 || got[1].Text != "with its reply" {
+		t.Fatalf("comments not moved: %#v", got)
+	}
+	src, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	if len(src.D.Comments) != 0 {
+		t.Fatalf("comments left in source: %#v", src.D.Comments)
+	}
+
+	// The IDs of the moved comments are not handed out again.
+	c, err = src.AddComment(1, "", "new thread")
+	if err != nil || c.ID != 3 {
+		t.Fatalf("AddComment = %#v, %v", c, err)
+	}
+}
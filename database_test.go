@@ -0,0 +1,62 @@
+package PMFS
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestTwoDatabasesSideBySide(t *testing.T) {
+	dirA := filepath.Join(t.TempDir(), "a")
+	dirB := filepath.Join(t.TempDir(), "b")
+
+	dbA, err := LoadSetup(dirA)
+	if err != nil {
+		t.Fatalf("LoadSetup A: %v", err)
+	}
+	dbB, err := LoadSetup(dirB)
+	if err != nil {
+		t.Fatalf("LoadSetup B: %v", err)
+	}
+	if os.Getenv(envBaseDir) == dirB {
+		t.Fatalf("LoadSetup must not export %s", envBaseDir)
+	}
+	dbA.LLM = gemini.ClientFunc{AskFunc: func(string) (string, error) {
+		return `[{"name":"FromA","description":"a"}]`, nil
+	}}
+	dbB.LLM = gemini.ClientFunc{AskFunc: func(string) (string, error) {
+		return `[{"name":"FromB","description":"b"}]`, nil
+	}}
+
+	for _, db := range []*Database{dbA, dbB} {
+		if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+			t.Fatalf("NewProduct: %v", err)
+		}
+		if _, err := db.Products[0].NewProject(ProjectData{Name: "prj"}); err != nil {
+			t.Fatalf("NewProject: %v", err)
+		}
+	}
+
+	// dbA was opened first, so it is not the package default.
+	prjA := &dbA.Products[0].Projects[0]
+	prjA.D.Requirements = []Requirement{{ID: 1, Description: "base"}}
+	if _, err := prjA.D.Requirements[0].SuggestOthers(prjA); err != nil {
+		t.Fatalf("SuggestOthers: %v", err)
+	}
+	if len(prjA.D.Requirements) != 2 || prjA.D.Requirements[1].Name != "FromA" {
+		t.Fatalf("project A did not use its own client: %#v", prjA.D.Requirements)
+	}
+
+	if _, err := os.Stat(filepath.Join(NewFSStore(dirA).ProjectPath(1, 1), projectTOML)); err != nil {
+		t.Fatalf("project A not written to its own base dir: %v", err)
+	}
+	reloadB := &dbB.Products[0].Projects[0]
+	if err := reloadB.Load(); err != nil {
+		t.Fatalf("Load B: %v", err)
+	}
+	if len(reloadB.D.Requirements) != 0 {
+		t.Fatalf("project B picked up A's requirements: %#v", reloadB.D.Requirements)
+	}
+}
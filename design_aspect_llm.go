@@ -9,7 +9,7 @@ import (
 
 // GenerateTemplates asks the LLM for requirement templates related to this
 // design aspect. Returned templates are appended to the aspect and also
-// returned to the caller.
+// returned to the caller. The default database's LLM client is used.
 func (da *DesignAspect) GenerateTemplates(role, questionID string) ([]Requirement, error) {
 	ps, err := prompts.GetPrompts(role)
 	if err != nil {
@@ -26,7 +26,7 @@ func (da *DesignAspect) GenerateTemplates(role, questionID string) ([]Requiremen
 		return nil, fmt.Errorf("prompt %s/%s not found", role, questionID)
 	}
 	prompt := fmt.Sprintf(p.Template, da.Description)
-	resp, err := DB.LLM.Ask(prompt)
+	resp, err := defaultDB().client().Ask(prompt)
 	if err != nil {
 		return nil, err
 	}
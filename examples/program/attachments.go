@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -20,6 +21,9 @@ func copyFile(src, dst string) error {
 	return os.WriteFile(dst, b, 0o644)
 }
 
+// errAlreadyAnalyzed stops ingestAttachment from analyzing an attachment twice.
+var errAlreadyAnalyzed = errors.New("attachment already analyzed")
+
 // ingestAttachment asks for a file path, copies it into the project's input directory, ingests the file, lets the user pick one attachment for analysis and saves any newly suggested requirements.
 func ingestAttachment(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	fmt.Print("Path to attachment: ")
@@ -39,7 +43,12 @@ func ingestAttachment(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 		return
 	}
 
-	atts, err := prj.Attachments().AddFromInputFolder()
+	var atts []PMFS.Attachment
+	err := lockedProject(prj, func() error {
+		var err error
+		atts, err = prj.Attachments().AddFromInputFolder()
+		return err
+	})
 	if err != nil {
 		log.Printf("AddFromInputFolder: %v", err)
 		return
@@ -64,30 +73,32 @@ func ingestAttachment(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	}
 
 	selectedID := atts[idx-1].ID
-	var att *PMFS.Attachment
-	for i := range prj.D.Attachments {
-		if prj.D.Attachments[i].ID == selectedID {
-			att = &prj.D.Attachments[i]
-			break
+	var before int
+	err = lockedProject(prj, func() error {
+		var att *PMFS.Attachment
+		for i := range prj.D.Attachments {
+			if prj.D.Attachments[i].ID == selectedID {
+				att = &prj.D.Attachments[i]
+				break
+			}
 		}
-	}
-	if att == nil {
-		fmt.Println("Attachment not found")
-		return
-	}
-	if att.Analyzed {
+		if att == nil {
+			return errors.New("attachment not found")
+		}
+		if att.Analyzed {
+			return errAlreadyAnalyzed
+		}
+		before = len(prj.D.Requirements)
+		return att.Analyze(prj)
+	})
+	if errors.Is(err, errAlreadyAnalyzed) {
 		fmt.Println("Attachment already analyzed.")
 		return
 	}
-
-	before := len(prj.D.Requirements)
-	if err := att.Analyze(prj); err != nil {
+	if err != nil {
 		log.Printf("Analyze: %v", err)
 		return
 	}
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
-	}
 	newReqs := prj.D.Requirements[before:]
 	if len(newReqs) == 0 {
 		fmt.Println("No new requirements suggested.")
@@ -21,8 +21,8 @@ func listProducts() {
 	}
 }
 
-// createProduct asks the user for a name, creates the product and saves the DB,
-// returning the newly created product.
+// createProduct asks the user for a name and creates the product, returning
+// the newly created product.
 func createProduct(scanner *bufio.Scanner) *PMFS.ProductType {
 	fmt.Print("Product name: ")
 	if !scanner.Scan() {
@@ -34,10 +34,11 @@ func createProduct(scanner *bufio.Scanner) *PMFS.ProductType {
 		log.Printf("NewProduct: %v", err)
 		return nil
 	}
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
+	p, err := PMFS.DB.Product(id)
+	if err != nil {
+		log.Printf("Product: %v", err)
+		return nil
 	}
-	p := &PMFS.DB.Products[id-1]
 	fmt.Printf("Created product %s (ID: %d)\n", p.Name, p.ID)
 	return p
 }
@@ -86,11 +87,8 @@ func productMenu(scanner *bufio.Scanner, p *PMFS.ProductType) {
 			}
 			newName := scanner.Text()
 			if newName != "" {
-				p.Name = newName
 				if _, err := PMFS.DB.ModifyProduct(PMFS.ProductData{ID: p.ID, Name: newName}); err != nil {
 					log.Printf("ModifyProduct: %v", err)
-				} else if err := PMFS.DB.Save(); err != nil {
-					log.Printf("Save DB: %v", err)
 				}
 			}
 		case 2:
@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"strconv"
 	"time"
 
 	PMFS "github.com/rjboer/PMFS"
@@ -38,50 +36,76 @@ func selectProject(_ *bufio.Scanner, p *PMFS.ProductType) *PMFS.ProjectType {
 	return prj
 }
 
-// editProject interactively updates project fields and persists them.
+// lockedProject reloads prj under its exclusive lock and runs fn, which
+// saves the project itself. Other processes, such as the web interface,
+// cannot write the project in between.
+func lockedProject(prj *PMFS.ProjectType, fn func() error) error {
+	unlock, err := prj.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := prj.Load(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// prompt prints label with the current value and returns the entered text,
+// which is empty when the value is kept.
+func prompt(scanner *bufio.Scanner, label, current string) string {
+	fmt.Printf("%s [%s]: ", label, current)
+	if !scanner.Scan() {
+		return ""
+	}
+	return scanner.Text()
+}
+
+// parseDate parses a YYYY-MM-DD date, reporting invalid input.
+func parseDate(txt string) (time.Time, bool) {
+	if txt == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02", txt)
+	if err != nil {
+		fmt.Println("Invalid date format")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// editProject interactively updates project fields and persists them. The
+// input is read first so the project is only locked while it is written.
 func editProject(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
-	fmt.Printf("Name [%s]: ", prj.D.Name)
-	if scanner.Scan() {
-		if txt := scanner.Text(); txt != "" {
-			prj.Name = txt
-			prj.D.Name = txt
+	name := prompt(scanner, "Name", prj.D.Name)
+	scope := prompt(scanner, "Scope", prj.D.Scope)
+	priority := prompt(scanner, "Priority", prj.D.Priority)
+	start, setStart := parseDate(prompt(scanner, "Start date (YYYY-MM-DD)", prj.D.StartDate.Format("2006-01-02")))
+	end, setEnd := parseDate(prompt(scanner, "End date (YYYY-MM-DD)", prj.D.EndDate.Format("2006-01-02")))
+	err := prj.Edit(func(prj *PMFS.ProjectType) error {
+		if name != "" {
+			prj.Name = name
+			prj.D.Name = name
 		}
-	}
-	fmt.Printf("Scope [%s]: ", prj.D.Scope)
-	if scanner.Scan() {
-		if txt := scanner.Text(); txt != "" {
-			prj.D.Scope = txt
+		if scope != "" {
+			prj.D.Scope = scope
 		}
-	}
-	fmt.Printf("Priority [%s]: ", prj.D.Priority)
-	if scanner.Scan() {
-		if txt := scanner.Text(); txt != "" {
-			prj.D.Priority = txt
+		if priority != "" {
+			prj.D.Priority = priority
 		}
-	}
-	fmt.Printf("Start date [%s] (YYYY-MM-DD): ", prj.D.StartDate.Format("2006-01-02"))
-	if scanner.Scan() {
-		if txt := scanner.Text(); txt != "" {
-			if t, err := time.Parse("2006-01-02", txt); err == nil {
-				prj.D.StartDate = t
-			} else {
-				fmt.Println("Invalid date format")
-			}
+		if setStart {
+			prj.D.StartDate = start
 		}
-	}
-	fmt.Printf("End date [%s] (YYYY-MM-DD): ", prj.D.EndDate.Format("2006-01-02"))
-	if scanner.Scan() {
-		if txt := scanner.Text(); txt != "" {
-			if t, err := time.Parse("2006-01-02", txt); err == nil {
-				prj.D.EndDate = t
-			} else {
-				fmt.Println("Invalid date format")
-			}
+		if setEnd {
+			prj.D.EndDate = end
 		}
-	}
-	if err := prj.Save(); err != nil {
+		return nil
+	})
+	if err != nil {
 		log.Printf("Save project: %v", err)
+		return
 	}
+	// The project name is listed in the index too.
 	if err := PMFS.DB.Save(); err != nil {
 		log.Printf("Save DB: %v", err)
 	}
@@ -125,9 +149,6 @@ func projectOpsMenu(scanner *bufio.Scanner, p *PMFS.ProductType) {
 				log.Printf("NewProject: %v", err)
 				continue
 			}
-			if err := PMFS.DB.Save(); err != nil {
-				log.Printf("Save DB: %v", err)
-			}
 			prj, err := p.Project(id)
 			if err != nil {
 				log.Printf("Load project: %v", err)
@@ -142,19 +163,8 @@ func projectOpsMenu(scanner *bufio.Scanner, p *PMFS.ProductType) {
 		case 3:
 			prj := selectProject(scanner, p)
 			if prj != nil {
-				prjDir := filepath.Join(PMFS.DB.BaseDir, "products", strconv.Itoa(p.ID), "projects", strconv.Itoa(prj.ID))
-				if err := os.RemoveAll(prjDir); err != nil {
+				if err := p.DeleteProject(prj.ID); err != nil {
 					log.Printf("Remove project: %v", err)
-				} else {
-					for i := range p.Projects {
-						if p.Projects[i].ID == prj.ID {
-							p.Projects = append(p.Projects[:i], p.Projects[i+1:]...)
-							break
-						}
-					}
-					if err := PMFS.DB.Save(); err != nil {
-						log.Printf("Save DB: %v", err)
-					}
 				}
 			}
 		case 4:
@@ -171,7 +181,7 @@ func projectOpsMenu(scanner *bufio.Scanner, p *PMFS.ProductType) {
 	}
 }
 
-// exportExcel saves the database and writes the project overview to an Excel file at a user-specified path.
+// exportExcel writes the stored project overview to an Excel file at a user-specified path.
 func exportExcel(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	fmt.Print("Output path: ")
 	if !scanner.Scan() {
@@ -179,17 +189,17 @@ func exportExcel(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	}
 	path := scanner.Text()
 
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
-	}
-	if err := prj.ExportExcel(path); err != nil {
+	err := prj.View(func(prj *PMFS.ProjectType) error {
+		return prj.ExportExcel(path)
+	})
+	if err != nil {
 		fmt.Printf("Export failed: %v\n", err)
 		return
 	}
 	fmt.Printf("Project exported to %s\n", path)
 }
 
-// exportProjectStruct writes the full project struct to a JSON file.
+// exportProjectStruct writes the full stored project struct to a JSON file.
 func exportProjectStruct(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	fmt.Print("Output path: ")
 	if !scanner.Scan() {
@@ -197,10 +207,12 @@ func exportProjectStruct(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	}
 	path := scanner.Text()
 
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
-	}
-	data, err := json.MarshalIndent(prj, "", "  ")
+	var data []byte
+	err := prj.View(func(prj *PMFS.ProjectType) error {
+		var err error
+		data, err = json.MarshalIndent(prj, "", "  ")
+		return err
+	})
 	if err != nil {
 		fmt.Printf("Export failed: %v\n", err)
 		return
@@ -212,16 +224,8 @@ func exportProjectStruct(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	fmt.Printf("Project struct exported to %s\n", path)
 }
 
-// renumberRequirementIDs assigns sequential IDs starting at 1 to all
-// requirements in the project.
-func renumberRequirementIDs(prj *PMFS.ProjectType) {
-	for i := range prj.D.Requirements {
-		prj.D.Requirements[i].ID = i + 1
-	}
-}
-
 // importExcel loads project data from an Excel file and either replaces the
-// current requirement set or adds to it, renumbering requirements afterwards.
+// current requirement set or adds to it.
 func importExcel(scanner *bufio.Scanner, p *PMFS.ProductType, prj **PMFS.ProjectType) {
 	fmt.Print("Path to Excel file: ")
 	if !scanner.Scan() {
@@ -236,6 +240,10 @@ func importExcel(scanner *bufio.Scanner, p *PMFS.ProductType, prj **PMFS.Project
 	}
 
 	if *prj == nil {
+		// The new project issues its own keys.
+		for i := range data.Requirements {
+			data.Requirements[i].Key = ""
+		}
 		id, err := p.NewProject(*data)
 		if err != nil {
 			fmt.Printf("Create project: %v\n", err)
@@ -247,13 +255,6 @@ func importExcel(scanner *bufio.Scanner, p *PMFS.ProductType, prj **PMFS.Project
 			return
 		}
 		*prj = np
-		renumberRequirementIDs(*prj)
-		if err := (*prj).Save(); err != nil {
-			log.Printf("Save project: %v", err)
-		}
-		if err := PMFS.DB.Save(); err != nil {
-			log.Printf("Save DB: %v", err)
-		}
 		fmt.Println("Created new project from Excel data.")
 		return
 	}
@@ -269,29 +270,31 @@ func importExcel(scanner *bufio.Scanner, p *PMFS.ProductType, prj **PMFS.Project
 		return
 	}
 
-	(*prj).Name = data.Name
-	(*prj).D.Name = data.Name
-	(*prj).D.Scope = data.Scope
-	(*prj).D.StartDate = data.StartDate
-	(*prj).D.EndDate = data.EndDate
-	(*prj).D.Status = data.Status
-	(*prj).D.Priority = data.Priority
-
+	err = (*prj).Edit(func(prj *PMFS.ProjectType) error {
+		prj.Name = data.Name
+		prj.D.Name = data.Name
+		prj.D.Scope = data.Scope
+		prj.D.StartDate = data.StartDate
+		prj.D.EndDate = data.EndDate
+		prj.D.Status = data.Status
+		prj.D.Priority = data.Priority
+		if idx == 0 {
+			prj.D.Intelligence = data.Intelligence
+		} else {
+			prj.D.Intelligence = append(prj.D.Intelligence, data.Intelligence...)
+		}
+		return prj.ImportExcel(path, idx == 0)
+	})
+	if err != nil {
+		log.Printf("Import project: %v", err)
+		return
+	}
 	if idx == 0 {
-		(*prj).D.Requirements = data.Requirements
-		(*prj).D.Intelligence = data.Intelligence
 		fmt.Println("Replaced current requirements with Excel data.")
 	} else {
-		(*prj).D.Requirements = append((*prj).D.Requirements, data.Requirements...)
-		(*prj).D.Intelligence = append((*prj).D.Intelligence, data.Intelligence...)
 		fmt.Println("Added Excel requirements to current project.")
 	}
-
-	renumberRequirementIDs(*prj)
-
-	if err := (*prj).Save(); err != nil {
-		log.Printf("Save project: %v", err)
-	}
+	// The project name is listed in the index too.
 	if err := PMFS.DB.Save(); err != nil {
 		log.Printf("Save DB: %v", err)
 	}
@@ -26,12 +26,11 @@ func addRequirement(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 	desc := scanner.Text()
 
 	r := PMFS.Requirement{Name: name, Description: desc}
-	if err := prj.AddRequirement(r); err != nil {
+	err := lockedProject(prj, func() error {
+		return prj.AddRequirement(r)
+	})
+	if err != nil {
 		log.Printf("AddRequirement: %v", err)
-		return
-	}
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
 	}
 }
 
@@ -122,19 +121,28 @@ func analyseRequirement(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 		fmt.Println("Invalid selection")
 		return
 	}
-	req := &prj.D.Requirements[idx-1]
-	if !req.Condition.Active || req.Condition.Deleted {
+	if r := prj.D.Requirements[idx-1]; !r.Condition.Active || r.Condition.Deleted {
 		fmt.Println("Requirement is not active.")
 		return
 	}
-	pass, follow, err := req.QualityControlAI("product_manager", "1", []string{"clarity-form-1"})
+	id := prj.D.Requirements[idx-1].ID
+	var (
+		req    *PMFS.Requirement
+		pass   bool
+		follow string
+	)
+	err = prj.Edit(func(prj *PMFS.ProjectType) error {
+		var err error
+		if req, err = prj.RequirementByID(id); err != nil {
+			return err
+		}
+		pass, follow, err = req.QualityControlAI("product_manager", "1", []string{"clarity-form-1"})
+		return err
+	})
 	if err != nil {
 		log.Printf("QualityControlAI: %v", err)
 		return
 	}
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
-	}
 	fmt.Printf("Analysis pass: %v\n", pass)
 	if follow != "" {
 		fmt.Printf("Follow-up: %s\n", follow)
@@ -167,12 +175,20 @@ func suggestRelated(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 		fmt.Println("Invalid selection")
 		return
 	}
-	req := &prj.D.Requirements[idx-1]
-	if req.Condition.Deleted {
+	if prj.D.Requirements[idx-1].Condition.Deleted {
 		fmt.Println("Requirement is deleted.")
 		return
 	}
-	others, err := req.SuggestOthers(prj)
+	id := prj.D.Requirements[idx-1].ID
+	var others []PMFS.Requirement
+	err = lockedProject(prj, func() error {
+		req, err := prj.RequirementByID(id)
+		if err != nil {
+			return err
+		}
+		others, err = req.SuggestOthers(prj)
+		return err
+	})
 	if err != nil {
 		log.Printf("SuggestOthers: %v", err)
 		return
@@ -189,19 +205,29 @@ func suggestRelated(scanner *bufio.Scanner, prj *PMFS.ProjectType) {
 
 // generateDesignAspects runs GenerateDesignAspectsAll on the project.
 func generateDesignAspects(prj *PMFS.ProjectType) {
-	if err := prj.GenerateDesignAspectsAll(); err != nil {
+	if err := lockedProject(prj, prj.GenerateDesignAspectsAll); err != nil {
 		log.Printf("GenerateDesignAspectsAll: %v", err)
 		return
 	}
-	if err := PMFS.DB.Save(); err != nil {
-		log.Printf("Save DB: %v", err)
-	}
 	fmt.Println("Design aspects generated.")
 }
 
 // generateRequirementsFromAspects creates requirements from stored design aspects.
 func generateRequirementsFromAspects(prj *PMFS.ProjectType) {
 	added := 0
+	err := lockedProject(prj, func() error {
+		return generateFromAspects(prj, &added)
+	})
+	if err != nil {
+		log.Printf("Save project: %v", err)
+	}
+	fmt.Printf("Generated %d requirements from design aspects.\n", added)
+}
+
+// generateFromAspects adds the requirements generated from unprocessed
+// design aspects to prj, counting them in added, and saves the project when
+// any were added.
+func generateFromAspects(prj *PMFS.ProjectType, added *int) error {
 	for i := range prj.D.Requirements {
 		for j := range prj.D.Requirements[i].DesignAspects {
 			da := &prj.D.Requirements[i].DesignAspects[j]
@@ -217,24 +243,19 @@ func generateRequirementsFromAspects(prj *PMFS.ProjectType) {
 				log.Printf("EvaluateDesignGates: %v", err)
 			}
 			for k := range reqs {
-				reqs[k].ID = len(prj.D.Requirements) + 1
 				reqs[k].Condition.Proposed = true
 				reqs[k].Condition.AIgenerated = true
 				prj.D.Requirements = append(prj.D.Requirements, reqs[k])
-				added++
+				*added++
 			}
 			da.Processed = true
 		}
 	}
-	if added > 0 {
-		prj.D.Requirements = PMFS.Deduplicate(prj.D.Requirements, false)
-		if err := prj.Save(); err != nil {
-			log.Printf("Save project: %v", err)
-		} else if err := PMFS.DB.Save(); err != nil {
-			log.Printf("Save DB: %v", err)
-		}
+	if *added == 0 {
+		return nil
 	}
-	fmt.Printf("Generated %d requirements from design aspects.\n", added)
+	prj.Deduplicate(false)
+	return prj.Save()
 }
 
 // requirementsMenu manages requirement operations.
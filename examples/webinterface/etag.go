@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	PMFS "github.com/rjboer/PMFS"
+)
+
+// revisionETag formats a project revision as a strong entity tag.
+func revisionETag(rev int) string {
+	return `"` + strconv.Itoa(rev) + `"`
+}
+
+// ifMatch reports whether the request's If-Match header, if any, matches the
+// project revision. Requests without If-Match always match.
+func ifMatch(r *http.Request, rev int) bool {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		return true
+	}
+	want := revisionETag(rev)
+	for _, tag := range strings.Split(h, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch rejects PUT and DELETE requests whose If-Match header does not
+// match the project's current revision with 412 Precondition Failed.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType) bool {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		return true
+	}
+	if ifMatch(r, prj.Revision) {
+		return true
+	}
+	http.Error(w, "project revision changed", http.StatusPreconditionFailed)
+	return false
+}
+
+// etagWriter sets the ETag header from the project's revision when the
+// response starts, so it reflects any save made by the handler.
+type etagWriter struct {
+	http.ResponseWriter
+	prj   *PMFS.ProjectType
+	wrote bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		w.Header().Set("ETag", revisionETag(w.prj.Revision))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"embed"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -103,6 +106,15 @@ func respondJSON(w http.ResponseWriter, v interface{}) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// user returns the name recorded in requirement history for r: the X-User
+// request header, falling back to "web".
+func (s *server) user(r *http.Request) string {
+	if u := strings.TrimSpace(r.Header.Get("X-User")); u != "" {
+		return u
+	}
+	return "web"
+}
+
 // helper functions to locate products and projects ---------------------------------
 
 func (s *server) findProduct(id int) (*PMFS.ProductType, error) {
@@ -114,39 +126,90 @@ func (s *server) findProduct(id int) (*PMFS.ProductType, error) {
 	return nil, fmt.Errorf("product not found")
 }
 
-func (s *server) findProject(id int) (*PMFS.ProjectType, error) {
+// findProject loads the project with the given ID while holding its write
+// lock, so concurrent requests and other processes cannot interleave a
+// Load/Save cycle. The caller must hold the database read lock and release
+// the project with the returned function.
+func (s *server) findProject(id int) (*PMFS.ProjectType, func(), error) {
 	for i := range s.db.Products {
 		for j := range s.db.Products[i].Projects {
 			if s.db.Products[i].Projects[j].ID == id {
 				prd := &s.db.Products[i]
 				prj := &prd.Projects[j]
 				prj.ProductID = prd.ID
+				unlock, err := prj.Lock()
+				if err != nil {
+					return nil, nil, err
+				}
 				if err := prj.Load(); err != nil {
-					return nil, err
+					unlock()
+					return nil, nil, err
 				}
-				return prj, nil
+				return prj, unlock, nil
 			}
 		}
 	}
-	return nil, fmt.Errorf("project not found")
+	return nil, nil, fmt.Errorf("project not found")
 }
 
-func (s *server) findProjectByRequirement(rid int) (*PMFS.ProjectType, *PMFS.Requirement, error) {
+// errAmbiguousRequirement is returned when a numeric requirement ID exists in
+// more than one project; clients must use the requirement key instead.
+var errAmbiguousRequirement = errors.New("requirement id is ambiguous, use its key")
+
+// findProjectByRequirement is like findProject but locates the project that
+// holds the requirement identified by ref, either its key or its numeric ID.
+// Numeric IDs are only unique per project, so an ID present in several
+// projects yields errAmbiguousRequirement listing the matching keys.
+func (s *server) findProjectByRequirement(ref string) (*PMFS.ProjectType, *PMFS.Requirement, func(), error) {
+	match := func(r *PMFS.Requirement) bool { return r.Key == ref }
+	if id, err := strconv.Atoi(ref); err == nil {
+		match = func(r *PMFS.Requirement) bool { return r.ID == id }
+	}
+	var (
+		found []*PMFS.ProjectType
+		keys  []string
+	)
 	for i := range s.db.Products {
 		for j := range s.db.Products[i].Projects {
 			prj := &s.db.Products[i].Projects[j]
 			prj.ProductID = s.db.Products[i].ID
-			if err := prj.Load(); err != nil {
-				return nil, nil, err
-			}
-			for k := range prj.D.Requirements {
-				if prj.D.Requirements[k].ID == rid {
-					return prj, &prj.D.Requirements[k], nil
+			err := prj.View(func(p *PMFS.ProjectType) error {
+				for k := range p.D.Requirements {
+					if match(&p.D.Requirements[k]) {
+						found = append(found, prj)
+						keys = append(keys, p.D.Requirements[k].Key)
+						break
+					}
 				}
+				return nil
+			})
+			if err != nil {
+				return nil, nil, nil, err
 			}
 		}
 	}
-	return nil, nil, fmt.Errorf("requirement not found")
+	switch {
+	case len(found) == 0:
+		return nil, nil, nil, PMFS.ErrRequirementNotFound
+	case len(found) > 1:
+		return nil, nil, nil, fmt.Errorf("%w: %s", errAmbiguousRequirement, strings.Join(keys, ", "))
+	}
+	prj := found[0]
+	unlock, err := prj.Lock()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := prj.Load(); err != nil {
+		unlock()
+		return nil, nil, nil, err
+	}
+	for k := range prj.D.Requirements {
+		if match(&prj.D.Requirements[k]) {
+			return prj, &prj.D.Requirements[k], unlock, nil
+		}
+	}
+	unlock()
+	return nil, nil, nil, PMFS.ErrRequirementNotFound
 }
 
 // notifySubscribers broadcasts a change event for a project.
@@ -168,12 +231,19 @@ func (s *server) handleProducts(w http.ResponseWriter, r *http.Request) {
 	if !authorize(w, r, map[string]string{http.MethodGet: "read", http.MethodPost: "write", http.MethodPut: "write", http.MethodDelete: "delete"}[r.Method]) {
 		return
 	}
+	// Product and project-list changes rewrite index.toml; serialize them
+	// against every other request.
+	defer s.db.Lock()()
 	path := strings.TrimPrefix(r.URL.Path, "/products")
 	path = strings.Trim(path, "/")
 	if path == "" {
 		switch r.Method {
 		case http.MethodGet:
-			respondJSON(w, s.db.Products)
+			if r.URL.Query().Get("archived") == "true" {
+				respondJSON(w, s.db.Products)
+				return
+			}
+			respondJSON(w, s.db.ActiveProducts())
 		case http.MethodPost:
 			var pd PMFS.ProductData
 			if err := json.NewDecoder(r.Body).Decode(&pd); err != nil {
@@ -221,14 +291,7 @@ func (s *server) handleProducts(w http.ResponseWriter, r *http.Request) {
 			}
 			respondJSON(w, prd)
 		case http.MethodDelete:
-			// remove product
-			for i := range s.db.Products {
-				if s.db.Products[i].ID == id {
-					s.db.Products = append(s.db.Products[:i], s.db.Products[i+1:]...)
-					break
-				}
-			}
-			if err := s.db.Save(); err != nil {
+			if err := s.db.DeleteProduct(id); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -243,6 +306,22 @@ func (s *server) handleProducts(w http.ResponseWriter, r *http.Request) {
 		s.handleProjectsForProduct(w, r, prd, segs[2:])
 		return
 	}
+	if len(segs) == 2 && (segs[1] == "archive" || segs[1] == "restore") {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		archive := s.db.ArchiveProduct
+		if segs[1] == "restore" {
+			archive = s.db.RestoreProduct
+		}
+		if err := archive(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, prd)
+		return
+	}
 	http.NotFound(w, r)
 }
 
@@ -250,7 +329,11 @@ func (s *server) handleProjectsForProduct(w http.ResponseWriter, r *http.Request
 	if len(segs) == 0 {
 		switch r.Method {
 		case http.MethodGet:
-			respondJSON(w, prd.Projects)
+			if r.URL.Query().Get("archived") == "true" {
+				respondJSON(w, prd.Projects)
+				return
+			}
+			respondJSON(w, prd.ActiveProjects())
 		case http.MethodPost:
 			var pd PMFS.ProjectData
 			if err := json.NewDecoder(r.Body).Decode(&pd); err != nil {
@@ -258,6 +341,10 @@ func (s *server) handleProjectsForProduct(w http.ResponseWriter, r *http.Request
 				return
 			}
 			id, err := prd.NewProject(pd)
+			if errors.Is(err, PMFS.ErrDuplicateKeyPrefix) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -283,6 +370,7 @@ func (s *server) handleProjectsForProduct(w http.ResponseWriter, r *http.Request
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	w = &etagWriter{ResponseWriter: w, prj: prj}
 	if len(segs) == 1 {
 		switch r.Method {
 		case http.MethodGet:
@@ -293,13 +381,23 @@ func (s *server) handleProjectsForProduct(w http.ResponseWriter, r *http.Request
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if pd.Name != "" {
-				prj.Name = pd.Name
-			}
-			if pd.Scope != "" {
-				prj.D.Scope = pd.Scope
+			err := prj.Edit(func(prj *PMFS.ProjectType) error {
+				if !ifMatch(r, prj.Revision) {
+					return PMFS.ErrConflict
+				}
+				if pd.Name != "" {
+					prj.Name = pd.Name
+				}
+				if pd.Scope != "" {
+					prj.D.Scope = pd.Scope
+				}
+				return nil
+			})
+			if errors.Is(err, PMFS.ErrConflict) {
+				http.Error(w, "project revision changed", http.StatusPreconditionFailed)
+				return
 			}
-			if err := prj.Save(); err != nil {
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -309,13 +407,10 @@ func (s *server) handleProjectsForProduct(w http.ResponseWriter, r *http.Request
 			}
 			respondJSON(w, prj)
 		case http.MethodDelete:
-			for i := range prd.Projects {
-				if prd.Projects[i].ID == id {
-					prd.Projects = append(prd.Projects[:i], prd.Projects[i+1:]...)
-					break
-				}
+			if !checkIfMatch(w, r, prj) {
+				return
 			}
-			if err := s.db.Save(); err != nil {
+			if err := prd.DeleteProject(id); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -325,6 +420,22 @@ func (s *server) handleProjectsForProduct(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	if len(segs) == 2 && (segs[1] == "archive" || segs[1] == "restore") {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		archive := prd.ArchiveProject
+		if segs[1] == "restore" {
+			archive = prd.RestoreProject
+		}
+		if err := archive(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, prj)
+		return
+	}
 	http.NotFound(w, r)
 }
 
@@ -345,11 +456,26 @@ func (s *server) handleProjects(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid project id", http.StatusBadRequest)
 		return
 	}
-	prj, err := s.findProject(prid)
+	unlockDB := s.db.RLock()
+	prj, unlock, err := s.findProject(prid)
 	if err != nil {
+		unlockDB()
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if len(segs) == 3 && segs[1] == "struct" && segs[2] == "subscribe" {
+		// Streams stay open indefinitely; do not hold any lock.
+		unlock()
+		unlockDB()
+		s.handleProjectSubscribe(w, r, prid)
+		return
+	}
+	defer unlockDB()
+	defer unlock()
+	w = &etagWriter{ResponseWriter: w, prj: prj}
+	if !checkIfMatch(w, r, prj) {
+		return
+	}
 
 	if len(segs) == 1 {
 		if r.Method == http.MethodGet {
@@ -357,34 +483,607 @@ func (s *server) handleProjects(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+		return
+	}
+
+	switch segs[1] {
+	case "requirements":
+		s.handleRequirementsForProject(w, r, prj, segs[2:])
+	case "export":
+		s.handleProjectExport(w, r, prj, segs[2:])
+	case "import":
+		s.handleProjectImport(w, r, prj, segs[2:])
+	case "design":
+		if r.Method == http.MethodGet {
+			respondJSON(w, prj.D.Intelligence)
+			return
+		}
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	case "baselines":
+		s.handleProjectBaselines(w, r, prj, segs[2:])
+	case "categories":
+		s.handleProjectCategories(w, r, prj, segs[2:])
+	case "attributes":
+		s.handleProjectAttributes(w, r, prj, segs[2:])
+	case "approvals":
+		s.handleProjectApprovals(w, r, prj, segs[2:])
+	case "glossary":
+		s.handleProjectGlossary(w, r, prj, segs[2:])
+	case "risks":
+		s.handleProjectRisks(w, r, prj, segs[2:])
+	case "releases":
+		s.handleProjectReleases(w, r, prj, segs[2:])
+	case "backlog":
+		s.handleProjectBacklog(w, r, prj, segs[2:])
+	case "testcases":
+		s.handleProjectTestCases(w, r, prj, segs[2:])
+	case "struct":
+		if len(segs) == 2 {
+			s.handleProjectStruct(w, r, prj)
+			return
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleProjectCategories lists (GET) and extends (POST) the project's
+// category catalog, and classifies uncategorized AI-generated requirements
+// (POST /classify).
+func (s *server) handleProjectCategories(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, prj.Categories())
+	case len(segs) == 0 && r.Method == http.MethodPost:
+		var c PMFS.Category
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.AddCategory(c); err != nil {
+			code := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, PMFS.ErrCategoryExists):
+				code = http.StatusConflict
+			case errors.Is(err, PMFS.ErrUnknownCategory), c.Name == "":
+				code = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusCreated)
+		respondJSON(w, c)
+	case len(segs) == 1 && segs[0] == "classify" && r.Method == http.MethodPost:
+		n, err := prj.ClassifyRequirements()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, map[string]int{"classified": n})
+	case len(segs) > 1 || (len(segs) == 1 && segs[0] != "classify"):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// filterByAttributes keeps the requirements whose custom attributes match
+// every attr.<name>=<value> query parameter. It returns a new slice.
+func filterByAttributes(prj *PMFS.ProjectType, reqs []PMFS.Requirement, q url.Values) ([]PMFS.Requirement, error) {
+	out := []PMFS.Requirement{}
+	for _, req := range reqs {
+		keep := true
+		for key, vals := range q {
+			name, ok := strings.CutPrefix(key, "attr.")
+			if !ok {
+				continue
+			}
+			match, err := prj.MatchAttribute(req, name, vals[0])
+			if err != nil {
+				return nil, err
+			}
+			keep = keep && match
+		}
+		if keep {
+			out = append(out, req)
+		}
+	}
+	return out, nil
+}
+
+// handleProjectAttributes lists (GET) the project's custom attribute schema
+// and adds or replaces a definition (POST).
+func (s *server) handleProjectAttributes(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	if len(segs) > 0 {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, prj.D.AttributeSchema)
+	case http.MethodPost:
+		var d PMFS.AttributeDef
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.DefineAttribute(d); err != nil {
+			http.Error(w, err.Error(), requirementErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, d)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProjectApprovals reads (GET) and replaces (PUT) the project's
+// approval policy.
+func (s *server) handleProjectApprovals(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	if len(segs) > 0 {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, prj.ApprovalPolicy())
+	case http.MethodPut:
+		var rules []PMFS.ApprovalRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.SetApprovalPolicy(rules); err != nil {
+			http.Error(w, err.Error(), requirementErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, prj.ApprovalPolicy())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProjectGlossary lists (GET) and adds (POST) glossary entries,
+// replaces (PUT) or removes (DELETE) the entry at /glossary/:term, and
+// reports undefined terms per requirement at /glossary/gaps.
+func (s *server) handleProjectGlossary(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	var err error
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, prj.Glossary())
+		return
+	case len(segs) == 1 && segs[0] == "gaps" && r.Method == http.MethodGet:
+		respondJSON(w, prj.GlossaryGaps())
+		return
+	case len(segs) == 0 && r.Method == http.MethodPost, len(segs) == 1 && r.Method == http.MethodPut:
+		var e PMFS.GlossaryEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(segs) == 0 {
+			err = prj.AddTerm(e)
+		} else {
+			e.Term = segs[0]
+			err = prj.UpdateTerm(e)
+		}
+	case len(segs) == 1 && r.Method == http.MethodDelete:
+		err = prj.RemoveTerm(segs[0])
+	case len(segs) > 1:
+		http.NotFound(w, r)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case errors.Is(err, PMFS.ErrTermExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, PMFS.ErrTermNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.notifySubscribers(prj.ID)
+	respondJSON(w, prj.Glossary())
+}
+
+// riskErrorStatus maps risk register errors to HTTP status codes.
+func riskErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, PMFS.ErrRiskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, PMFS.ErrInvalidRisk), errors.Is(err, PMFS.ErrRequirementNotFound):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// testCaseErrorStatus maps test case errors to HTTP status codes.
+func testCaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, PMFS.ErrTestCaseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, PMFS.ErrInvalidTestCase), errors.Is(err, PMFS.ErrRequirementNotFound):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// handleProjectTestCases serves verification test cases: list and add
+// (GET/POST), the coverage matrix (GET /coverage), JUnit XML results (POST
+// /junit with the report as body), single test cases (GET/PUT/DELETE /:id)
+// and manual results (POST /:id/result {"result", "message"}).
+func (s *server) handleProjectTestCases(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, prj.D.TestCases)
+	case len(segs) == 0 && r.Method == http.MethodPost:
+		var tc PMFS.TestCase
+		if err := json.NewDecoder(r.Body).Decode(&tc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := prj.AddTestCase(tc)
+		if err != nil {
+			http.Error(w, err.Error(), testCaseErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusCreated)
+		respondJSON(w, added)
+	case len(segs) == 1 && segs[0] == "coverage" && r.Method == http.MethodGet:
+		respondJSON(w, prj.Coverage())
+	case len(segs) == 1 && segs[0] == "junit" && r.Method == http.MethodPost:
+		res, err := prj.ImportJUnit(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, res)
+	case len(segs) == 2 && segs[1] == "result" && r.Method == http.MethodPost:
+		id, err := strconv.Atoi(segs[0])
+		if err != nil {
+			http.Error(w, "invalid test case id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Result  PMFS.TestResult `json:"result"`
+			Message string          `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.RecordTestResult(id, body.Result, body.Message); err != nil {
+			http.Error(w, err.Error(), testCaseErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		tc, _ := prj.TestCaseByID(id)
+		respondJSON(w, tc)
+	case len(segs) == 1:
+		id, err := strconv.Atoi(segs[0])
+		if err != nil {
+			http.Error(w, "invalid test case id", http.StatusBadRequest)
+			return
+		}
+		tc, err := prj.TestCaseByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			respondJSON(w, tc)
+			return
+		case http.MethodPut:
+			var upd PMFS.TestCase
+			if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			upd.ID = id
+			err = prj.UpdateTestCase(upd)
+		case http.MethodDelete:
+			err = prj.RemoveTestCase(id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), testCaseErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case len(segs) > 2:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProjectBacklog ranks the project's requirements with a scoring
+// model (GET ?model=, WSJF by default) and lists the scoring models (GET
+// /models).
+func (s *server) handleProjectBacklog(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case len(segs) == 0:
+		model := r.URL.Query().Get("model")
+		if model == "" {
+			model = "wsjf"
+		}
+		ranked, err := prj.RankedBacklog(model)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respondJSON(w, ranked)
+	case len(segs) == 1 && segs[0] == "models":
+		respondJSON(w, PMFS.ScoringModels())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// releaseErrorStatus maps release planning errors to HTTP status codes.
+func releaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, PMFS.ErrReleaseNotFound), errors.Is(err, PMFS.ErrRequirementNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, PMFS.ErrScheduleConflict), errors.Is(err, PMFS.ErrOverCapacity):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// handleProjectReleases serves release planning: list and add (GET/POST),
+// the scope report (GET /:id), single releases (PUT/DELETE /:id) and moving
+// requirements into a release (POST /:id/requirements {"ids"}). Release 0
+// in the last route unplans the requirements.
+func (s *server) handleProjectReleases(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, prj.Releases())
+	case len(segs) == 0 && r.Method == http.MethodPost:
+		var rel PMFS.Release
+		if err := json.NewDecoder(r.Body).Decode(&rel); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := prj.AddRelease(rel)
+		if err != nil {
+			http.Error(w, err.Error(), releaseErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusCreated)
+		respondJSON(w, added)
+	case len(segs) == 2 && segs[1] == "requirements" && r.Method == http.MethodPost:
+		id, err := strconv.Atoi(segs[0])
+		if err != nil {
+			http.Error(w, "invalid release id", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, rid := range body.IDs {
+			if err := prj.AssignRelease(rid, id); err != nil {
+				http.Error(w, err.Error(), releaseErrorStatus(err))
+				return
+			}
+		}
+		s.notifySubscribers(prj.ID)
+		if id == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		sc, err := prj.ReleaseScope(id)
+		if err != nil {
+			http.Error(w, err.Error(), releaseErrorStatus(err))
+			return
+		}
+		respondJSON(w, sc)
+	case len(segs) == 1:
+		id, err := strconv.Atoi(segs[0])
+		if err != nil {
+			http.Error(w, "invalid release id", http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			sc, err := prj.ReleaseScope(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			respondJSON(w, sc)
+			return
+		case http.MethodPut:
+			var upd PMFS.Release
+			if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			upd.ID = id
+			err = prj.UpdateRelease(upd)
+		case http.MethodDelete:
+			err = prj.RemoveRelease(id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), releaseErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case len(segs) > 2:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProjectRisks serves the risk register: list and add (GET/POST),
+// the residual risk matrix (GET /matrix), LLM proposals from intelligence
+// (POST /propose) and single risks (GET/PUT/DELETE /:id).
+func (s *server) handleProjectRisks(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, prj.D.Risks)
+	case len(segs) == 0 && r.Method == http.MethodPost:
+		var risk PMFS.Risk
+		if err := json.NewDecoder(r.Body).Decode(&risk); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := prj.AddRisk(risk)
+		if err != nil {
+			http.Error(w, err.Error(), riskErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusCreated)
+		respondJSON(w, added)
+	case len(segs) == 1 && segs[0] == "matrix" && r.Method == http.MethodGet:
+		m := prj.ResidualRiskMatrix()
+		respondJSON(w, map[string]interface{}{"matrix": m, "text": m.String(), "unmitigated": prj.UnmitigatedRisks()})
+	case len(segs) == 1 && segs[0] == "propose" && r.Method == http.MethodPost:
+		risks, err := prj.ProposeRisks()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, risks)
+	case len(segs) == 1:
+		id, err := strconv.Atoi(segs[0])
+		if err != nil {
+			http.Error(w, "invalid risk id", http.StatusBadRequest)
+			return
+		}
+		risk, err := prj.RiskByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			respondJSON(w, risk)
+			return
+		case http.MethodPut:
+			var upd PMFS.Risk
+			if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			upd.ID = id
+			err = prj.UpdateRisk(upd)
+		case http.MethodDelete:
+			err = prj.RemoveRisk(id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), riskErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case len(segs) > 1:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
+}
 
-	switch segs[1] {
-	case "requirements":
-		s.handleRequirementsForProject(w, r, prj, segs[2:])
-	case "export":
-		s.handleProjectExport(w, r, prj, segs[2:])
-	case "import":
-		s.handleProjectImport(w, r, prj, segs[2:])
-	case "design":
-		if r.Method == http.MethodGet {
-			respondJSON(w, prj.D.Intelligence)
+// baselineSummary is the listing entry of a baseline.
+type baselineSummary struct {
+	Name         string    `json:"name"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedBy    string    `json:"created_by"`
+	Revision     int       `json:"revision"`
+	Requirements int       `json:"requirements"`
+}
+
+func (s *server) handleProjectBaselines(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, segs []string) {
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+		names, err := prj.BaselineNames()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	case "struct":
-		if len(segs) == 2 {
-			s.handleProjectStruct(w, r, prj)
+		out := []baselineSummary{}
+		for _, name := range names {
+			bl, err := prj.Baseline(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			out = append(out, baselineSummary{bl.Name, bl.CreatedAt, bl.CreatedBy, bl.Revision, len(bl.D.Requirements)})
+		}
+		respondJSON(w, out)
+	case len(segs) == 0 && r.Method == http.MethodPost:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		bl, err := prj.CreateBaseline(body.Name)
+		if errors.Is(err, PMFS.ErrBaselineExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		respondJSON(w, bl)
+	case len(segs) == 1 && r.Method == http.MethodGet:
+		bl, err := prj.Baseline(segs[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		if len(segs) == 3 && segs[2] == "subscribe" {
-			s.handleProjectSubscribe(w, r, prj)
+		respondJSON(w, bl)
+	case len(segs) == 2 && segs[1] == "diff" && r.Method == http.MethodGet:
+		// Without ?to= the baseline is compared with the current project.
+		d, err := prj.DiffBaselines(segs[0], r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		respondJSON(w, d)
+	case len(segs) > 2 || (len(segs) == 2 && segs[1] != "diff"):
 		http.NotFound(w, r)
 	default:
-		http.NotFound(w, r)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -401,6 +1100,18 @@ func (s *server) handleProjectStruct(w http.ResponseWriter, r *http.Request, prj
 		pageSize = 50
 	}
 	reqs := prj.D.Requirements
+	// ?root= limits the listing to a requirement and its descendants; depth
+	// then counts from that requirement instead of the top level.
+	baseLevel := 0
+	if root, _ := strconv.Atoi(q.Get("root")); root > 0 {
+		sub, err := prj.Subtree(root)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		reqs = sub
+		baseLevel = sub[0].Level - 1
+	}
 	if status != "" {
 		filtered := reqs[:0]
 		for _, r := range reqs {
@@ -413,7 +1124,8 @@ func (s *server) handleProjectStruct(w http.ResponseWriter, r *http.Request, prj
 			case "proposed":
 				ok = r.Condition.Proposed
 			default:
-				ok = true
+				// Any other value names a workflow state.
+				ok = strings.EqualFold(r.Status, status)
 			}
 			if ok {
 				filtered = append(filtered, r)
@@ -421,10 +1133,15 @@ func (s *server) handleProjectStruct(w http.ResponseWriter, r *http.Request, prj
 		}
 		reqs = filtered
 	}
+	reqs, err := filterByAttributes(prj, reqs, q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if depth > 0 {
 		filtered := reqs[:0]
 		for _, r := range reqs {
-			if r.Level <= depth {
+			if r.Level-baseLevel <= depth {
 				filtered = append(filtered, r)
 			}
 		}
@@ -466,20 +1183,20 @@ func (s *server) handleProjectStruct(w http.ResponseWriter, r *http.Request, prj
 	respondJSON(w, resp)
 }
 
-func (s *server) handleProjectSubscribe(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType) {
+func (s *server) handleProjectSubscribe(w http.ResponseWriter, r *http.Request, projectID int) {
 	if f, ok := w.(http.Flusher); ok {
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		ch := make(chan struct{}, 1)
 		s.mu.Lock()
-		s.subs[prj.ID] = append(s.subs[prj.ID], ch)
+		s.subs[projectID] = append(s.subs[projectID], ch)
 		s.mu.Unlock()
 		defer func() {
 			s.mu.Lock()
-			subs := s.subs[prj.ID]
+			subs := s.subs[projectID]
 			for i := range subs {
 				if subs[i] == ch {
-					s.subs[prj.ID] = append(subs[:i], subs[i+1:]...)
+					s.subs[projectID] = append(subs[:i], subs[i+1:]...)
 					break
 				}
 			}
@@ -590,7 +1307,7 @@ func (s *server) handleProjectImport(w http.ResponseWriter, r *http.Request, prj
 	defer os.Remove(tmp)
 
 	if err := prj.ImportExcel(tmp, false); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), requirementErrorStatus(err))
 		return
 	}
 	if err := prj.Save(); err != nil {
@@ -605,7 +1322,12 @@ func (s *server) handleRequirementsForProject(w http.ResponseWriter, r *http.Req
 	switch r.Method {
 	case http.MethodGet:
 		if len(segs) == 0 {
-			respondJSON(w, prj.D.Requirements)
+			reqs, err := filterByAttributes(prj, prj.D.Requirements, r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			respondJSON(w, reqs)
 			return
 		}
 	}
@@ -617,7 +1339,7 @@ func (s *server) handleRequirementsForProject(w http.ResponseWriter, r *http.Req
 				return
 			}
 			if err := prj.AddRequirement(req); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), requirementErrorStatus(err))
 				return
 			}
 			s.notifySubscribers(prj.ID)
@@ -654,16 +1376,55 @@ func (s *server) handleRequirementsForProject(w http.ResponseWriter, r *http.Req
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			upd.ID = req.ID
-			*req = upd
-			if err := prj.Save(); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			if upd.Category != req.Category {
+				if err := prj.CheckCategory(upd.Category); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			// The edit is applied through Update, so a rejected save leaves
+			// the loaded project as it was.
+			user := s.user(r)
+			err := prj.Update(func(tx *PMFS.ProjectTx) error {
+				cur, err := tx.Requirement(id)
+				if err != nil {
+					return err
+				}
+				// History is owned by the server; record the edit instead of
+				// accepting the client's copy. The key is stable and never
+				// changes through the API. The status only changes through
+				// workflow transitions, sign-offs only through the approvals
+				// endpoint, the release only through the release endpoint and
+				// scoring factors only through the factors endpoint, which
+				// validates them. The condition and gate results are set by
+				// analysis and read by workflow guards, so clients cannot
+				// forge them either.
+				before := *cur
+				upd.ID = cur.ID
+				upd.History = cur.History
+				upd.Key = cur.Key
+				upd.Approvals = cur.Approvals
+				upd.ReleaseID = cur.ReleaseID
+				upd.Factors = cur.Factors
+				upd.FactorJustification = cur.FactorJustification
+				upd.Status = cur.Status
+				upd.Condition = cur.Condition
+				upd.GateResults = cur.GateResults
+				*cur = upd
+				cur.RecordChange(before, user, "updated via web")
+				return nil
+			})
+			if err != nil {
+				http.Error(w, err.Error(), requirementErrorStatus(err))
 				return
 			}
 			s.notifySubscribers(prj.ID)
 			respondJSON(w, req)
 		case http.MethodDelete:
-			prj.DeleteRequirementByID(id)
+			if err := prj.DeleteRequirementByID(id); err != nil {
+				http.Error(w, err.Error(), requirementErrorStatus(err))
+				return
+			}
 			s.notifySubscribers(prj.ID)
 			w.WriteHeader(http.StatusNoContent)
 		default:
@@ -675,9 +1436,238 @@ func (s *server) handleRequirementsForProject(w http.ResponseWriter, r *http.Req
 		s.handleRequirementActive(w, r, prj, req)
 		return
 	}
+	if len(segs) == 2 && segs[1] == "status" {
+		s.handleRequirementStatus(w, r, prj, req)
+		return
+	}
 	http.NotFound(w, r)
 }
 
+// requirementErrorStatus maps errors from workflow, hierarchy, category and
+// attribute checks to client errors; anything else is a server error.
+func requirementErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, PMFS.ErrUnknownState), errors.Is(err, PMFS.ErrUnknownCategory),
+		errors.Is(err, PMFS.ErrUnknownAttribute), errors.Is(err, PMFS.ErrInvalidAttribute),
+		errors.Is(err, PMFS.ErrUnknownRole), errors.Is(err, PMFS.ErrForeignKey):
+		return http.StatusBadRequest
+	case errors.Is(err, PMFS.ErrIllegalTransition), errors.Is(err, PMFS.ErrGuardFailed), errors.Is(err, PMFS.ErrHierarchyCycle),
+		errors.Is(err, PMFS.ErrAmbiguousKey):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// handleRequirementStatus reports the requirement's workflow state with the
+// states it may move to (GET) and moves it to another state (POST {"to"}).
+func (s *server) handleRequirementStatus(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, req *PMFS.Requirement) {
+	switch r.Method {
+	case http.MethodGet:
+		next, err := prj.AllowedTransitions(req.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		respondJSON(w, map[string]interface{}{"status": req.Status, "next": next})
+	case http.MethodPost:
+		var body struct {
+			To string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.Transition(req.ID, body.To); err != nil {
+			http.Error(w, err.Error(), requirementErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRequirementApprovals lists the requirement's sign-offs with the
+// approvals still missing (GET) and signs it off as the X-User request
+// header in a role (POST {"role"}).
+func (s *server) handleRequirementApprovals(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, req *PMFS.Requirement) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.Approve(req.ID, body.Role, s.user(r)); err != nil {
+			http.Error(w, err.Error(), requirementErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	missing, err := prj.MissingApprovals(req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	respondJSON(w, map[string]interface{}{"approvals": req.Approvals, "missing": missing})
+}
+
+// handleRequirementFactors reports the requirement's scoring factors with
+// its score under every model that has them all (GET), replaces them (PUT
+// {"factors", "justification"}) and lets the LLM propose a model's factors
+// (POST /propose {"model"}).
+func (s *server) handleRequirementFactors(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, req *PMFS.Requirement, segs []string) {
+	switch {
+	case len(segs) == 0 && r.Method == http.MethodGet:
+	case len(segs) == 0 && r.Method == http.MethodPut:
+		var body struct {
+			Factors       map[string]float64 `json:"factors"`
+			Justification string             `json:"justification"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.SetFactors(req.ID, body.Factors, body.Justification); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, PMFS.ErrUnknownFactor) || errors.Is(err, PMFS.ErrInvalidFactor) {
+				code = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		s.notifySubscribers(prj.ID)
+	case len(segs) == 1 && segs[0] == "propose" && r.Method == http.MethodPost:
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, err := prj.ProposeFactors(req.ID, body.Model)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, PMFS.ErrUnknownModel) {
+				code = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, p)
+		return
+	case len(segs) > 1:
+		http.NotFound(w, r)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scores := map[string]float64{}
+	for _, m := range PMFS.ScoringModels() {
+		if score, err := m.Evaluate(req.Factors); err == nil {
+			scores[m.Name] = score
+		}
+	}
+	respondJSON(w, map[string]interface{}{"factors": req.Factors, "justification": req.FactorJustification, "scores": scores})
+}
+
+// handleRequirementComments lists the requirement's review threads (GET),
+// adds a comment or a reply (POST {"text", "reply_to"}) and resolves or
+// reopens a thread (PUT /:cid {"resolved"}). Comments are authored by the
+// X-User request header.
+func (s *server) handleRequirementComments(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, req *PMFS.Requirement, segs []string) {
+	if len(segs) == 0 || segs[0] == "" {
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("unresolved") == "true" {
+				respondJSON(w, prj.UnresolvedComments(req.ID))
+				return
+			}
+			respondJSON(w, prj.Comments(req.ID))
+		case http.MethodPost:
+			var body struct {
+				Text    string `json:"text"`
+				ReplyTo int    `json:"reply_to"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var c *PMFS.Comment
+			var err error
+			if body.ReplyTo != 0 {
+				if _, ok := findComment(prj.Comments(req.ID), body.ReplyTo); !ok {
+					http.Error(w, "comment not found", http.StatusNotFound)
+					return
+				}
+				c, err = prj.Reply(body.ReplyTo, s.user(r), body.Text)
+			} else {
+				c, err = prj.AddComment(req.ID, s.user(r), body.Text)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.notifySubscribers(prj.ID)
+			w.WriteHeader(http.StatusCreated)
+			respondJSON(w, c)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	cid, err := strconv.Atoi(segs[0])
+	if err != nil {
+		http.Error(w, "invalid comment id", http.StatusBadRequest)
+		return
+	}
+	if _, ok := findComment(prj.Comments(req.ID), cid); !ok {
+		http.Error(w, "comment not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Resolved bool `json:"resolved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Resolved {
+		err = prj.ResolveComment(cid, s.user(r))
+	} else {
+		err = prj.ReopenComment(cid)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.notifySubscribers(prj.ID)
+	respondJSON(w, prj.Comments(req.ID))
+}
+
+// findComment returns the comment with the given ID from cs.
+func findComment(cs []PMFS.Comment, id int) (PMFS.Comment, bool) {
+	for _, c := range cs {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return PMFS.Comment{}, false
+}
+
 func (s *server) handleRequirementActive(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, req *PMFS.Requirement) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -690,9 +1680,24 @@ func (s *server) handleRequirementActive(w http.ResponseWriter, r *http.Request,
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	req.Condition.Active = body.Active
-	if err := prj.Save(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// The flag follows the workflow: activating takes the first transition
+	// into an active state, deactivating the first one into an open state.
+	var err error
+	switch {
+	case body.Active:
+		err = prj.ActivateRequirementByID(req.ID)
+	case req.Condition.Active:
+		err = fmt.Errorf("requirement %d: no open state reachable from %s: %w", req.ID, req.Status, PMFS.ErrIllegalTransition)
+		next, _ := prj.AllowedTransitions(req.ID)
+		for _, name := range next {
+			if st, _ := prj.Workflow().State(name); st.Kind == PMFS.StateOpen {
+				err = prj.Transition(req.ID, name)
+				break
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), requirementErrorStatus(err))
 		return
 	}
 	s.notifySubscribers(prj.ID)
@@ -708,16 +1713,21 @@ func (s *server) handleRequirements(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	rid, err := strconv.Atoi(segs[0])
-	if err != nil {
-		http.Error(w, "invalid requirement id", http.StatusBadRequest)
+	defer s.db.RLock()()
+	prj, req, unlock, err := s.findProjectByRequirement(segs[0])
+	if errors.Is(err, errAmbiguousRequirement) {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
-	prj, req, err := s.findProjectByRequirement(rid)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	defer unlock()
+	w = &etagWriter{ResponseWriter: w, prj: prj}
+	if !checkIfMatch(w, r, prj) {
+		return
+	}
 	if len(segs) == 1 {
 		switch r.Method {
 		case http.MethodGet:
@@ -735,14 +1745,87 @@ func (s *server) handleRequirements(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		pass, ans, err := req.Analyze("system", "clarity-form-1")
+		pass, ans, err := prj.AnalyzeRequirement(req.ID, "system", "clarity-form-1")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		before := *req
 		req.Condition.AIanalyzed = true
-		_ = prj.Save()
+		req.RecordChange(before, PMFS.ActorAI, "analyzed")
+		if err := prj.Save(); err != nil {
+			*req = before
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.notifySubscribers(prj.ID)
 		respondJSON(w, map[string]interface{}{"pass": pass, "answer": ans})
+	case "history":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		respondJSON(w, req.Timeline())
+	case "criteria":
+		switch r.Method {
+		case http.MethodGet:
+			respondJSON(w, req.AcceptanceCriteria)
+		case http.MethodPost:
+			// Drafts criteria from the description with the LLM.
+			out, err := prj.DraftAcceptanceCriteria(req.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.notifySubscribers(prj.ID)
+			respondJSON(w, out)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "comments":
+		s.handleRequirementComments(w, r, prj, req, segs[2:])
+	case "approvals":
+		s.handleRequirementApprovals(w, r, prj, req)
+	case "factors":
+		s.handleRequirementFactors(w, r, prj, req, segs[2:])
+	case "tests":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		respondJSON(w, map[string]interface{}{"test_cases": prj.TestCasesFor(req.ID), "verification": prj.VerificationOf(req.ID)})
+	case "risks":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		respondJSON(w, prj.RisksFor(req.ID))
+	case "release":
+		// Plan the requirement in another release, or unplan it with 0.
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			ReleaseID int `json:"release_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := prj.AssignRelease(req.ID, body.ReleaseID); err != nil {
+			http.Error(w, err.Error(), releaseErrorStatus(err))
+			return
+		}
+		s.notifySubscribers(prj.ID)
+		respondJSON(w, req)
+	case "glossary":
+		// Undefined terms in the description, with offsets for highlighting.
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		respondJSON(w, prj.ScanTerms(req.Description))
 	case "suggestions":
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -760,10 +1843,6 @@ func (s *server) handleRequirements(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func projectInputDir(prj *PMFS.ProjectType) string {
-	return filepath.Join(os.Getenv("PMFS_BASEDIR"), "products", strconv.Itoa(prj.ProductID), "projects", strconv.Itoa(prj.ID), "input")
-}
-
 func (s *server) handleRequirementAttachments(w http.ResponseWriter, r *http.Request, prj *PMFS.ProjectType, req *PMFS.Requirement, segs []string) {
 	switch r.Method {
 	case http.MethodPost:
@@ -777,24 +1856,12 @@ func (s *server) handleRequirementAttachments(w http.ResponseWriter, r *http.Req
 			return
 		}
 		defer file.Close()
-		inputDir := projectInputDir(prj)
-		if err := os.MkdirAll(inputDir, 0o755); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		dst := filepath.Join(inputDir, header.Filename)
-		out, err := os.Create(dst)
+		data, err := io.ReadAll(file)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if _, err := io.Copy(out, file); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			out.Close()
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		out.Close()
-		att, err := prj.AddAttachmentFromInput(inputDir, header.Filename)
+		att, err := prj.AddAttachmentData(header.Filename, data)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -816,19 +1883,15 @@ func (s *server) handleRequirementAttachments(w http.ResponseWriter, r *http.Req
 			http.Error(w, "invalid attachment id", http.StatusBadRequest)
 			return
 		}
-		var att *PMFS.Attachment
-		for i := range prj.D.Attachments {
-			if prj.D.Attachments[i].ID == aid {
-				att = &prj.D.Attachments[i]
-				break
-			}
-		}
-		if att == nil {
+		att, data, err := prj.ReadAttachment(aid)
+		if err != nil {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
-		full := filepath.Join(projectDir(prj.ProductID, prj.ID), att.RelPath)
-		http.ServeFile(w, r, full)
+		if att.Mimetype != "" {
+			w.Header().Set("Content-Type", att.Mimetype)
+		}
+		http.ServeContent(w, r, att.Filename, att.AddedAt, bytes.NewReader(data))
 	case http.MethodDelete:
 		if len(segs) < 1 {
 			http.Error(w, "attachment id required", http.StatusBadRequest)
@@ -839,13 +1902,9 @@ func (s *server) handleRequirementAttachments(w http.ResponseWriter, r *http.Req
 			http.Error(w, "invalid attachment id", http.StatusBadRequest)
 			return
 		}
-		for i := range prj.D.Attachments {
-			if prj.D.Attachments[i].ID == aid {
-				full := filepath.Join(projectDir(prj.ProductID, prj.ID), prj.D.Attachments[i].RelPath)
-				os.Remove(full)
-				prj.D.Attachments = append(prj.D.Attachments[:i], prj.D.Attachments[i+1:]...)
-				break
-			}
+		if err := prj.RemoveAttachment(aid); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
 		if req.AttachmentIndex >= len(prj.D.Attachments) {
 			req.AttachmentIndex = -1
@@ -861,10 +1920,4 @@ func (s *server) handleRequirementAttachments(w http.ResponseWriter, r *http.Req
 	}
 }
 
-// projectDir reimplements PMFS's internal path helpers for the example.
-func projectDir(productID, projectID int) string {
-	base := os.Getenv("PMFS_BASEDIR")
-	return filepath.Join(base, "products", strconv.Itoa(productID), "projects", strconv.Itoa(projectID))
-}
-
 // ----------------------------------------------------------------------------------
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	PMFS "github.com/rjboer/PMFS"
+)
+
+// newTestServer returns a server on an in-memory database with one project
+// holding requirement 1.
+func newTestServer(t *testing.T) (*server, *PMFS.ProjectType) {
+	t.Helper()
+	db, err := PMFS.Open(PMFS.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := db.NewProduct(PMFS.ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	prd := &db.Products[0]
+	id, err := prd.NewProject(PMFS.ProjectData{Name: "prj"})
+	if err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	prj, err := prd.Project(id)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	if err := prj.AddRequirement(PMFS.Requirement{Name: "R1"}); err != nil {
+		t.Fatalf("AddRequirement: %v", err)
+	}
+	return &server{db: db, subs: make(map[int][]chan struct{})}, prj
+}
+
+// do serves an editor request with body and returns the recorder.
+func (s *server) do(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Role", "editor")
+	rec := httptest.NewRecorder()
+	s.handleProjects(rec, req)
+	return rec
+}
+
+func TestPutRequirementKeepsKey(t *testing.T) {
+	s, prj := newTestServer(t)
+	key := prj.D.Requirements[0].Key
+	if rec := s.do(http.MethodPut, "/projects/1/requirements/1", `{"name":"R1 edited"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT without key: %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodPut, "/projects/1/requirements/1", `{"name":"R1","key":"OTHER-REQ-0001"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT with foreign key: %d %s", rec.Code, rec.Body)
+	}
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if r := prj.D.Requirements[0]; r.Key != key || r.Name != "R1" {
+		t.Fatalf("key changed from %s: %#v", key, r)
+	}
+}
+
+func TestPutRequirementKeepsGateResults(t *testing.T) {
+	s, prj := newTestServer(t)
+	err := prj.Update(func(tx *PMFS.ProjectTx) error {
+		r, err := tx.Requirement(1)
+		if err != nil {
+			return err
+		}
+		r.Condition.GateResults = map[string]bool{"clarity-form-1": false}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	body := `{"name":"R1","condition":{"aianalyzed":true,"gates":{"clarity-form-1":true}},"gate_results":[]}`
+	if rec := s.do(http.MethodPut, "/projects/1/requirements/1", body); rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c := prj.D.Requirements[0].Condition; c.AIanalyzed || c.GateResults["clarity-form-1"] {
+		t.Fatalf("client forged the condition: %#v", c)
+	}
+}
+
+func TestPutRequirementRejectedLeavesProject(t *testing.T) {
+	s, prj := newTestServer(t)
+	rec := s.do(http.MethodPut, "/projects/1/requirements/1", `{"name":"R1 edited","parent_id":1}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("PUT with cyclic parent: %d %s", rec.Code, rec.Body)
+	}
+	if r := prj.D.Requirements[0]; r.Name != "R1" || r.ParentID != 0 || len(r.History) != 0 {
+		t.Fatalf("rejected PUT changed the loaded requirement: %#v", r)
+	}
+}
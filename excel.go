@@ -1,7 +1,9 @@
 package PMFS
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -63,6 +65,11 @@ func (p *ProjectType) ExportExcel(path string) error {
 		for _, g := range gateIDs {
 			header = append(header, fmt.Sprintf("Gate:%s", g))
 		}
+		// Columns after the gates are located by name on import.
+		header = append(header, "Key")
+		for _, d := range p.D.AttributeSchema {
+			header = append(header, "Attr:"+d.Name)
+		}
 		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
 			return err
 		}
@@ -90,6 +97,10 @@ func (p *ProjectType) ExportExcel(path string) error {
 			for _, g := range gateIDs {
 				row = append(row, req.Condition.GateResults[g])
 			}
+			row = append(row, req.Key)
+			for _, d := range p.D.AttributeSchema {
+				row = append(row, req.Attributes[d.Name])
+			}
 			cell := fmt.Sprintf("A%d", i+2)
 			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
 				return err
@@ -125,6 +136,180 @@ func (p *ProjectType) ExportExcel(path string) error {
 		}
 	}
 
+	// Acceptance criteria sheet
+	hasCriteria := false
+	for _, req := range p.D.Requirements {
+		if len(req.AcceptanceCriteria) > 0 {
+			hasCriteria = true
+			break
+		}
+	}
+	if hasCriteria {
+		sheet := "AcceptanceCriteria"
+		f.NewSheet(sheet)
+		header := []interface{}{"RequirementID", "Given", "When", "Then", "Text"}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		rowIdx := 2
+		for _, req := range p.D.Requirements {
+			for _, ac := range req.AcceptanceCriteria {
+				row := []interface{}{req.ID, ac.Given, ac.When, ac.Then, ac.Text}
+				cell := fmt.Sprintf("A%d", rowIdx)
+				if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+					return err
+				}
+				rowIdx++
+			}
+		}
+	}
+
+	// Scores sheet; the score columns are informational and empty where
+	// factors are missing.
+	factorSet := map[string]bool{}
+	for _, req := range p.D.Requirements {
+		for name := range req.Factors {
+			factorSet[name] = true
+		}
+	}
+	if len(factorSet) > 0 {
+		sheet := "Scores"
+		f.NewSheet(sheet)
+		factors := sortedKeys(factorSet)
+		models := ScoringModels()
+		header := []interface{}{"RequirementID", "Name"}
+		for _, name := range factors {
+			header = append(header, "Factor:"+name)
+		}
+		header = append(header, "Justification")
+		for _, m := range models {
+			header = append(header, "Score:"+m.Name)
+		}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		rowIdx := 2
+		for _, req := range p.D.Requirements {
+			if len(req.Factors) == 0 {
+				continue
+			}
+			row := []interface{}{req.ID, req.Name}
+			for _, name := range factors {
+				if v, ok := req.Factors[name]; ok {
+					row = append(row, v)
+				} else {
+					row = append(row, "")
+				}
+			}
+			row = append(row, req.FactorJustification)
+			for _, m := range models {
+				if score, err := m.Evaluate(req.Factors); err == nil {
+					row = append(row, score)
+				} else {
+					row = append(row, "")
+				}
+			}
+			cell := fmt.Sprintf("A%d", rowIdx)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return err
+			}
+			rowIdx++
+		}
+	}
+
+	// Relations sheet
+	if len(p.D.RequirementRelations) > 0 {
+		sheet := "Relations"
+		f.NewSheet(sheet)
+		header := []interface{}{"From", "To", "Type", "Score"}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		for i, rel := range p.D.RequirementRelations {
+			row := []interface{}{rel.From, rel.To, string(rel.Type), rel.Score}
+			cell := fmt.Sprintf("A%d", i+2)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Risks sheet; the score columns are informational.
+	if len(p.D.Risks) > 0 {
+		sheet := "Risks"
+		f.NewSheet(sheet)
+		header := []interface{}{"ID", "Title", "Description", "Likelihood", "Impact", "Mitigation", "Owner", "ResidualLikelihood", "ResidualImpact", "RequirementIDs", "IntelligenceID", "Proposed", "Score", "ResidualScore"}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		for i, r := range p.D.Risks {
+			ids := make([]string, len(r.RequirementIDs))
+			for j, id := range r.RequirementIDs {
+				ids[j] = strconv.Itoa(id)
+			}
+			row := []interface{}{
+				r.ID, r.Title, r.Description, r.Likelihood, r.Impact, r.Mitigation, r.Owner,
+				r.ResidualLikelihood, r.ResidualImpact, strings.Join(ids, ","), r.IntelligenceID,
+				strconv.FormatBool(r.Proposed), r.Score(), r.ResidualScore(),
+			}
+			cell := fmt.Sprintf("A%d", i+2)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Attributes sheet
+	if len(p.D.AttributeSchema) > 0 {
+		sheet := "Attributes"
+		f.NewSheet(sheet)
+		header := []interface{}{"Name", "Type", "Values", "Description"}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		for i, d := range p.D.AttributeSchema {
+			row := []interface{}{d.Name, string(d.Type), strings.Join(d.Values, ","), d.Description}
+			cell := fmt.Sprintf("A%d", i+2)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Categories sheet
+	if len(p.D.RequirementCategories) > 0 {
+		sheet := "Categories"
+		f.NewSheet(sheet)
+		header := []interface{}{"Name", "Parent", "Description"}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		for i, c := range p.D.RequirementCategories {
+			row := []interface{}{c.Name, c.Parent, c.Description}
+			cell := fmt.Sprintf("A%d", i+2)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Glossary sheet
+	if len(p.D.Glossary) > 0 {
+		sheet := "Glossary"
+		f.NewSheet(sheet)
+		header := []interface{}{"Term", "Definition", "Synonyms", "Expansion"}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return err
+		}
+		for i, e := range p.D.Glossary {
+			row := []interface{}{e.Term, e.Definition, strings.Join(e.Synonyms, ","), e.Expansion}
+			cell := fmt.Sprintf("A%d", i+2)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Intelligence sheet
 	if len(p.D.Intelligence) > 0 {
 		sheet := "Intelligence"
@@ -157,8 +342,11 @@ func (p *ProjectType) ExportExcel(path string) error {
 
 // ImportProjectExcel reads an Excel workbook and returns populated ProjectData.
 // It expects a sheet named "Project" with key/value pairs for basic metadata
-// and a "Requirements" sheet listing requirements. An optional "Intelligence"
-// sheet is imported when present. Missing optional sheets are ignored.
+// and a "Requirements" sheet listing requirements, with custom attributes in
+// "Attr:<name>" columns. Optional "DesignAspects", "AcceptanceCriteria",
+// "Scores", "Intelligence", "Relations", "Risks", "Categories", "Glossary"
+// and "Attributes" sheets are imported when present. Missing optional sheets
+// are ignored.
 func ImportProjectExcel(path string) (*ProjectData, error) {
 	f, err := excelize.OpenFile(path)
 	if err != nil {
@@ -210,11 +398,17 @@ func ImportProjectExcel(path string) (*ProjectData, error) {
 		return nil, err
 	}
 	gateIdx := map[int]string{}
+	attrIdx := map[int]string{}
+	var cols map[string]int
 	if len(reqRows) > 0 {
+		cols = headerIndex(reqRows[0])
 		for idx, h := range reqRows[0] {
 			if strings.HasPrefix(h, "Gate:") {
 				gateIdx[idx] = strings.TrimPrefix(h, "Gate:")
 			}
+			if strings.HasPrefix(h, "Attr:") {
+				attrIdx[idx] = strings.TrimPrefix(h, "Attr:")
+			}
 		}
 	}
 	for _, row := range reqRows[1:] {
@@ -271,6 +465,7 @@ func ImportProjectExcel(path string) (*ProjectData, error) {
 			val := strings.ToLower(row[17])
 			req.Condition.Deleted = val == "true" || val == "1" || val == "yes"
 		}
+		req.Key = cellByName(row, cols, "Key")
 		if len(gateIdx) > 0 {
 			req.Condition.GateResults = map[string]bool{}
 			for idx, gid := range gateIdx {
@@ -280,6 +475,14 @@ func ImportProjectExcel(path string) (*ProjectData, error) {
 				}
 			}
 		}
+		for idx, name := range attrIdx {
+			if idx < len(row) && row[idx] != "" {
+				if req.Attributes == nil {
+					req.Attributes = map[string]string{}
+				}
+				req.Attributes[name] = row[idx]
+			}
+		}
 		pd.Requirements = append(pd.Requirements, req)
 	}
 
@@ -309,6 +512,183 @@ func ImportProjectExcel(path string) (*ProjectData, error) {
 		}
 	}
 
+	// Acceptance criteria (optional)
+	if acRows, err := f.GetRows("AcceptanceCriteria"); err == nil && len(acRows) > 0 {
+		for _, row := range acRows[1:] {
+			if len(row) < 2 {
+				continue
+			}
+			id, err := strconv.Atoi(row[0])
+			if err != nil {
+				return nil, err
+			}
+			cell := func(i int) string {
+				if i < len(row) {
+					return row[i]
+				}
+				return ""
+			}
+			ac := AcceptanceCriterion{Given: cell(1), When: cell(2), Then: cell(3), Text: cell(4)}
+			if req, ok := reqMap[id]; ok && !ac.Empty() {
+				req.AcceptanceCriteria = append(req.AcceptanceCriteria, ac)
+			}
+		}
+	}
+
+	// Scores (optional); only the factors and justification are read.
+	if scRows, err := f.GetRows("Scores"); err == nil && len(scRows) > 0 {
+		cols := headerIndex(scRows[0])
+		for _, row := range scRows[1:] {
+			if len(row) < 1 || row[0] == "" {
+				continue
+			}
+			id, err := strconv.Atoi(row[0])
+			if err != nil {
+				return nil, err
+			}
+			req, ok := reqMap[id]
+			if !ok {
+				continue
+			}
+			for idx, h := range scRows[0] {
+				name, ok := strings.CutPrefix(h, "Factor:")
+				if !ok || idx >= len(row) || row[idx] == "" {
+					continue
+				}
+				v, err := strconv.ParseFloat(row[idx], 64)
+				if err != nil {
+					return nil, fmt.Errorf("requirement %d: factor %s: %w", id, name, err)
+				}
+				if req.Factors == nil {
+					req.Factors = map[string]float64{}
+				}
+				req.Factors[name] = v
+			}
+			req.FactorJustification = cellByName(row, cols, "Justification")
+		}
+	}
+
+	// Relations (optional)
+	if relRows, err := f.GetRows("Relations"); err == nil && len(relRows) > 0 {
+		for _, row := range relRows[1:] {
+			if len(row) < 3 {
+				continue
+			}
+			var rel RequirementRelation
+			if rel.From, err = strconv.Atoi(row[0]); err != nil {
+				return nil, err
+			}
+			if rel.To, err = strconv.Atoi(row[1]); err != nil {
+				return nil, err
+			}
+			rel.Type = RelationType(row[2])
+			if len(row) > 3 && row[3] != "" {
+				if rel.Score, err = strconv.ParseFloat(row[3], 64); err != nil {
+					return nil, err
+				}
+			}
+			pd.RequirementRelations = append(pd.RequirementRelations, rel)
+		}
+	}
+
+	// Risks (optional)
+	if riskRows, err := f.GetRows("Risks"); err == nil && len(riskRows) > 0 {
+		for _, row := range riskRows[1:] {
+			if len(row) < 2 || row[1] == "" {
+				continue
+			}
+			var r Risk
+			ints := []struct {
+				col int
+				dst *int
+			}{{0, &r.ID}, {3, &r.Likelihood}, {4, &r.Impact}, {7, &r.ResidualLikelihood}, {8, &r.ResidualImpact}, {10, &r.IntelligenceID}}
+			for _, c := range ints {
+				if len(row) > c.col && row[c.col] != "" {
+					if *c.dst, err = strconv.Atoi(row[c.col]); err != nil {
+						return nil, err
+					}
+				}
+			}
+			r.Title = row[1]
+			if len(row) > 2 {
+				r.Description = row[2]
+			}
+			if len(row) > 5 {
+				r.Mitigation = row[5]
+			}
+			if len(row) > 6 {
+				r.Owner = row[6]
+			}
+			if len(row) > 9 && row[9] != "" {
+				for _, s := range strings.Split(row[9], ",") {
+					id, err := strconv.Atoi(strings.TrimSpace(s))
+					if err != nil {
+						return nil, err
+					}
+					r.RequirementIDs = append(r.RequirementIDs, id)
+				}
+			}
+			if len(row) > 11 {
+				r.Proposed = row[11] == "true"
+			}
+			pd.Risks = append(pd.Risks, r)
+		}
+	}
+
+	// Attributes (optional)
+	if attrRows, err := f.GetRows("Attributes"); err == nil && len(attrRows) > 0 {
+		for _, row := range attrRows[1:] {
+			if len(row) < 2 || row[0] == "" {
+				continue
+			}
+			d := AttributeDef{Name: row[0], Type: AttributeType(row[1])}
+			if len(row) > 2 && row[2] != "" {
+				d.Values = strings.Split(row[2], ",")
+			}
+			if len(row) > 3 {
+				d.Description = row[3]
+			}
+			pd.AttributeSchema = append(pd.AttributeSchema, d)
+		}
+	}
+
+	// Categories (optional)
+	if catRows, err := f.GetRows("Categories"); err == nil && len(catRows) > 0 {
+		for _, row := range catRows[1:] {
+			if len(row) < 1 || row[0] == "" {
+				continue
+			}
+			c := Category{Name: row[0]}
+			if len(row) > 1 {
+				c.Parent = row[1]
+			}
+			if len(row) > 2 {
+				c.Description = row[2]
+			}
+			pd.RequirementCategories = append(pd.RequirementCategories, c)
+		}
+	}
+
+	// Glossary (optional)
+	if glRows, err := f.GetRows("Glossary"); err == nil && len(glRows) > 0 {
+		for _, row := range glRows[1:] {
+			if len(row) < 1 || row[0] == "" {
+				continue
+			}
+			e := GlossaryEntry{Term: row[0]}
+			if len(row) > 1 {
+				e.Definition = row[1]
+			}
+			if len(row) > 2 && row[2] != "" {
+				e.Synonyms = strings.Split(row[2], ",")
+			}
+			if len(row) > 3 {
+				e.Expansion = row[3]
+			}
+			pd.Glossary = append(pd.Glossary, e)
+		}
+	}
+
 	// Intelligence (optional)
 	if intelRows, err := f.GetRows("Intelligence"); err == nil {
 		for _, row := range intelRows[1:] {
@@ -333,9 +713,22 @@ func ImportProjectExcel(path string) (*ProjectData, error) {
 }
 
 // ImportExcel merges data from an Excel workbook into the project. Existing
-// requirements are updated based on their ID, while new ones are appended. Any
-// requirements lacking an ID receive one based on the current maximum. When
-// replace is true, the current requirements are discarded and replaced by the
+// requirements are updated based on their key, or their ID for rows without a
+// key, while new ones are appended. Any requirements lacking an ID, or whose
+// ID is taken by another requirement, receive one based on the current
+// maximum. Parent IDs are translated like requirement IDs and levels are
+// derived again. Statuses are matched to workflow states without checking
+// transitions. With FixedCategories set, a workbook using categories outside
+// the catalog is rejected with ErrUnknownCategory; otherwise its "Categories"
+// sheet extends the catalog. The "Attributes" sheet likewise extends the
+// attribute schema, and attribute values that do not fit it reject the
+// workbook. Glossary entries are updated by term and new ones added. Risks
+// are updated by ID or added, with their requirement links translated like
+// relations; invalid ratings reject the workbook, as do scoring factors that
+// no model uses or that are out of range, and so do keys the project neither
+// holds nor issued (ErrForeignKey). Changes to existing requirements are
+// recorded in their history.
+// When replace is true, the current requirements are discarded and replaced by the
 // imported set.
 func (p *ProjectType) ImportExcel(path string, replace bool) error {
 	pd, err := ImportProjectExcel(path)
@@ -343,6 +736,68 @@ func (p *ProjectType) ImportExcel(path string, replace bool) error {
 		return err
 	}
 
+	// Attribute definitions missing from the project are added; values must
+	// fit the resulting schema.
+	schema := slices.Clone(p.D.AttributeSchema)
+	for _, d := range pd.AttributeSchema {
+		if _, ok := findAttributeDef(schema, d.Name); !ok {
+			if err := d.validate(); err != nil {
+				return err
+			}
+			schema = append(schema, d)
+		}
+	}
+	var attrErrs []error
+	for _, r := range pd.Requirements {
+		if err := validateAttributes(schema, r.Attributes); err != nil {
+			attrErrs = append(attrErrs, fmt.Errorf("requirement %d: %w", r.ID, err))
+		}
+	}
+	if err := errors.Join(attrErrs...); err != nil {
+		return err
+	}
+	for _, r := range pd.Risks {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range pd.Requirements {
+		if err := validateFactors(r.Factors); err != nil {
+			return fmt.Errorf("requirement %d: %w", r.ID, err)
+		}
+	}
+	if err := p.checkImportedKeys(pd.Requirements); err != nil {
+		return err
+	}
+
+	// A fixed catalog is managed in the project; reject the workbook before
+	// changing anything. Otherwise the workbook's categories are added.
+	if p.D.FixedCategories {
+		var errs []error
+		for _, r := range pd.Requirements {
+			if err := p.CheckCategory(r.Category); err != nil {
+				errs = append(errs, fmt.Errorf("requirement %d: %w", r.ID, err))
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range pd.RequirementCategories {
+			if _, ok := p.category(c.Name); !ok {
+				p.D.RequirementCategories = append(p.D.RequirementCategories, c)
+			}
+		}
+	}
+	p.D.AttributeSchema = schema
+	for _, e := range pd.Glossary {
+		if i := p.glossaryIndex(e.Term); i >= 0 {
+			p.D.Glossary[i] = e
+		} else {
+			p.D.Glossary = append(p.D.Glossary, e)
+		}
+	}
+
 	if pd.Name != "" {
 		p.D.Name = pd.Name
 	}
@@ -362,23 +817,189 @@ func (p *ProjectType) ImportExcel(path string, replace bool) error {
 		p.D.Priority = pd.Priority
 	}
 
+	// Statuses naming no workflow state, or one the deleted or active flag
+	// disagrees with, follow the condition flags; the replaced status is
+	// recorded in the requirement's history.
+	wf := p.Workflow()
+	for i := range pd.Requirements {
+		r := &pd.Requirements[i]
+		name, kept := wf.resolve(r.Status, r.Condition)
+		st, _ := wf.State(name)
+		old, before := r.Status, r.snapshot()
+		applyState(r, st)
+		if !kept && old != "" {
+			r.recordSince(before, p.user(), "status set from the condition flags")
+		}
+	}
+
 	if replace {
+		// Risks, test cases, comments and intelligence stay but lose links
+		// to requirements that are gone.
+		kept := make(map[int]bool, len(pd.Requirements))
+		for _, r := range pd.Requirements {
+			kept[r.ID] = true
+		}
+		for _, r := range p.D.Requirements {
+			if !kept[r.ID] {
+				p.forgetRequirement(r.ID, r.ParentID, "replaced by import")
+			}
+		}
 		p.D.Requirements = pd.Requirements
+		p.D.RequirementRelations = nil
 		p.ensureRequirementIDs()
-		return nil
+		if err := p.ensureHierarchy(); err != nil {
+			return err
+		}
+		p.importRisks(pd.Risks, nil)
+		return p.importRelations(pd.RequirementRelations, nil)
 	}
 
-	existing := make(map[int]*Requirement)
+	existing := make(map[int]int)
+	byKey := make(map[string]int)
 	for i := range p.D.Requirements {
-		existing[p.D.Requirements[i].ID] = &p.D.Requirements[i]
+		existing[p.D.Requirements[i].ID] = i
+		if k := p.D.Requirements[i].Key; k != "" {
+			byKey[k] = i
+		}
+	}
+	// ids maps workbook requirement IDs to project IDs for parents and
+	// relations.
+	ids := make(map[int]int, len(pd.Requirements))
+	type merge struct {
+		idx int
+		r   Requirement
 	}
+	var merges []merge
+	var added []Requirement
+	var addedFrom []int
 	for _, r := range pd.Requirements {
-		if ex, ok := existing[r.ID]; ok && r.ID != 0 {
-			*ex = r
+		wbID := r.ID
+		// Keys are stable across exports and moves; prefer them over IDs.
+		if i, ok := byKey[r.Key]; ok && r.Key != "" {
+			r.ID = p.D.Requirements[i].ID
+			merges = append(merges, merge{i, r})
+			ids[wbID] = r.ID
+		} else if i, ok := existing[r.ID]; ok && r.ID != 0 && r.Key == "" {
+			r.Key = p.D.Requirements[i].Key
+			merges = append(merges, merge{i, r})
+			ids[wbID] = r.ID
 		} else {
-			p.D.Requirements = append(p.D.Requirements, r)
+			if _, taken := existing[r.ID]; taken {
+				r.ID = 0
+			}
+			added = append(added, r)
+			addedFrom = append(addedFrom, wbID)
 		}
 	}
+	base := len(p.D.Requirements)
+	p.D.Requirements = append(p.D.Requirements, added...)
 	p.ensureRequirementIDs()
+	for i, wbID := range addedFrom {
+		ids[wbID] = p.D.Requirements[base+i].ID
+	}
+	// Parents outside the workbook are kept when the project has them.
+	parentOf := func(wbParent int) int {
+		if wbParent == 0 {
+			return 0
+		}
+		if id, ok := ids[wbParent]; ok {
+			return id
+		}
+		if _, ok := existing[wbParent]; ok {
+			return wbParent
+		}
+		return 0
+	}
+	for _, m := range merges {
+		ex := &p.D.Requirements[m.idx]
+		m.r.ParentID = parentOf(m.r.ParentID)
+		m.r.Level = ex.Level
+		p.mergeImported(ex, m.r)
+	}
+	for i := base; i < len(p.D.Requirements); i++ {
+		p.D.Requirements[i].ParentID = parentOf(p.D.Requirements[i].ParentID)
+	}
+	if err := p.ensureHierarchy(); err != nil {
+		return err
+	}
+	p.importRisks(pd.Risks, ids)
+	return p.importRelations(pd.RequirementRelations, ids)
+}
+
+// importRisks updates the risks with a workbook risk's ID and appends the
+// others with a new ID. Requirement IDs are translated through ids when it is
+// not nil; links to requirements the project lacks are dropped.
+func (p *ProjectType) importRisks(risks []Risk, ids map[int]int) {
+	for _, r := range risks {
+		linked := r.RequirementIDs
+		r.RequirementIDs = nil
+		for _, id := range linked {
+			if ids != nil {
+				var ok bool
+				if id, ok = ids[id]; !ok {
+					continue
+				}
+			}
+			if _, err := p.RequirementByID(id); err == nil && !slices.Contains(r.RequirementIDs, id) {
+				r.RequirementIDs = append(r.RequirementIDs, id)
+			}
+		}
+		if ex, err := p.RiskByID(r.ID); err == nil && r.ID != 0 {
+			*ex = r
+			continue
+		}
+		r.ID = p.nextRiskID()
+		p.D.Risks = append(p.D.Risks, r)
+	}
+}
+
+// importRelations adds the workbook's relations, translating requirement IDs
+// through ids when it is not nil. Relations to requirements missing from the
+// workbook are skipped.
+func (p *ProjectType) importRelations(rels []RequirementRelation, ids map[int]int) error {
+	for _, rel := range rels {
+		if ids != nil {
+			from, okF := ids[rel.From]
+			to, okT := ids[rel.To]
+			if !okF || !okT {
+				continue
+			}
+			rel.From, rel.To = from, to
+		}
+		if err := p.addRelation(rel); err != nil {
+			return fmt.Errorf("import relation %d %s %d: %w", rel.From, rel.Type, rel.To, err)
+		}
+	}
 	return nil
 }
+
+// mergeImported overwrites ex with the imported row r, keeping ex's history,
+// sign-offs and release, which workbooks do not carry, and recording the
+// changed fields in the history.
+func (p *ProjectType) mergeImported(ex *Requirement, r Requirement) {
+	before := ex.snapshot()
+	r.History = append(ex.History, r.History...)
+	r.Approvals = ex.Approvals
+	r.ReleaseID = ex.ReleaseID
+	*ex = r
+	ex.recordSince(before, p.user(), "imported from Excel")
+}
+
+// headerIndex maps the column names of a header row to their indexes.
+func headerIndex(header []string) map[string]int {
+	idx := make(map[string]int, len(header))
+	for i, h := range header {
+		idx[strings.TrimSpace(h)] = i
+	}
+	return idx
+}
+
+// cellByName returns the cell of row in the named column, or "" when the
+// column or cell is missing.
+func cellByName(row []string, cols map[string]int, name string) string {
+	i, ok := cols[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
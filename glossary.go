@@ -0,0 +1,258 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/rjboer/PMFS/pmfs/llm/gates"
+)
+
+var (
+	// ErrTermExists is returned when adding a glossary term twice.
+	ErrTermExists = errors.New("glossary term already exists")
+	// ErrTermNotFound is returned for terms missing from the glossary.
+	ErrTermNotFound = errors.New("glossary term not found")
+)
+
+// GlossaryEntry defines a term of the project's vocabulary. Acronyms carry
+// their Expansion, e.g. "Electronic Control Unit" for "ECU".
+type GlossaryEntry struct {
+	Term       string   `json:"term" toml:"term"`
+	Definition string   `json:"definition" toml:"definition"`
+	Synonyms   []string `json:"synonyms,omitempty" toml:"synonyms"`
+	Expansion  string   `json:"expansion,omitempty" toml:"expansion"`
+}
+
+// names returns the term with its synonyms and expansion.
+func (e GlossaryEntry) names() []string {
+	out := append([]string{e.Term}, e.Synonyms...)
+	if e.Expansion != "" {
+		out = append(out, e.Expansion)
+	}
+	return out
+}
+
+// String renders the entry as one glossary line.
+func (e GlossaryEntry) String() string {
+	s := e.Term
+	var notes []string
+	if e.Expansion != "" {
+		notes = append(notes, e.Expansion)
+	}
+	if len(e.Synonyms) > 0 {
+		notes = append(notes, "also: "+strings.Join(e.Synonyms, ", "))
+	}
+	if len(notes) > 0 {
+		s += " (" + strings.Join(notes, "; ") + ")"
+	}
+	return s + ": " + e.Definition
+}
+
+// glossaryIndex returns the position of the entry with the given term.
+func (prj *ProjectType) glossaryIndex(term string) int {
+	return slices.IndexFunc(prj.D.Glossary, func(e GlossaryEntry) bool { return strings.EqualFold(e.Term, term) })
+}
+
+// Glossary returns the project's glossary in the order added.
+func (prj *ProjectType) Glossary() []GlossaryEntry {
+	return append([]GlossaryEntry{}, prj.D.Glossary...)
+}
+
+// AddTerm adds e to the glossary and persists the project. Terms are unique
+// regardless of case.
+func (prj *ProjectType) AddTerm(e GlossaryEntry) error {
+	e.Term = strings.TrimSpace(e.Term)
+	if e.Term == "" {
+		return errors.New("glossary term is empty")
+	}
+	if prj.glossaryIndex(e.Term) >= 0 {
+		return fmt.Errorf("%s: %w", e.Term, ErrTermExists)
+	}
+	prj.D.Glossary = append(prj.D.Glossary, e)
+	return prj.Save()
+}
+
+// UpdateTerm replaces the entry with e's term and persists the project.
+func (prj *ProjectType) UpdateTerm(e GlossaryEntry) error {
+	e.Term = strings.TrimSpace(e.Term)
+	i := prj.glossaryIndex(e.Term)
+	if i < 0 {
+		return fmt.Errorf("%s: %w", e.Term, ErrTermNotFound)
+	}
+	prj.D.Glossary[i] = e
+	return prj.Save()
+}
+
+// RemoveTerm drops the term from the glossary and persists the project.
+func (prj *ProjectType) RemoveTerm(term string) error {
+	i := prj.glossaryIndex(term)
+	if i < 0 {
+		return fmt.Errorf("%s: %w", term, ErrTermNotFound)
+	}
+	prj.D.Glossary = slices.Delete(prj.D.Glossary, i, i+1)
+	return prj.Save()
+}
+
+// LookupTerm returns the entry defining word as its term, a synonym or its
+// expansion, ignoring case.
+func (prj *ProjectType) LookupTerm(word string) (GlossaryEntry, bool) {
+	word = strings.TrimSpace(word)
+	for _, e := range prj.D.Glossary {
+		for _, n := range e.names() {
+			if strings.EqualFold(n, word) {
+				return e, true
+			}
+		}
+	}
+	return GlossaryEntry{}, false
+}
+
+// gateContext returns the project data passed to quality gates.
+func (prj *ProjectType) gateContext() gates.Context {
+	if len(prj.D.Glossary) == 0 {
+		return nil
+	}
+	lines := []string{"Project glossary:"}
+	for _, e := range prj.D.Glossary {
+		lines = append(lines, "- "+e.String())
+	}
+	return gates.Context{"glossary": strings.Join(lines, "\n")}
+}
+
+// TermSpan is a term found in text, at byte offsets [Start, End).
+type TermSpan struct {
+	Term    string `json:"term"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Acronym bool   `json:"acronym"`
+}
+
+var (
+	// termPattern matches runs of capitalized words, such as
+	// "Emergency Stop Button", and acronyms, such as "ECU" or "ISO26262".
+	termPattern = regexp.MustCompile(`\b[A-Z][\w-]*(?:[ \t]+[A-Z][\w-]*)*`)
+	wordPattern = regexp.MustCompile(`[^ \t]+`)
+	// sentenceStarters are capitalized only for starting a sentence.
+	sentenceStarters = []string{"a", "an", "the", "this", "that", "these", "those", "each", "every", "all", "any", "if", "when", "it", "i"}
+)
+
+// isAcronym reports whether word is mostly upper case, e.g. "ECU", "ECUs" or
+// "ISO26262".
+func isAcronym(word string) bool {
+	upper := 0
+	for _, r := range strings.TrimSuffix(word, "s") {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case !unicode.IsDigit(r):
+			return false
+		}
+	}
+	return upper >= 2
+}
+
+// ScanTerms finds capitalized terms and acronyms in text that the glossary
+// does not define, without asking the LLM. Runs of capitalized words form
+// one term and acronyms are terms of their own. Words capitalized only for
+// opening a sentence are skipped, and plural acronyms such as "ECUs" are
+// looked up in the singular.
+func (prj *ProjectType) ScanTerms(text string) []TermSpan {
+	out := []TermSpan{}
+	for _, run := range termPattern.FindAllStringIndex(text, -1) {
+		for _, span := range splitTermRun(text, run[0], run[1]) {
+			if !span.Acronym && sentenceStart(text, span.Start) {
+				var ok bool
+				if span, ok = dropSentenceStarter(text, span); !ok {
+					continue
+				}
+			}
+			if !prj.defined(span.Term, span.Acronym) {
+				out = append(out, span)
+			}
+		}
+	}
+	return out
+}
+
+// splitTermRun splits text[start:end] into acronyms and runs of the other
+// capitalized words between them.
+func splitTermRun(text string, start, end int) []TermSpan {
+	var out []TermSpan
+	cur := TermSpan{Start: -1}
+	flush := func() {
+		if cur.Start >= 0 {
+			cur.Term = text[cur.Start:cur.End]
+			out = append(out, cur)
+		}
+		cur = TermSpan{Start: -1}
+	}
+	for _, w := range wordPattern.FindAllStringIndex(text[start:end], -1) {
+		ws, we := start+w[0], start+w[1]
+		if isAcronym(text[ws:we]) {
+			flush()
+			out = append(out, TermSpan{Term: text[ws:we], Start: ws, End: we, Acronym: true})
+			continue
+		}
+		if cur.Start < 0 {
+			cur.Start = ws
+		}
+		cur.End = we
+	}
+	flush()
+	return out
+}
+
+// dropSentenceStarter removes the capitalized first word of a span opening a
+// sentence when it is a lone word or a common sentence starter. It reports
+// false when nothing remains.
+func dropSentenceStarter(text string, span TermSpan) (TermSpan, bool) {
+	words := wordPattern.FindAllStringIndex(span.Term, -1)
+	if len(words) == 1 {
+		return span, false
+	}
+	if slices.Contains(sentenceStarters, strings.ToLower(span.Term[words[0][0]:words[0][1]])) {
+		span.Start += words[1][0]
+		span.Term = text[span.Start:span.End]
+	}
+	return span, true
+}
+
+// defined reports whether the glossary covers term.
+func (prj *ProjectType) defined(term string, acronym bool) bool {
+	if _, ok := prj.LookupTerm(term); ok {
+		return true
+	}
+	if acronym && strings.HasSuffix(term, "s") {
+		_, ok := prj.LookupTerm(strings.TrimSuffix(term, "s"))
+		return ok
+	}
+	return false
+}
+
+// sentenceStart reports whether the text before offset i ends a sentence.
+func sentenceStart(text string, i int) bool {
+	before := strings.TrimRightFunc(text[:i], unicode.IsSpace)
+	return before == "" || strings.ContainsAny(before[len(before)-1:], ".!?:;")
+}
+
+// GlossaryGaps scans the description of every requirement that is not
+// deleted with ScanTerms and returns the undefined terms by requirement ID,
+// each once. Requirements without gaps are left out.
+func (prj *ProjectType) GlossaryGaps() map[int][]string {
+	out := map[int][]string{}
+	for _, r := range prj.D.Requirements {
+		if r.Condition.Deleted {
+			continue
+		}
+		for _, span := range prj.ScanTerms(r.Description) {
+			if !slices.Contains(out[r.ID], span.Term) {
+				out[r.ID] = append(out[r.ID], span.Term)
+			}
+		}
+	}
+	return out
+}
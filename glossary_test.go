@@ -0,0 +1,93 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestScanTerms(t *testing.T) {
+	prj := &ProjectType{D: ProjectData{Glossary: []GlossaryEntry{
+		{Term: "ECU", Expansion: "Electronic Control Unit"},
+		{Term: "Emergency Stop", Synonyms: []string{"E-Stop"}},
+	}}}
+	text := "The Emergency Stop shall halt all ECUs via the CAN bus. Operators use the Safety Panel. E-Stop and Electronic Control Unit are defined."
+	var got []string
+	for _, s := range prj.ScanTerms(text) {
+		if text[s.Start:s.End] != s.Term {
+			t.Fatalf("span %v does not match text", s)
+		}
+		got = append(got, s.Term)
+	}
+	if strings.Join(got, "|") != "CAN|Safety Panel" {
+		t.Fatalf("ScanTerms = %q", got)
+	}
+	if spans := prj.ScanTerms("Braking Distance is measured by the TCU."); len(spans) != 2 || spans[0].Term != "Braking Distance" || !spans[1].Acronym {
+		t.Fatalf("ScanTerms = %#v", spans)
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	db, prj, _ := newKeysDB(t)
+	if err := prj.AddTerm(GlossaryEntry{Term: "ECU", Definition: "Controls a subsystem.", Expansion: "Electronic Control Unit"}); err != nil {
+		t.Fatalf("AddTerm: %v", err)
+	}
+	if err := prj.AddTerm(GlossaryEntry{Term: "ecu"}); !errors.Is(err, ErrTermExists) {
+		t.Fatalf("expected ErrTermExists, got %v", err)
+	}
+	if err := prj.AddTerm(GlossaryEntry{Term: "HMI", Definition: "Operator screen."}); err != nil {
+		t.Fatalf("AddTerm: %v", err)
+	}
+	if err := prj.UpdateTerm(GlossaryEntry{Term: "HMI", Definition: "Operator screen.", Synonyms: []string{"Panel"}}); err != nil {
+		t.Fatalf("UpdateTerm: %v", err)
+	}
+	if e, ok := prj.LookupTerm("panel"); !ok || e.Term != "HMI" {
+		t.Fatalf("LookupTerm = %#v, %v", e, ok)
+	}
+	if err := prj.RemoveTerm("PLC"); !errors.Is(err, ErrTermNotFound) {
+		t.Fatalf("expected ErrTermNotFound, got %v", err)
+	}
+	if err := prj.AddRequirement(Requirement{Name: "R1", Description: "The ECU reports faults to the Maintenance Log."}); err != nil {
+		t.Fatalf("AddRequirement: %v", err)
+	}
+	if gaps := prj.GlossaryGaps(); len(gaps) != 1 || strings.Join(gaps[prj.D.Requirements[0].ID], "|") != "Maintenance Log" {
+		t.Fatalf("GlossaryGaps = %v", gaps)
+	}
+
+	// Glossary gates are asked with the glossary; other gates are not.
+	var prompts []string
+	db.LLM = gemini.ClientFunc{AskFunc: func(p string) (string, error) {
+		prompts = append(prompts, p)
+		return "Yes", nil
+	}}
+	if err := prj.EvaluateGates(prj.D.Requirements[0].ID, []string{"glossary-gaps-1", "clarity-form-1"}); err != nil {
+		t.Fatalf("EvaluateGates: %v", err)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[0], "Project glossary:\n- ECU (Electronic Control Unit): Controls a subsystem.\n- HMI (also: Panel): Operator screen.") {
+		t.Fatalf("glossary missing from prompt: %q", prompts)
+	}
+	if strings.Contains(prompts[1], "glossary") {
+		t.Fatalf("glossary sent to an unrelated gate: %q", prompts[1])
+	}
+	if !prj.D.Requirements[0].Condition.GateResults["glossary-gaps-1"] {
+		t.Fatalf("gate result not stored: %#v", prj.D.Requirements[0].Condition)
+	}
+
+	// The glossary round-trips through Excel and is merged by term.
+	path := filepath.Join(t.TempDir(), "glossary.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	if err := prj.RemoveTerm("HMI"); err != nil {
+		t.Fatalf("RemoveTerm: %v", err)
+	}
+	if err := prj.ImportExcel(path, false); err != nil {
+		t.Fatalf("ImportExcel: %v", err)
+	}
+	if g := prj.Glossary(); len(g) != 2 || g[1].Term != "HMI" || len(g[1].Synonyms) != 1 || g[1].Synonyms[0] != "Panel" {
+		t.Fatalf("glossary not imported: %#v", g)
+	}
+}
@@ -0,0 +1,250 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Requirement hierarchy: ParentID holds the ID of the parent requirement, 0
+// for top-level requirements. Level is derived from it on every save, 1 for
+// top-level requirements. Parents that no longer exist are treated as the top
+// level; ValidateHierarchy reports them.
+
+// ErrHierarchyCycle is returned when parent references would form a cycle.
+var ErrHierarchyCycle = errors.New("requirement hierarchy contains a cycle")
+
+// hierarchyLevels derives the level of every requirement from the parent map
+// (ID -> parent ID). Requirements whose parent is 0 or unknown are at level 1.
+// When parent references form a cycle, the IDs on the first cycle found are
+// returned in ascending order instead.
+func hierarchyLevels(parent map[int]int) (map[int]int, []int) {
+	ids := make([]int, 0, len(parent))
+	for id := range parent {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	levels := make(map[int]int, len(parent))
+	for _, id := range ids {
+		// Walk up to a requirement with a known level or a root, then
+		// assign levels on the way back down.
+		var path []int
+		onPath := map[int]bool{}
+		for n := id; n != 0; n = parent[n] {
+			if _, ok := levels[n]; ok {
+				break
+			}
+			if _, ok := parent[n]; !ok {
+				break
+			}
+			if onPath[n] {
+				return nil, cycleMembers(parent, n)
+			}
+			onPath[n] = true
+			path = append(path, n)
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			levels[path[i]] = levels[parent[path[i]]] + 1 // 0 for roots and unknown parents
+		}
+	}
+	return levels, nil
+}
+
+// cycleMembers returns the IDs on the cycle through start, ascending.
+func cycleMembers(parent map[int]int, start int) []int {
+	out := []int{start}
+	for n := parent[start]; n != start; n = parent[n] {
+		out = append(out, n)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// parentMap returns the requirement ID -> parent ID map of the project.
+// Requirements without an ID yet are left out.
+func (prj *ProjectType) parentMap() map[int]int {
+	parent := make(map[int]int, len(prj.D.Requirements))
+	for _, r := range prj.D.Requirements {
+		if r.ID != 0 {
+			parent[r.ID] = r.ParentID
+		}
+	}
+	return parent
+}
+
+// ensureHierarchy derives Level for every requirement. It fails with
+// ErrHierarchyCycle, changing nothing, when parent references form a cycle.
+func (prj *ProjectType) ensureHierarchy() error {
+	levels, cyclic := hierarchyLevels(prj.parentMap())
+	if len(cyclic) > 0 {
+		return fmt.Errorf("requirements %v: %w", cyclic, ErrHierarchyCycle)
+	}
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		if r.ID != 0 {
+			r.Level = levels[r.ID]
+		} else {
+			r.Level = levels[r.ParentID] + 1
+		}
+	}
+	return nil
+}
+
+// ValidateHierarchy reports parent references to unknown requirements and
+// cycles. Save rejects cycles but keeps dangling parents, which can remain
+// after requirements are moved or dropped.
+func (prj *ProjectType) ValidateHierarchy() error {
+	var errs []error
+	parent := prj.parentMap()
+	for _, r := range prj.D.Requirements {
+		if _, ok := parent[r.ParentID]; r.ParentID != 0 && !ok {
+			errs = append(errs, fmt.Errorf("requirement %d: parent %d: %w", r.ID, r.ParentID, ErrRequirementNotFound))
+		}
+	}
+	if _, cyclic := hierarchyLevels(parent); len(cyclic) > 0 {
+		errs = append(errs, fmt.Errorf("requirements %v: %w", cyclic, ErrHierarchyCycle))
+	}
+	return errors.Join(errs...)
+}
+
+// Roots returns the top-level requirements in project order.
+func (prj *ProjectType) Roots() []Requirement {
+	return prj.Children(0)
+}
+
+// Children returns the direct children of the requirement in project order.
+// Children(0) returns the top-level requirements.
+func (prj *ProjectType) Children(id int) []Requirement {
+	out := []Requirement{}
+	for _, r := range prj.D.Requirements {
+		if r.ParentID == id && r.ID != id {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Ancestors returns the parent of the requirement, its parent and so on up
+// to the top level.
+func (prj *ProjectType) Ancestors(id int) ([]Requirement, error) {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return nil, err
+	}
+	out := []Requirement{}
+	seen := map[int]bool{id: true}
+	for p := r.ParentID; p != 0; {
+		if seen[p] {
+			return nil, fmt.Errorf("requirement %d: %w", p, ErrHierarchyCycle)
+		}
+		seen[p] = true
+		pr, err := prj.RequirementByID(p)
+		if err != nil {
+			break
+		}
+		out = append(out, *pr)
+		p = pr.ParentID
+	}
+	return out, nil
+}
+
+// Subtree returns the requirement followed by all its descendants, depth
+// first in project order.
+func (prj *ProjectType) Subtree(id int) ([]Requirement, error) {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return nil, err
+	}
+	out := []Requirement{*r}
+	seen := map[int]bool{id: true}
+	var walk func(int)
+	walk = func(p int) {
+		for _, c := range prj.Children(p) {
+			if seen[c.ID] {
+				continue
+			}
+			seen[c.ID] = true
+			out = append(out, c)
+			walk(c.ID)
+		}
+	}
+	walk(id)
+	return out, nil
+}
+
+// MoveSubtree places the requirement, together with all its descendants,
+// under parentID (0 for the top level) and persists the project. Moving a
+// requirement below itself or one of its descendants fails with
+// ErrHierarchyCycle. The change is made through Update, so the project is
+// left unchanged when it fails.
+func (prj *ProjectType) MoveSubtree(id, parentID int) error {
+	return prj.Update(func(tx *ProjectTx) error { return tx.work.setParent(id, parentID, "moved subtree") })
+}
+
+// Reparent places only the requirement under parentID (0 for the top level)
+// and persists the project. Its children stay where they are in the tree and
+// are attached to the requirement's former parent. The change is made through
+// Update, so the project is left unchanged when it fails.
+func (prj *ProjectType) Reparent(id, parentID int) error {
+	return prj.Update(func(tx *ProjectTx) error { return tx.work.reparent(id, parentID) })
+}
+
+// reparent implements Reparent without saving.
+func (prj *ProjectType) reparent(id, parentID int) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	if parentID == id {
+		return fmt.Errorf("move %d below itself: %w", id, ErrHierarchyCycle)
+	}
+	if parentID != 0 {
+		if _, err := prj.RequirementByID(parentID); err != nil {
+			return err
+		}
+	}
+	prj.detachChildren(id, r.ParentID, fmt.Sprintf("parent %d reparented", id))
+	return prj.setParent(id, parentID, "reparented")
+}
+
+// detachChildren attaches the direct children of the requirement to parentID.
+func (prj *ProjectType) detachChildren(id, parentID int, comment string) {
+	for i := range prj.D.Requirements {
+		c := &prj.D.Requirements[i]
+		if c.ParentID == id && c.ID != id {
+			before := c.snapshot()
+			c.ParentID = parentID
+			c.recordSince(before, prj.user(), comment)
+		}
+	}
+}
+
+// setParent changes the parent of the requirement after checking the new
+// parent exists and is not within its subtree.
+func (prj *ProjectType) setParent(id, parentID int, comment string) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	if parentID != 0 {
+		if _, err := prj.RequirementByID(parentID); err != nil {
+			return err
+		}
+		sub, err := prj.Subtree(id)
+		if err != nil {
+			return err
+		}
+		for _, s := range sub {
+			if s.ID == parentID {
+				return fmt.Errorf("move %d below %d: %w", id, parentID, ErrHierarchyCycle)
+			}
+		}
+	}
+	before := r.snapshot()
+	r.ParentID = parentID
+	if err := prj.ensureHierarchy(); err != nil {
+		return err
+	}
+	r.recordSince(before, prj.user(), comment)
+	return nil
+}
@@ -0,0 +1,155 @@
+package PMFS
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reqIDs returns the IDs of reqs in order.
+func reqIDs(reqs []Requirement) []int {
+	out := make([]int, len(reqs))
+	for i, r := range reqs {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func sameIDs(got []int, want ...int) bool {
+	return slices.Equal(got, want)
+}
+
+func TestHierarchy(t *testing.T) {
+	// 1 -> 2 -> 3, 4 at the top level.
+	prj := newRelationsProject(t)
+	prj.D.Requirements[1].ParentID = 1
+	prj.D.Requirements[2].ParentID = 2
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if r := prj.D.Requirements; r[0].Level != 1 || r[1].Level != 2 || r[2].Level != 3 || r[3].Level != 1 {
+		t.Fatalf("levels not derived: %#v", r)
+	}
+	if got := reqIDs(prj.Roots()); !sameIDs(got, 1, 4) {
+		t.Fatalf("Roots = %v", got)
+	}
+	if got := reqIDs(prj.Children(2)); !sameIDs(got, 3) {
+		t.Fatalf("Children = %v", got)
+	}
+	anc, err := prj.Ancestors(3)
+	if err != nil || !sameIDs(reqIDs(anc), 2, 1) {
+		t.Fatalf("Ancestors = %v, %v", reqIDs(anc), err)
+	}
+	if err := prj.MoveSubtree(1, 3); !errors.Is(err, ErrHierarchyCycle) {
+		t.Fatalf("expected ErrHierarchyCycle, got %v", err)
+	}
+	if err := prj.MoveSubtree(1, 9); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected ErrRequirementNotFound, got %v", err)
+	}
+	if r, _ := prj.RequirementByID(1); r.ParentID != 0 || len(r.History) != 0 {
+		t.Fatalf("failed moves changed the requirement: %#v", r)
+	}
+
+	// The subtree of 2 follows it under 4.
+	if err := prj.MoveSubtree(2, 4); err != nil {
+		t.Fatalf("MoveSubtree: %v", err)
+	}
+	sub, err := prj.Subtree(4)
+	if err != nil || !sameIDs(reqIDs(sub), 4, 2, 3) {
+		t.Fatalf("Subtree = %v, %v", reqIDs(sub), err)
+	}
+	if r, _ := prj.RequirementByID(3); r.Level != 3 {
+		t.Fatalf("level not updated: %#v", r)
+	}
+
+	// Reparent leaves 3 under 4 and moves 2 below it.
+	if err := prj.Reparent(2, 3); err != nil {
+		t.Fatalf("Reparent: %v", err)
+	}
+	anc, _ = prj.Ancestors(2)
+	if !sameIDs(reqIDs(anc), 3, 4) {
+		t.Fatalf("Ancestors after Reparent = %v", reqIDs(anc))
+	}
+	if r, _ := prj.RequirementByID(2); len(r.History) == 0 {
+		t.Fatalf("reparent not recorded: %#v", r)
+	}
+	if err := prj.ValidateHierarchy(); err != nil {
+		t.Fatalf("ValidateHierarchy: %v", err)
+	}
+
+	prj.D.Requirements[3].ParentID = 2
+	if err := prj.Save(); !errors.Is(err, ErrHierarchyCycle) {
+		t.Fatalf("expected Save to reject a cycle, got %v", err)
+	}
+	// A failed Reparent leaves the children where they were.
+	if err := prj.Reparent(3, 1); !errors.Is(err, ErrHierarchyCycle) {
+		t.Fatalf("expected Reparent to reject a cycle, got %v", err)
+	}
+	if r, _ := prj.RequirementByID(2); r.ParentID != 3 {
+		t.Fatalf("failed Reparent changed the project: %#v", r)
+	}
+	prj.D.Requirements[3].ParentID = 9
+	if err := prj.ValidateHierarchy(); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected dangling parent to be reported, got %v", err)
+	}
+}
+
+func TestMigrateParentIndexToID(t *testing.T) {
+	s := NewMemoryStore()
+	s.put(indexKey(), []byte(legacyIndex))
+	s.put(projectFileKey(1, 1), []byte(`schema_version = 3
+id = 1
+productid = 1
+
+[projectdata]
+[[projectdata.requirements]]
+id = 5
+parent_id = -1
+
+[[projectdata.requirements]]
+id = 7
+parent_id = 0
+
+[[projectdata.requirements]]
+id = 9
+parent_id = 1
+
+[[projectdata.requirements]]
+id = 11
+parent_id = 8
+
+[[projectdata.requirements]]
+id = 13
+parent_id = 0
+level = 1
+
+[[projectdata.requirements]]
+id = 15
+parent_id = 0
+[projectdata.requirements.condition]
+aigenerated = true
+`))
+	rep, err := PlanMigrations(s)
+	if err != nil {
+		t.Fatalf("PlanMigrations: %v", err)
+	}
+	if !strings.Contains(rep.String(), "requirements[5]: parent_id 0 is ambiguous") {
+		t.Fatalf("ambiguous parent not reported:\n%s", rep)
+	}
+	db, err := Open(s)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	prj, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	r := prj.D.Requirements
+	if r[0].ParentID != 0 || r[1].ParentID != 0 || r[2].ParentID != 7 || r[3].ParentID != 0 || r[4].ParentID != 5 || r[5].ParentID != 0 {
+		t.Fatalf("parents not converted: %#v", r)
+	}
+	if r[2].Level != 2 || r[3].Level != 1 {
+		t.Fatalf("levels not derived: %#v", r)
+	}
+}
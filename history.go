@@ -0,0 +1,154 @@
+package PMFS
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Actors recorded in ChangeLog.User for changes not made by a named user.
+const (
+	// ActorSystem is recorded when the database has no User set.
+	ActorSystem = "system"
+	// ActorAI is recorded for changes decided by the LLM, such as gate
+	// results and merged duplicates.
+	ActorAI = "ai"
+)
+
+// FieldChange is a single field changed by a ChangeLog entry. Field is the
+// JSON path of the field, e.g. "condition.active". Values are rendered as
+// text; composite values are rendered as JSON.
+type FieldChange struct {
+	Field  string `json:"field" toml:"field"`
+	Before string `json:"before" toml:"before"`
+	After  string `json:"after" toml:"after"`
+}
+
+// fieldValue is a rendered field of a requirement snapshot.
+type fieldValue struct {
+	name, value string
+}
+
+// historyIgnored lists the fields left out of change history: the history
+// itself and the timestamp bumped by every recorded change.
+var historyIgnored = map[string]bool{"history": true, "updated_at": true}
+
+// snapshot renders every tracked field of r. Snapshots are plain strings, so
+// later in-place changes to maps or slices of r do not leak into them.
+func (r *Requirement) snapshot() []fieldValue {
+	var out []fieldValue
+	flattenFields(reflect.ValueOf(*r), "", &out)
+	return out
+}
+
+func flattenFields(v reflect.Value, prefix string, out *[]fieldValue) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		name = prefix + name
+		if historyIgnored[name] {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			flattenFields(fv, name+".", out)
+			continue
+		}
+		*out = append(*out, fieldValue{name, renderField(fv)})
+	}
+}
+
+// renderField formats a field value for FieldChange.
+func renderField(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Pointer, reflect.Struct, reflect.Array:
+		if t, ok := v.Interface().(time.Time); ok {
+			if t.IsZero() {
+				return ""
+			}
+			return t.UTC().Format(time.RFC3339)
+		}
+		if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+			return ""
+		}
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprint(v.Interface())
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// diffSnapshots returns the fields whose values differ between two snapshots
+// of the same requirement.
+func diffSnapshots(before, after []fieldValue) []FieldChange {
+	var out []FieldChange
+	for i := range after {
+		if before[i].value != after[i].value {
+			out = append(out, FieldChange{Field: after[i].name, Before: before[i].value, After: after[i].value})
+		}
+	}
+	return out
+}
+
+// recordSince appends a ChangeLog entry for the fields changed since before
+// was taken and bumps UpdatedAt. Nothing is recorded when no field changed.
+func (r *Requirement) recordSince(before []fieldValue, user, comment string) {
+	changes := diffSnapshots(before, r.snapshot())
+	if len(changes) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	r.UpdatedAt = now
+	r.History = append(r.History, ChangeLog{Timestamp: now, User: user, Comment: comment, Fields: changes})
+}
+
+// track runs fn and records the fields it changed on r, even when fn fails
+// part way.
+func (r *Requirement) track(user, comment string, fn func() error) error {
+	before := r.snapshot()
+	err := fn()
+	r.recordSince(before, user, comment)
+	return err
+}
+
+// RecordChange appends a ChangeLog entry to r for every field that differs
+// from before, typically a copy of r taken before it was edited. It reports
+// whether anything changed.
+func (r *Requirement) RecordChange(before Requirement, user, comment string) bool {
+	n := len(r.History)
+	r.recordSince(before.snapshot(), user, comment)
+	return len(r.History) > n
+}
+
+// Timeline returns the requirement's change history, oldest first.
+func (r *Requirement) Timeline() []ChangeLog {
+	out := append([]ChangeLog(nil), r.History...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
+
+// user returns the name recorded for changes made through the database.
+func (db *Database) user() string {
+	if db.User != "" {
+		return db.User
+	}
+	return ActorSystem
+}
+
+// user returns the name recorded for changes made through the project.
+func (prj *ProjectType) user() string {
+	return prj.database().user()
+}
@@ -0,0 +1,134 @@
+package PMFS
+
+import (
+	"path/filepath"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+// lastChange returns the newest history entry of r, failing when there is none.
+func lastChange(t *testing.T, r *Requirement) ChangeLog {
+	t.Helper()
+	tl := r.Timeline()
+	if len(tl) == 0 {
+		t.Fatalf("no history recorded for %q", r.Name)
+	}
+	return tl[len(tl)-1]
+}
+
+func TestMutatorsRecordHistory(t *testing.T) {
+	db, prj, _ := newKeysDB(t)
+	db.User = "alice"
+	prj.D.Requirements = []Requirement{{ID: 1, Name: "R1", Condition: ConditionType{Proposed: true}}}
+
+	if err := prj.ActivateRequirementByID(1); err != nil {
+		t.Fatalf("ActivateRequirementByID: %v", err)
+	}
+	r := &prj.D.Requirements[0]
+	ch := lastChange(t, r)
+	if ch.User != "alice" || len(ch.Fields) != 3 {
+		t.Fatalf("unexpected entry: %#v", ch)
+	}
+	if f := ch.Fields[0]; f.Field != "status" || f.Before != "" || f.After != "Approved" {
+		t.Fatalf("unexpected field change: %#v", f)
+	}
+	if f := ch.Fields[2]; f.Field != "condition.active" || f.Before != "false" || f.After != "true" {
+		t.Fatalf("unexpected field change: %#v", f)
+	}
+
+	if err := prj.DeleteRequirementByID(1); err != nil {
+		t.Fatalf("DeleteRequirementByID: %v", err)
+	}
+	if err := prj.RestoreRequirementByID(1); err != nil {
+		t.Fatalf("RestoreRequirementByID: %v", err)
+	}
+	if tl := r.Timeline(); len(tl) != 3 || tl[1].Comment != "deleted" || tl[2].Comment != "restored" {
+		t.Fatalf("unexpected timeline: %#v", tl)
+	}
+
+	// Unchanged fields are not recorded.
+	prj.RestoreRequirementByID(1)
+	if len(r.History) != 3 {
+		t.Fatalf("no-op restore recorded: %#v", r.History)
+	}
+
+	// History survives a reload.
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(prj.D.Requirements[0].History) != 3 {
+		t.Fatalf("history not persisted: %#v", prj.D.Requirements[0].History)
+	}
+}
+
+func TestEvaluateGatesRecordsAI(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "test-key")
+	if _, err := LoadSetup(t.TempDir()); err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	DB.LLM = gemini.ClientFunc{AskFunc: func(prompt string) (string, error) {
+		return "yes", nil
+	}}
+	r := Requirement{Description: "The belt moves boxes."}
+	if err := r.EvaluateGates([]string{"clarity-form-1"}); err != nil {
+		t.Fatalf("EvaluateGates: %v", err)
+	}
+	ch := lastChange(t, &r)
+	if ch.User != ActorAI {
+		t.Fatalf("user = %q, want %q", ch.User, ActorAI)
+	}
+	found := false
+	for _, f := range ch.Fields {
+		found = found || f.Field == "condition.gates"
+	}
+	if !found {
+		t.Fatalf("gate results not recorded: %#v", ch.Fields)
+	}
+}
+
+func TestImportExcelRecordsMergedFields(t *testing.T) {
+	_, prj, _ := newKeysDB(t)
+	prj.D.Requirements = []Requirement{{Name: "R1", Description: "old"}}
+	prj.ensureRequirementIDs()
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "prj.xlsx")
+	prj.D.Requirements[0].Description = "new"
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	prj.D.Requirements[0].Description = "old"
+	prj.D.Requirements[0].History = []ChangeLog{{Comment: "earlier"}}
+
+	if err := prj.ImportExcel(path, false); err != nil {
+		t.Fatalf("ImportExcel: %v", err)
+	}
+	r := &prj.D.Requirements[0]
+	if len(r.History) != 2 || r.History[0].Comment != "earlier" {
+		t.Fatalf("history not kept: %#v", r.History)
+	}
+	ch := r.History[1]
+	if len(ch.Fields) != 1 || ch.Fields[0] != (FieldChange{Field: "description", Before: "old", After: "new"}) {
+		t.Fatalf("unexpected import entry: %#v", ch.Fields)
+	}
+}
+
+func TestRecordChange(t *testing.T) {
+	r := Requirement{Name: "R1", Tags: []string{"a"}}
+	before := r
+	if r.RecordChange(before, "bob", "noop") {
+		t.Fatalf("unchanged requirement recorded")
+	}
+	r.Tags = []string{"a", "b"}
+	if !r.RecordChange(before, "bob", "tagged") {
+		t.Fatalf("change not recorded")
+	}
+	if f := r.History[0].Fields[0]; f.Field != "tags" || f.Before != `["a"]` || f.After != `["a","b"]` {
+		t.Fatalf("unexpected field change: %#v", f)
+	}
+	if r.UpdatedAt.IsZero() {
+		t.Fatalf("UpdatedAt not bumped")
+	}
+}
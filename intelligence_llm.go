@@ -3,18 +3,20 @@ package PMFS
 import (
 	"encoding/json"
 	"fmt"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
 )
 
 // summarizeContent asks the LLM to summarize the given content.
-func summarizeContent(content string) (string, error) {
+func summarizeContent(c llm.Client, content string) (string, error) {
 	prompt := fmt.Sprintf("Summarize the following content:\n%s", content)
-	return DB.LLM.Ask(prompt)
+	return c.Ask(prompt)
 }
 
 // designAspectsFromSummary asks the LLM for design improvement topics based on the summary.
-func designAspectsFromSummary(summary string) ([]DesignAspect, error) {
+func designAspectsFromSummary(c llm.Client, summary string) ([]DesignAspect, error) {
 	prompt := fmt.Sprintf("Given the intelligence summary %q, list design improvement topics (JSON array with `name` and `description`).", summary)
-	resp, err := DB.LLM.Ask(prompt)
+	resp, err := c.Ask(prompt)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,224 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+var (
+	// ErrRequirementNotFound is returned when no requirement matches an ID or
+	// key.
+	ErrRequirementNotFound = errors.New("requirement not found")
+	// ErrDuplicateKeyPrefix is returned when a key prefix is already used by
+	// another project of the database.
+	ErrDuplicateKeyPrefix = errors.New("key prefix already used")
+	// ErrForeignKey is returned when an import carries a key the project
+	// neither holds nor can have issued.
+	ErrForeignKey = errors.New("requirement key belongs to another project")
+	// ErrAmbiguousKey is returned when several projects hold a requirement
+	// with the same key.
+	ErrAmbiguousKey = errors.New("requirement key is ambiguous")
+)
+
+// keyPrefix returns the prefix for new requirement keys of the project.
+func (prj *ProjectType) keyPrefix() string {
+	if prj.D.KeyPrefix != "" {
+		return prj.D.KeyPrefix
+	}
+	return defaultKeyPrefix(prj.ProductID, prj.ID)
+}
+
+func defaultKeyPrefix(productID, projectID int) string {
+	return fmt.Sprintf("PRD%d-PRJ%d", productID, projectID)
+}
+
+func formatKey(prefix string, seq int) string {
+	return fmt.Sprintf("%s-REQ-%04d", prefix, seq)
+}
+
+// issuedKey reports whether key has the form of the project's own keys.
+func (prj *ProjectType) issuedKey(key string) bool {
+	return strings.HasPrefix(key, prj.keyPrefix()+"-REQ-")
+}
+
+// checkImportedKeys rejects keys of reqs that the project neither holds nor
+// issued, such as keys copied from another project's workbook.
+func (prj *ProjectType) checkImportedKeys(reqs []Requirement) error {
+	var errs []error
+	for _, r := range reqs {
+		if r.Key == "" || prj.issuedKey(r.Key) {
+			continue
+		}
+		if _, err := prj.RequirementByKey(r.Key); err != nil {
+			errs = append(errs, fmt.Errorf("requirement %d: %s: %w", r.ID, r.Key, ErrForeignKey))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkKeyPrefix fails with ErrDuplicateKeyPrefix when another project than
+// productID/projectID uses prefix: as its key prefix, explicit or default,
+// or for keys it still holds, e.g. after renaming its prefix.
+func (db *Database) checkKeyPrefix(productID, projectID int, prefix string) error {
+	for _, prd := range db.Products {
+		for _, p := range prd.Projects {
+			if prd.ID == productID && p.ID == projectID {
+				continue
+			}
+			other := ProjectType{ID: p.ID, ProductID: prd.ID}
+			if err := db.Store().LoadProject(&other); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("read project %s: %w", projectFileKey(prd.ID, p.ID), err)
+			}
+			if other.keyPrefix() == prefix || other.holdsKeysOf(prefix) {
+				return fmt.Errorf("%q used by project %d/%d: %w", prefix, prd.ID, p.ID, ErrDuplicateKeyPrefix)
+			}
+		}
+	}
+	return nil
+}
+
+// holdsKeysOf reports whether the project has a requirement keyed with prefix.
+func (prj *ProjectType) holdsKeysOf(prefix string) bool {
+	for _, r := range prj.D.Requirements {
+		if strings.HasPrefix(r.Key, prefix+"-REQ-") {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureRequirementKeys assigns keys to requirements that have none and
+// replaces keys duplicated within the project, keeping the first holder.
+func (prj *ProjectType) ensureRequirementKeys() {
+	if prj.D.NextKeySeq < 1 {
+		prj.D.NextKeySeq = 1
+	}
+	seen := make(map[string]bool, len(prj.D.Requirements))
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		if r.Key == "" || seen[r.Key] {
+			r.Key = prj.nextKey(seen)
+		}
+		seen[r.Key] = true
+	}
+}
+
+// nextKey returns the next unused key from the project's sequence.
+func (prj *ProjectType) nextKey(used map[string]bool) string {
+	for {
+		k := formatKey(prj.keyPrefix(), prj.D.NextKeySeq)
+		prj.D.NextKeySeq++
+		if !used[k] {
+			return k
+		}
+	}
+}
+
+// RequirementByKey returns the project's requirement with the given key.
+func (prj *ProjectType) RequirementByKey(key string) (*Requirement, error) {
+	for i := range prj.D.Requirements {
+		if prj.D.Requirements[i].Key == key {
+			return &prj.D.Requirements[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", key, ErrRequirementNotFound)
+}
+
+// RequirementByID returns the project's requirement with the given ID.
+func (prj *ProjectType) RequirementByID(id int) (*Requirement, error) {
+	for i := range prj.D.Requirements {
+		if prj.D.Requirements[i].ID == id {
+			return &prj.D.Requirements[i], nil
+		}
+	}
+	return nil, fmt.Errorf("requirement %d: %w", id, ErrRequirementNotFound)
+}
+
+// FindRequirementByKey loads the projects of the database to find the
+// requirement with the given key. It returns the loaded project and a
+// pointer into its requirements. A key held in several projects, e.g. after
+// a move whose source could not be saved, fails with ErrAmbiguousKey.
+func (db *Database) FindRequirementByKey(key string) (*ProjectType, *Requirement, error) {
+	var (
+		found *ProjectType
+		req   *Requirement
+		where []string
+	)
+	for i := range db.Products {
+		prd := &db.Products[i]
+		for j := range prd.Projects {
+			prj, err := prd.Project(prd.Projects[j].ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if r, err := prj.RequirementByKey(key); err == nil {
+				found, req = prj, r
+				where = append(where, fmt.Sprintf("%d/%d", prd.ID, prj.ID))
+			}
+		}
+	}
+	switch {
+	case len(where) == 0:
+		return nil, nil, fmt.Errorf("%s: %w", key, ErrRequirementNotFound)
+	case len(where) > 1:
+		return nil, nil, fmt.Errorf("%s in projects %s: %w", key, strings.Join(where, ", "), ErrAmbiguousKey)
+	}
+	return found, req, nil
+}
+
+// MoveRequirement moves the requirement with the given key to another
+// project. It keeps its key and review comments, receives a new ID in the
+// target project and loses its parent, attachment, release, relation, risk,
+// test case and intelligence references, which do not carry over, as well as
+// its approvals, which were signed under the source project's policy; its
+// children in the source project move up to its parent. With FixedCategories
+// set in the target, a category outside its catalog fails with
+// ErrUnknownCategory. The target is saved before the source so a failure
+// duplicates rather than loses the requirement.
+func (db *Database) MoveRequirement(key string, productID, projectID int) (*Requirement, error) {
+	src, req, err := db.FindRequirementByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if src.ProductID == productID && src.ID == projectID {
+		return req, nil
+	}
+	prd, err := db.Product(productID)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := prd.Project(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dst.CheckCategory(req.Category); err != nil {
+		return nil, err
+	}
+	moved := *req
+	moved.ID = 0
+	moved.ParentID = 0
+	moved.AttachmentIndex = 0
+	moved.ReleaseID = 0
+	moved.Approvals = nil
+	dst.D.Requirements = append(dst.D.Requirements, moved)
+	dst.ensureRequirementIDs()
+	src.copyCommentsTo(req.ID, dst, dst.D.Requirements[len(dst.D.Requirements)-1].ID)
+	if err := dst.Save(); err != nil {
+		return nil, err
+	}
+
+	for i := range src.D.Requirements {
+		if src.D.Requirements[i].Key == key {
+			src.forgetRequirement(src.D.Requirements[i].ID, src.D.Requirements[i].ParentID, "parent "+key+" moved")
+			src.D.Requirements = append(src.D.Requirements[:i], src.D.Requirements[i+1:]...)
+			break
+		}
+	}
+	if err := src.Save(); err != nil {
+		return nil, err
+	}
+	return &dst.D.Requirements[len(dst.D.Requirements)-1], nil
+}
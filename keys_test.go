@@ -0,0 +1,225 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newKeysDB opens an in-memory database with one product and two projects.
+func newKeysDB(t *testing.T) (*Database, *ProjectType, *ProjectType) {
+	t.Helper()
+	db, err := Open(NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	prd := &db.Products[0]
+	for _, name := range []string{"a", "b"} {
+		if _, err := prd.NewProject(ProjectData{Name: name}); err != nil {
+			t.Fatalf("NewProject: %v", err)
+		}
+	}
+	a, err := prd.Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	b, err := prd.Project(2)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	return db, a, b
+}
+
+func TestSaveAssignsRequirementKeys(t *testing.T) {
+	db, a, b := newKeysDB(t)
+	a.D.Requirements = []Requirement{{Name: "R1"}, {Name: "R2"}}
+	a.ensureRequirementIDs()
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b.D.Requirements = []Requirement{{Name: "R1"}}
+	b.ensureRequirementIDs()
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if k := a.D.Requirements[1].Key; k != "PRD1-PRJ1-REQ-0002" {
+		t.Fatalf("key = %q", k)
+	}
+
+	prj, r, err := db.FindRequirementByKey("PRD1-PRJ2-REQ-0001")
+	if err != nil {
+		t.Fatalf("FindRequirementByKey: %v", err)
+	}
+	if prj.ID != 2 || r.ID != 1 {
+		t.Fatalf("found %d/%d", prj.ID, r.ID)
+	}
+	if _, _, err := db.FindRequirementByKey("nope"); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected ErrRequirementNotFound, got %v", err)
+	}
+}
+
+func TestMoveRequirementKeepsKey(t *testing.T) {
+	db, a, b := newKeysDB(t)
+	a.D.Requirements = []Requirement{{Name: "R1"}, {Name: "R2", ParentID: 1, Category: "Safety", ReleaseID: 1, Approvals: []SignOff{{Role: "qa", User: "ann"}}}}
+	a.ensureRequirementIDs()
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b.D.Requirements = []Requirement{{Name: "B1"}}
+	b.D.FixedCategories = true
+	b.ensureRequirementIDs()
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// The target's category catalog applies to moved requirements.
+	if _, err := db.MoveRequirement("PRD1-PRJ1-REQ-0002", 1, 2); !errors.Is(err, ErrUnknownCategory) {
+		t.Fatalf("expected ErrUnknownCategory, got %v", err)
+	}
+	if err := b.AddCategory(Category{Name: "Safety"}); err != nil {
+		t.Fatalf("AddCategory: %v", err)
+	}
+
+	moved, err := db.MoveRequirement("PRD1-PRJ1-REQ-0002", 1, 2)
+	if err != nil {
+		t.Fatalf("MoveRequirement: %v", err)
+	}
+	if moved.Key != "PRD1-PRJ1-REQ-0002" || moved.ID != 2 || moved.ParentID != 0 {
+		t.Fatalf("unexpected moved requirement: %#v", moved)
+	}
+	if moved.ReleaseID != 0 || len(moved.Approvals) != 0 {
+		t.Fatalf("release or approvals carried over: %#v", moved)
+	}
+
+	prj, _, err := db.FindRequirementByKey("PRD1-PRJ1-REQ-0002")
+	if err != nil || prj.ID != 2 {
+		t.Fatalf("moved requirement found in %v: %v", prj, err)
+	}
+	src, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	if len(src.D.Requirements) != 1 {
+		t.Fatalf("requirement not removed from source: %#v", src.D.Requirements)
+	}
+	// New requirements in the source must not reuse the moved key.
+	src.D.Requirements = append(src.D.Requirements, Requirement{Name: "R3"})
+	src.ensureRequirementIDs()
+	if err := src.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if k := src.D.Requirements[1].Key; k != "PRD1-PRJ1-REQ-0003" {
+		t.Fatalf("key = %q", k)
+	}
+}
+
+func TestExcelRoundTripMatchesByKey(t *testing.T) {
+	_, a, _ := newKeysDB(t)
+	a.D.Requirements = []Requirement{{Name: "R1"}, {Name: "R2"}}
+	a.ensureRequirementIDs()
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "prj.xlsx")
+	if err := a.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+
+	// Renumber locally; the import must still update by key.
+	a.D.Requirements[0].ID, a.D.Requirements[1].ID = 2, 1
+	a.D.Requirements[0].Name = "changed"
+	if err := a.ImportExcel(path, false); err != nil {
+		t.Fatalf("ImportExcel: %v", err)
+	}
+	if len(a.D.Requirements) != 2 {
+		t.Fatalf("import duplicated requirements: %#v", a.D.Requirements)
+	}
+	r, err := a.RequirementByKey("PRD1-PRJ1-REQ-0001")
+	if err != nil {
+		t.Fatalf("RequirementByKey: %v", err)
+	}
+	if r.Name != "R1" {
+		t.Fatalf("name = %q, want R1", r.Name)
+	}
+}
+
+func TestMigrationAssignsKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeLegacyDB(t, dir)
+	db, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	prj, r, err := db.FindRequirementByKey("PRD1-PRJ1-REQ-0001")
+	if err != nil {
+		t.Fatalf("FindRequirementByKey: %v", err)
+	}
+	if r.Name != "R1" || prj.D.NextKeySeq != 2 {
+		t.Fatalf("unexpected migrated data: %#v next=%d", r, prj.D.NextKeySeq)
+	}
+}
+
+func TestKeyPrefixesAndKeysStayUnique(t *testing.T) {
+	db, a, b := newKeysDB(t)
+	prd := &db.Products[0]
+	if _, err := prd.NewProject(ProjectData{Name: "c", KeyPrefix: "PRD1-PRJ2"}); !errors.Is(err, ErrDuplicateKeyPrefix) {
+		t.Fatalf("expected ErrDuplicateKeyPrefix, got %v", err)
+	}
+	if _, err := prd.NewProject(ProjectData{Name: "c", KeyPrefix: "BELT"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	if _, err := prd.ModifyProject(1, ProjectData{Name: "a", KeyPrefix: "BELT"}); !errors.Is(err, ErrDuplicateKeyPrefix) {
+		t.Fatalf("expected ErrDuplicateKeyPrefix, got %v", err)
+	}
+
+	// A workbook exported from project b cannot bring b's keys into a.
+	b.D.Requirements = []Requirement{{Name: "B1"}}
+	b.ensureRequirementIDs()
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "b.xlsx")
+	if err := b.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	if err := a.ImportExcel(path, false); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected ErrForeignKey, got %v", err)
+	}
+	if len(a.D.Requirements) != 0 {
+		t.Fatalf("rejected workbook changed the project: %#v", a.D.Requirements)
+	}
+
+	// Should a key end up in two projects anyway, lookups refuse to guess.
+	a.D.Requirements = []Requirement{{Name: "copy", Key: b.D.Requirements[0].Key}}
+	a.ensureRequirementIDs()
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, _, err := db.FindRequirementByKey(b.D.Requirements[0].Key); !errors.Is(err, ErrAmbiguousKey) {
+		t.Fatalf("expected ErrAmbiguousKey, got %v", err)
+	}
+
+	// A default prefix taken by another project blocks the new project.
+	if _, err := prd.ModifyProject(3, ProjectData{Name: "c", KeyPrefix: "PRD1-PRJ4"}); err != nil {
+		t.Fatalf("ModifyProject: %v", err)
+	}
+	if _, err := prd.NewProject(ProjectData{Name: "d"}); !errors.Is(err, ErrDuplicateKeyPrefix) {
+		t.Fatalf("expected ErrDuplicateKeyPrefix for the default prefix, got %v", err)
+	}
+
+	// A prefix stays taken while its keys are held, even after a rename.
+	a.D.Requirements = append(a.D.Requirements, Requirement{Name: "own"})
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	a.D.KeyPrefix = "ALPHA"
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := prd.ModifyProject(2, ProjectData{Name: "b", KeyPrefix: "PRD1-PRJ1"}); !errors.Is(err, ErrDuplicateKeyPrefix) {
+		t.Fatalf("expected ErrDuplicateKeyPrefix for a prefix with held keys, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package PMFS
+
+import "fmt"
+
+// Product and project lifecycle: ID allocation, archival and deletion.
+//
+// Archiving only flags the entry in index.toml; the data stays in place and
+// Restore clears the flag. Delete removes the entry and everything the store
+// keeps for it. IDs are never reused, so a deleted product's or project's ID
+// cannot later point at unrelated data. As with NewProduct and NewProject,
+// callers sharing the database hold Database.Lock; the store's index lock
+// for other processes is taken by the index writes themselves.
+
+// allocProductID returns the next product ID and advances the counter. The
+// counter is seeded by the schema migration and raised past the ID of every
+// deleted product; it is also raised past existing IDs for indexes edited by
+// hand.
+func (db *Database) allocProductID() int {
+	id := max(db.NextProductID, 1)
+	for _, p := range db.Products {
+		id = max(id, p.ID+1)
+	}
+	db.NextProductID = id + 1
+	return id
+}
+
+// allocProjectID returns the next project ID and advances the counter.
+func (prd *ProductType) allocProjectID() int {
+	id := max(prd.NextProjectID, 1)
+	for _, p := range prd.Projects {
+		id = max(id, p.ID+1)
+	}
+	prd.NextProjectID = id + 1
+	return id
+}
+
+// Product returns the product with the given ID.
+func (db *Database) Product(id int) (*ProductType, error) {
+	for i := range db.Products {
+		if db.Products[i].ID == id {
+			return &db.Products[i], nil
+		}
+	}
+	return nil, ErrProductNotFound
+}
+
+// ActiveProducts returns the products that are not archived.
+func (db *Database) ActiveProducts() []ProductType {
+	out := []ProductType{}
+	for _, p := range db.Products {
+		if !p.Archived {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ArchiveProduct hides the product from ActiveProducts without removing
+// any data.
+func (db *Database) ArchiveProduct(id int) error {
+	return db.setProductArchived(id, true)
+}
+
+// RestoreProduct clears the archived flag of the product.
+func (db *Database) RestoreProduct(id int) error {
+	return db.setProductArchived(id, false)
+}
+
+func (db *Database) setProductArchived(id int, archived bool) error {
+	prd, err := db.Product(id)
+	if err != nil {
+		return err
+	}
+	prd.Archived = archived
+	return db.Save()
+}
+
+// DeleteProduct removes the product, its projects and all their data. The
+// product counter is kept past the deleted ID, and the index is saved first
+// so a failed cleanup leaves only unreachable files.
+func (db *Database) DeleteProduct(id int) error {
+	err := db.editIndex(func() error {
+		for i := range db.Products {
+			if db.Products[i].ID == id {
+				db.NextProductID = max(db.NextProductID, id+1)
+				db.Products = append(db.Products[:i], db.Products[i+1:]...)
+				return nil
+			}
+		}
+		return ErrProductNotFound
+	})
+	if err != nil {
+		return err
+	}
+	if err := db.Store().DeleteProduct(id); err != nil {
+		return fmt.Errorf("delete product %d data: %w", id, err)
+	}
+	return nil
+}
+
+// ActiveProjects returns the projects of the product that are not archived.
+func (prd *ProductType) ActiveProjects() []ProjectType {
+	out := []ProjectType{}
+	for _, p := range prd.Projects {
+		if !p.Archived {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ArchiveProject hides the project from ActiveProjects without removing any
+// data.
+func (prd *ProductType) ArchiveProject(id int) error {
+	return prd.setProjectArchived(id, true)
+}
+
+// RestoreProject clears the archived flag of the project.
+func (prd *ProductType) RestoreProject(id int) error {
+	return prd.setProjectArchived(id, false)
+}
+
+func (prd *ProductType) setProjectArchived(id int, archived bool) error {
+	for i := range prd.Projects {
+		if prd.Projects[i].ID == id {
+			prd.Projects[i].Archived = archived
+			return prd.database().Save()
+		}
+	}
+	return ErrProjectNotFound
+}
+
+// DeleteProject removes the project and its attachments. The project counter
+// is kept past the deleted ID, and the index is saved first so a failed
+// cleanup leaves only unreachable files.
+func (prd *ProductType) DeleteProject(id int) error {
+	db := prd.database()
+	err := db.editIndex(func() error {
+		for i := range prd.Projects {
+			if prd.Projects[i].ID == id {
+				prd.NextProjectID = max(prd.NextProjectID, id+1)
+				prd.Projects = append(prd.Projects[:i], prd.Projects[i+1:]...)
+				return nil
+			}
+		}
+		return ErrProjectNotFound
+	})
+	if err != nil {
+		return err
+	}
+	// Wait for readers and writers of the project before removing it.
+	prj := ProjectType{ID: id, ProductID: prd.ID, db: prd.db}
+	unlock, err := prj.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := db.Store().DeleteProject(prd.ID, id); err != nil {
+		return fmt.Errorf("delete project %d/%d data: %w", prd.ID, id, err)
+	}
+	return nil
+}
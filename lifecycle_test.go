@@ -0,0 +1,153 @@
+package PMFS
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDeletedIDsAreNeverReused(t *testing.T) {
+	dir := t.TempDir()
+	db, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, err := db.NewProduct(ProductData{Name: name}); err != nil {
+			t.Fatalf("NewProduct: %v", err)
+		}
+	}
+	if err := db.DeleteProduct(2); err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+	if _, err := os.Stat(NewFSStore(dir).ProjectPath(2, 1)); !os.IsNotExist(err) {
+		t.Fatalf("product data not removed: %v", err)
+	}
+
+	// Reopen so the counter must come from index.toml.
+	db, err = LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	id, err := db.NewProduct(ProductData{Name: "c"})
+	if err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if id != 3 {
+		t.Fatalf("new product ID = %d, want 3", id)
+	}
+
+	prd, err := db.Product(1)
+	if err != nil {
+		t.Fatalf("Product: %v", err)
+	}
+	for _, name := range []string{"p1", "p2"} {
+		if _, err := prd.NewProject(ProjectData{Name: name}); err != nil {
+			t.Fatalf("NewProject: %v", err)
+		}
+	}
+	if err := prd.DeleteProject(2); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if _, err := os.Stat(NewFSStore(dir).ProjectPath(1, 2)); !os.IsNotExist(err) {
+		t.Fatalf("project data not removed: %v", err)
+	}
+	pid, err := prd.NewProject(ProjectData{Name: "p3"})
+	if err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	if pid != 3 {
+		t.Fatalf("new project ID = %d, want 3", pid)
+	}
+	if err := prd.DeleteProject(2); !errors.Is(err, ErrProjectNotFound) {
+		t.Fatalf("expected ErrProjectNotFound, got %v", err)
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	db, err := Open(NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	prd := &db.Products[0]
+	if _, err := prd.NewProject(ProjectData{Name: "prj"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+
+	if err := prd.ArchiveProject(1); err != nil {
+		t.Fatalf("ArchiveProject: %v", err)
+	}
+	if len(prd.ActiveProjects()) != 0 {
+		t.Fatalf("archived project still active")
+	}
+	if _, err := prd.Project(1); err != nil {
+		t.Fatalf("archived project data lost: %v", err)
+	}
+	if err := db.ArchiveProduct(1); err != nil {
+		t.Fatalf("ArchiveProduct: %v", err)
+	}
+
+	reopened, err := Open(db.Store())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(reopened.ActiveProducts()) != 0 || !reopened.Products[0].Projects[0].Archived {
+		t.Fatalf("archived flags not persisted: %#v", reopened.Products)
+	}
+	if err := reopened.RestoreProduct(1); err != nil {
+		t.Fatalf("RestoreProduct: %v", err)
+	}
+	if err := reopened.Products[0].RestoreProject(1); err != nil {
+		t.Fatalf("RestoreProject: %v", err)
+	}
+	if len(reopened.ActiveProducts()) != 1 || len(reopened.Products[0].ActiveProjects()) != 1 {
+		t.Fatalf("restore did not clear archived flags")
+	}
+}
+
+func TestLegacyIndexCountersAreSeeded(t *testing.T) {
+	s := NewMemoryStore()
+	s.put(indexKey(), []byte(`[[products]]
+id = 1
+name = "a"
+
+[[products]]
+id = 2
+name = "b"
+
+[[products]]
+id = 3
+name = "c"
+
+[[products.projects]]
+id = 1
+name = "p1"
+
+[[products.projects]]
+id = 2
+name = "p2"
+`))
+	db, err := Open(s)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	prd, err := db.Product(3)
+	if err != nil {
+		t.Fatalf("Product: %v", err)
+	}
+	if err := prd.DeleteProject(2); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if pid, err := prd.NewProject(ProjectData{Name: "p3"}); err != nil || pid != 3 {
+		t.Fatalf("NewProject = %d, %v; want 3", pid, err)
+	}
+	if err := db.DeleteProduct(3); err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+	if id, err := db.NewProduct(ProductData{Name: "d"}); err != nil || id != 4 {
+		t.Fatalf("NewProduct = %d, %v; want 4", id, err)
+	}
+}
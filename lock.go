@@ -0,0 +1,268 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Locking
+//
+// A Database may be shared between goroutines, and a filesystem database
+// between processes (for example the web interface and the CLI). PMFS does
+// not lock implicitly; callers that share data use the API below:
+//
+//   - Database.Lock / Database.RLock guard Products and index.toml within
+//     the process. Hold the write lock while adding, renaming or removing
+//     products and projects and while calling Database.Save. Between
+//     processes, index writes take the store's advisory index lock and merge
+//     what others stored since the database was loaded (see editIndex).
+//   - ProjectType.Lock / ProjectType.RLock guard a single project. They take
+//     an in-process RWMutex shared by every ProjectType value of the same
+//     project and, when the store supports it, an advisory file lock so
+//     other processes are serialized too.
+//   - ProjectType.View and ProjectType.Edit wrap the project locks around a
+//     fresh Load and, for Edit, a Save. They are the preferred way to read or
+//     change a project that others may modify concurrently.
+//
+// Locks are not reentrant. Take the database lock before any project lock.
+
+// ProjectLocker is implemented by stores that can coordinate project access
+// between processes. LockProject blocks until the lock is held and returns
+// the function that releases it.
+type ProjectLocker interface {
+	LockProject(productID, projectID int, exclusive bool) (unlock func() error, err error)
+}
+
+// IndexLocker is implemented by stores that can coordinate index writes
+// between processes. LockIndex blocks until the lock is held and returns the
+// function that releases it.
+type IndexLocker interface {
+	LockIndex() (unlock func() error, err error)
+}
+
+// lockFilename is the advisory lock file kept in each project folder and in
+// the products folder for the index.
+const lockFilename = ".lock"
+
+// Lock acquires the database's write lock and returns the function releasing
+// it.
+func (db *Database) Lock() (unlock func()) {
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+// RLock acquires the database's read lock and returns the function releasing
+// it.
+func (db *Database) RLock() (unlock func()) {
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+// projectMutex returns the in-process mutex guarding the given project.
+func (db *Database) projectMutex(productID, projectID int) *sync.RWMutex {
+	db.locksMu.Lock()
+	defer db.locksMu.Unlock()
+	if db.projectLocks == nil {
+		db.projectLocks = map[[2]int]*sync.RWMutex{}
+	}
+	key := [2]int{productID, projectID}
+	mu, ok := db.projectLocks[key]
+	if !ok {
+		mu = &sync.RWMutex{}
+		db.projectLocks[key] = mu
+	}
+	return mu
+}
+
+// Lock acquires exclusive access to the project, in-process and through the
+// store's advisory lock when available. Call the returned function to
+// release it.
+func (prj *ProjectType) Lock() (unlock func(), err error) {
+	return prj.lock(true)
+}
+
+// RLock acquires shared access to the project. Readers holding RLock exclude
+// writers holding Lock but not each other. Call the returned function to
+// release it.
+func (prj *ProjectType) RLock() (unlock func(), err error) {
+	return prj.lock(false)
+}
+
+func (prj *ProjectType) lock(exclusive bool) (func(), error) {
+	db := prj.database()
+	mu := db.projectMutex(prj.ProductID, prj.ID)
+	if exclusive {
+		mu.Lock()
+	} else {
+		mu.RLock()
+	}
+	release := mu.Unlock
+	if !exclusive {
+		release = mu.RUnlock
+	}
+	l, ok := db.Store().(ProjectLocker)
+	if !ok {
+		return release, nil
+	}
+	fileUnlock, err := l.LockProject(prj.ProductID, prj.ID, exclusive)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("lock project %d/%d: %w", prj.ProductID, prj.ID, err)
+	}
+	return func() {
+		_ = fileUnlock()
+		release()
+	}, nil
+}
+
+// View loads a fresh copy of the project under a shared lock and passes it
+// to fn. The copy must not be retained after fn returns; prj itself is left
+// untouched.
+func (prj *ProjectType) View(fn func(*ProjectType) error) error {
+	unlock, err := prj.RLock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cp := ProjectType{ID: prj.ID, ProductID: prj.ProductID, db: prj.db}
+	if err := cp.Load(); err != nil {
+		return err
+	}
+	return fn(&cp)
+}
+
+// Edit reloads the project under an exclusive lock, applies fn and saves the
+// result before releasing the lock. Nothing is saved when fn returns an
+// error; prj then holds the reloaded data with fn's partial changes.
+func (prj *ProjectType) Edit(fn func(*ProjectType) error) error {
+	unlock, err := prj.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := prj.Load(); err != nil {
+		return err
+	}
+	if err := fn(prj); err != nil {
+		return err
+	}
+	return prj.Save()
+}
+
+// editIndex runs fn and saves the index under the store's advisory index
+// lock. The stored index is read first and ID counters are raised to the
+// stored ones, so no ID is handed out twice. After fn, products and projects
+// other processes created are added and those they deleted are dropped;
+// entries both sides know keep db's values. Entries are only added or
+// dropped after fn, so pointers into db.Products stay valid while it runs.
+func (db *Database) editIndex(fn func() error) error {
+	s := db.Store()
+	if l, ok := s.(IndexLocker); ok {
+		unlock, err := l.LockIndex()
+		if err != nil {
+			return fmt.Errorf("lock index: %w", err)
+		}
+		defer unlock()
+	}
+	disk := newDatabase(s)
+	if err := s.LoadIndex(disk); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read index.toml: %w", err)
+		}
+		disk = nil
+	}
+	var known knownIDs
+	if disk != nil {
+		known = db.mergeCounters(disk)
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if disk != nil {
+		db.mergeEntries(disk, known)
+	}
+	return s.SaveIndex(db)
+}
+
+// knownIDs holds, for products and per product for projects, the lowest ID
+// a database had not handed out or loaded before an index merge.
+type knownIDs struct {
+	products int
+	projects map[int]int
+}
+
+// mergeCounters raises db's ID counters to those of disk and returns the IDs
+// db knew of before.
+func (db *Database) mergeCounters(disk *Database) knownIDs {
+	known := knownIDs{products: db.NextProductID, projects: map[int]int{}}
+	for i := range db.Products {
+		prd := &db.Products[i]
+		known.products = max(known.products, prd.ID+1)
+		next := prd.NextProjectID
+		for _, p := range prd.Projects {
+			next = max(next, p.ID+1)
+		}
+		known.projects[prd.ID] = next
+		if d, err := disk.Product(prd.ID); err == nil {
+			prd.NextProjectID = max(prd.NextProjectID, d.NextProjectID)
+		}
+	}
+	db.NextProductID = max(db.NextProductID, disk.NextProductID)
+	return known
+}
+
+// mergeEntries adds the products and projects of disk that db did not know
+// of and drops those disk lacks although its counters passed them.
+func (db *Database) mergeEntries(disk *Database, known knownIDs) {
+	db.Products = slices.DeleteFunc(db.Products, func(p ProductType) bool {
+		_, err := disk.Product(p.ID)
+		return err != nil && p.ID < disk.NextProductID
+	})
+	for i := range db.Products {
+		prd := &db.Products[i]
+		d, err := disk.Product(prd.ID)
+		if err != nil {
+			continue
+		}
+		prd.Projects = slices.DeleteFunc(prd.Projects, func(p ProjectType) bool {
+			return !slices.ContainsFunc(d.Projects, func(dp ProjectType) bool { return dp.ID == p.ID }) && p.ID < d.NextProjectID
+		})
+		if next, ok := known.projects[prd.ID]; ok {
+			for _, dp := range d.Projects {
+				if dp.ID >= next {
+					prd.Projects = append(prd.Projects, dp)
+				}
+			}
+		}
+	}
+	for _, d := range disk.Products {
+		if d.ID >= known.products {
+			db.Products = append(db.Products, d)
+		}
+	}
+	db.bind()
+}
+
+// LockIndex takes an advisory lock on the .lock file of the products folder.
+func (s *FSStore) LockIndex() (func() error, error) {
+	dir := s.path(productsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir products dir: %w", err)
+	}
+	return lockFile(filepath.Join(dir, lockFilename), true)
+}
+
+// LockProject takes an advisory lock on the project's .lock file, creating
+// the project folder when needed.
+func (s *FSStore) LockProject(productID, projectID int, exclusive bool) (func() error, error) {
+	dir := s.ProjectPath(productID, projectID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir project dir: %w", err)
+	}
+	return lockFile(filepath.Join(dir, lockFilename), exclusive)
+}
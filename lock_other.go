@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package PMFS
+
+// lockFile is a no-op on platforms without advisory file locks; projects are
+// then only serialized within the process.
+func lockFile(path string, exclusive bool) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,150 @@
+package PMFS
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProjectEditSerializesWriters(t *testing.T) {
+	db, err := LoadSetup(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if _, err := db.Products[0].NewProject(ProjectData{Name: "prj"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate values for the same project, as two requests would have.
+			prj := &ProjectType{ID: 1, ProductID: 1, db: db}
+			errs <- prj.Edit(func(p *ProjectType) error {
+				p.D.Requirements = append(p.D.Requirements, Requirement{ID: i + 1, Name: fmt.Sprint(i)})
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Edit: %v", err)
+		}
+	}
+
+	prj := &ProjectType{ID: 1, ProductID: 1, db: db}
+	err = prj.View(func(p *ProjectType) error {
+		if len(p.D.Requirements) != writers {
+			return fmt.Errorf("lost updates: got %d requirements, want %d", len(p.D.Requirements), writers)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prj.D.Requirements) != 0 {
+		t.Fatalf("View modified the receiver: %#v", prj.D.Requirements)
+	}
+}
+
+func TestFSStoreLockProjectExcludesOtherHolders(t *testing.T) {
+	if runtime.GOOS == "plan9" || runtime.GOOS == "js" || runtime.GOOS == "wasip1" {
+		t.Skip("no advisory file locks on " + runtime.GOOS)
+	}
+	s := NewFSStore(t.TempDir())
+	unlock, err := s.LockProject(1, 1, true)
+	if err != nil {
+		t.Fatalf("LockProject: %v", err)
+	}
+
+	acquired := make(chan func() error)
+	go func() {
+		// A second lock file handle behaves like another process.
+		u, err := s.LockProject(1, 1, false)
+		if err != nil {
+			t.Errorf("LockProject: %v", err)
+			close(acquired)
+			return
+		}
+		acquired <- u
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("shared lock granted while exclusive lock held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	select {
+	case u := <-acquired:
+		if u != nil {
+			_ = u()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shared lock not granted after release")
+	}
+}
+
+func TestIndexWritesMergeOtherProcesses(t *testing.T) {
+	dir := t.TempDir()
+	// Two databases on one folder behave like two processes.
+	a, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	b, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	idA, err := a.NewProduct(ProductData{Name: "from a"})
+	if err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	idB, err := b.NewProduct(ProductData{Name: "from b"})
+	if err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if idA == idB {
+		t.Fatalf("both processes got product ID %d", idA)
+	}
+	prd, err := b.Product(idA)
+	if err != nil {
+		t.Fatalf("product created by the other process missing: %v", err)
+	}
+	if _, err := prd.NewProject(ProjectData{Name: "p"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	if err := a.ArchiveProduct(idA); err != nil {
+		t.Fatalf("ArchiveProduct: %v", err)
+	}
+
+	c, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	if len(c.Products) != 2 || !c.Products[0].Archived || len(c.Products[0].Projects) != 1 {
+		t.Fatalf("index lost a writer's changes: %#v", c.Products)
+	}
+	if err := b.DeleteProduct(idB); err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if len(a.Products) != 1 || a.Products[0].ID != idA {
+		t.Fatalf("product deleted elsewhere came back: %#v", a.Products)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package PMFS
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile opens path and holds a LockFileEx lock on it until the returned
+// function is called.
+func lockFile(path string, exclusive bool) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	h := windows.Handle(f.Fd())
+	ol := new(windows.Overlapped)
+	if err := windows.LockFileEx(h, flags, 0, 1, 0, ol); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		err := windows.UnlockFileEx(h, 0, 1, 0, ol)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,492 @@
+package PMFS
+
+import (
+	"fmt"
+	"time"
+)
+
+// Registered schema migrations, in version order. Each migration rewrites the
+// raw TOML tree of one document kind from From to From+1; bump SchemaVersion
+// together with adding a migration for every kind.
+func init() {
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        0,
+		Description: "add schema_version",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        0,
+		Description: "rename requirementdesignaspects to recommended_changes",
+		Apply: func(doc map[string]any) ([]string, error) {
+			return renameKey(doc, "", "requirementdesignaspects", "recommended_changes"), nil
+		},
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        1,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        1,
+		Description: "assign requirement keys",
+		Apply:       assignRequirementKeys,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        2,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        2,
+		Description: "move requirement intelligence links to ID-based project links",
+		Apply:       linkIntelligenceByID,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        3,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        3,
+		Description: "reference requirement parents by ID and derive levels",
+		Apply:       parentIndexToID,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        4,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        4,
+		Description: "move requirement condition flags into workflow states",
+		Apply:       flagsToWorkflowState,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        5,
+		Description: "seed product and project ID counters past the IDs in use",
+		Apply:       seedIDCounters,
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        5,
+		Description: "no project changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        6,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        6,
+		Description: "seed the requirement ID counter past the IDs in use",
+		Apply:       seedRequirementCounter,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        7,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        7,
+		Description: "seed the test case ID counter past the IDs in use",
+		Apply:       seedTestCaseCounter,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        8,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        8,
+		Description: "seed the comment ID counter past the IDs in use",
+		Apply:       seedCommentCounter,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        9,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        9,
+		Description: "seed the risk ID counter past the IDs in use",
+		Apply:       seedRiskCounter,
+	})
+
+	registerMigration(Migration{
+		Kind:        IndexDoc,
+		From:        10,
+		Description: "no index changes",
+		Apply:       func(map[string]any) ([]string, error) { return nil, nil },
+	})
+	registerMigration(Migration{
+		Kind:        ProjectDoc,
+		From:        10,
+		Description: "seed the release ID counter past the IDs in use",
+		Apply:       seedReleaseCounter,
+	})
+}
+
+// seedRequirementCounter starts next_requirement_id after the highest
+// requirement ID. Projects written before the counter existed handed out
+// the highest ID plus one, reusing the ID of a removed last requirement.
+func seedRequirementCounter(doc map[string]any) ([]string, error) {
+	return seedCounter(doc, "requirements", "next_requirement_id"), nil
+}
+
+// seedTestCaseCounter starts next_test_case_id after the highest test case
+// ID, for the same reason as seedRequirementCounter.
+func seedTestCaseCounter(doc map[string]any) ([]string, error) {
+	return seedCounter(doc, "test_cases", "next_test_case_id"), nil
+}
+
+// seedCommentCounter starts next_comment_id after the highest comment ID,
+// for the same reason as seedRequirementCounter.
+func seedCommentCounter(doc map[string]any) ([]string, error) {
+	return seedCounter(doc, "comments", "next_comment_id"), nil
+}
+
+// seedRiskCounter starts next_risk_id after the highest risk ID, for the
+// same reason as seedRequirementCounter.
+func seedRiskCounter(doc map[string]any) ([]string, error) {
+	return seedCounter(doc, "risks", "next_risk_id"), nil
+}
+
+// seedReleaseCounter starts next_release_id after the highest release ID,
+// for the same reason as seedRequirementCounter.
+func seedReleaseCounter(doc map[string]any) ([]string, error) {
+	return seedCounter(doc, "releases", "next_release_id"), nil
+}
+
+// seedCounter raises the project data's counter key past the highest id of
+// the tables in list.
+func seedCounter(doc map[string]any, list, counter string) []string {
+	pd, ok := doc["projectdata"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	var maxID int64
+	for _, r := range tables(pd[list]) {
+		id, _ := r["id"].(int64)
+		maxID = max(maxID, id)
+	}
+	if next, _ := pd[counter].(int64); next > maxID {
+		return nil
+	}
+	pd[counter] = maxID + 1
+	return []string{fmt.Sprintf("%s %d", counter, maxID+1)}
+}
+
+// seedIDCounters raises next_product_id, and the next_project_id of every
+// product, past the highest ID in use. Indexes migrated before the counters
+// existed stored them as 0, which would hand out the ID of the last product
+// or project again once it is deleted.
+func seedIDCounters(doc map[string]any) ([]string, error) {
+	var changes []string
+	var maxProduct int64
+	for i, p := range tables(doc["products"]) {
+		id, _ := p["id"].(int64)
+		maxProduct = max(maxProduct, id)
+		var maxProject int64
+		for _, prj := range tables(p["projects"]) {
+			pid, _ := prj["id"].(int64)
+			maxProject = max(maxProject, pid)
+		}
+		if next, _ := p["next_project_id"].(int64); next <= maxProject {
+			p["next_project_id"] = maxProject + 1
+			changes = append(changes, fmt.Sprintf("products[%d]: next_project_id %d", i, maxProject+1))
+		}
+	}
+	if next, _ := doc["next_product_id"].(int64); next <= maxProduct {
+		doc["next_product_id"] = maxProduct + 1
+		changes = append(changes, fmt.Sprintf("next_product_id %d", maxProduct+1))
+	}
+	return changes, nil
+}
+
+// flagsToWorkflowState sets each requirement's status to a state of the
+// default workflow: a free-text status naming a state is kept unless the
+// condition flags disagree, otherwise the state follows the flags, deleted
+// taking precedence over active over proposed. A status that is not kept is
+// recorded in the requirement's history. The flags are then made to agree
+// with the state.
+func flagsToWorkflowState(doc map[string]any) ([]string, error) {
+	pd, ok := doc["projectdata"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	wf := DefaultWorkflow()
+	now := time.Now().UTC()
+	var changes []string
+	for i, r := range tables(pd["requirements"]) {
+		cond, _ := r["condition"].(map[string]any)
+		if cond == nil {
+			cond = map[string]any{}
+			r["condition"] = cond
+		}
+		flag := func(k string) bool { b, _ := cond[k].(bool); return b }
+		old, _ := r["status"].(string)
+		name, kept := wf.resolve(old, ConditionType{
+			Proposed: flag("proposed"),
+			Active:   flag("active"),
+			Deleted:  flag("deleted"),
+		})
+		st, _ := wf.State(name)
+		if old != st.Name {
+			changes = append(changes, fmt.Sprintf("requirements[%d]: status %q -> %q", i, old, st.Name))
+		}
+		if !kept && old != "" {
+			r["history"] = append(toAnySlice(r["history"]), map[string]any{
+				"timestamp": now,
+				"user":      ActorSystem,
+				"comment":   "status set from the condition flags by the schema migration",
+				"fields":    []any{map[string]any{"field": "status", "before": old, "after": st.Name}},
+			})
+		}
+		r["status"] = st.Name
+		cond["proposed"] = st.Kind == StateProposed
+		cond["active"] = st.Kind == StateActive
+		cond["deleted"] = st.Kind == StateRetired
+	}
+	return changes, nil
+}
+
+// parentIndexToID turns each requirement's parent_id, a slice index with -1
+// for none, into the ID of the requirement at that index and derives level
+// from the result. A parent_id of 0 was also written for requirements
+// without a parent; it is read as index 0 only for requirements with a
+// level, and reported as ambiguous for AI suggestions without one, which are
+// left at the top level. Self references and references that would form a
+// cycle are cleared.
+func parentIndexToID(doc map[string]any) ([]string, error) {
+	pd, ok := doc["projectdata"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	reqs := tables(pd["requirements"])
+	var changes []string
+	parent := make(map[int]int, len(reqs))
+	for i, r := range reqs {
+		id, _ := r["id"].(int64)
+		idx, _ := r["parent_id"].(int64)
+		first := false
+		if idx == 0 && i > 0 {
+			level, _ := r["level"].(int64)
+			cond, _ := r["condition"].(map[string]any)
+			ai, _ := cond["aigenerated"].(bool)
+			switch {
+			case level > 0:
+				first = true
+			case ai:
+				changes = append(changes, fmt.Sprintf("requirements[%d]: parent_id 0 is ambiguous (requirements[0] or none); left without parent", i))
+			}
+		}
+		var pid int64
+		if (idx > 0 || first) && int(idx) < len(reqs) && int(idx) != i {
+			pid, _ = reqs[idx]["id"].(int64)
+		}
+		if pid != idx {
+			changes = append(changes, fmt.Sprintf("requirements[%d]: parent_id %d -> %d", i, idx, pid))
+		}
+		r["parent_id"] = pid
+		if id != 0 {
+			parent[int(id)] = int(pid)
+		}
+	}
+	for {
+		_, cyclic := hierarchyLevels(parent)
+		if len(cyclic) == 0 {
+			break
+		}
+		// Promote the lowest ID on the cycle to the top level.
+		parent[cyclic[0]] = 0
+		for i, r := range reqs {
+			if id, _ := r["id"].(int64); int(id) == cyclic[0] {
+				r["parent_id"] = int64(0)
+				changes = append(changes, fmt.Sprintf("requirements[%d]: parent_id cleared to break a cycle", i))
+			}
+		}
+	}
+	levels, _ := hierarchyLevels(parent)
+	for _, r := range reqs {
+		id, _ := r["id"].(int64)
+		pid, _ := r["parent_id"].(int64)
+		level := levels[int(id)]
+		if id == 0 {
+			level = levels[int(pid)] + 1
+		}
+		r["level"] = int64(level)
+	}
+	return changes, nil
+}
+
+// linkIntelligenceByID replaces the intelligence copies stored on each
+// requirement with ID links on the project and records the attachment each
+// intelligence entry was extracted from, matched by path.
+func linkIntelligenceByID(doc map[string]any) ([]string, error) {
+	pd, ok := doc["projectdata"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	var changes []string
+	attByPath := map[string]int64{}
+	for _, a := range tables(pd["attachments"]) {
+		if p, _ := a["rel_path"].(string); p != "" {
+			attByPath[p], _ = a["id"].(int64)
+		}
+	}
+	attOf := map[int64]int64{}
+	for i, in := range tables(pd["intelligence"]) {
+		id, _ := in["id"].(int64)
+		p, _ := in["Filepath"].(string)
+		if _, ok := in["attachment_id"]; !ok {
+			in["attachment_id"] = attByPath[p]
+			if attByPath[p] != 0 {
+				changes = append(changes, fmt.Sprintf("intelligence[%d]: attachment_id %d", i, attByPath[p]))
+			}
+		}
+		attOf[id], _ = in["attachment_id"].(int64)
+	}
+	var links []any
+	for i, r := range tables(pd["requirements"]) {
+		old, ok := r["intelligence_links"]
+		if !ok {
+			continue
+		}
+		delete(r, "intelligence_links")
+		rid, _ := r["id"].(int64)
+		for _, in := range tables(old) {
+			id, _ := in["id"].(int64)
+			if id == 0 || rid == 0 {
+				continue
+			}
+			links = append(links, map[string]any{"intelligence_id": id, "attachment_id": attOf[id], "requirement_id": rid})
+			changes = append(changes, fmt.Sprintf("requirements[%d]: linked intelligence %d", i, id))
+		}
+	}
+	if len(links) > 0 {
+		pd["intelligence_links"] = append(toAnySlice(pd["intelligence_links"]), links...)
+	}
+	return changes, nil
+}
+
+// toAnySlice returns the elements of a decoded TOML array.
+func toAnySlice(v any) []any {
+	switch t := v.(type) {
+	case []any:
+		return t
+	case []map[string]any:
+		out := make([]any, len(t))
+		for i := range t {
+			out[i] = t[i]
+		}
+		return out
+	}
+	return nil
+}
+
+// assignRequirementKeys gives every requirement without a key the default
+// key built from the project's IDs and the requirement ID, and starts the
+// key sequence after the highest ID.
+func assignRequirementKeys(doc map[string]any) ([]string, error) {
+	productID, _ := doc["productid"].(int64)
+	projectID, _ := doc["id"].(int64)
+	pd, ok := doc["projectdata"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	prefix := defaultKeyPrefix(int(productID), int(projectID))
+	var changes []string
+	var maxID int64
+	for i, r := range tables(pd["requirements"]) {
+		id, _ := r["id"].(int64)
+		maxID = max(maxID, id)
+		if k, _ := r["key"].(string); k != "" || id == 0 {
+			continue
+		}
+		r["key"] = formatKey(prefix, int(id))
+		changes = append(changes, fmt.Sprintf("requirements[%d]: key %s", i, r["key"]))
+	}
+	if _, ok := pd["next_key_seq"]; !ok {
+		pd["next_key_seq"] = maxID + 1
+	}
+	return changes, nil
+}
+
+// tables returns the elements of a decoded TOML array of tables.
+func tables(v any) []map[string]any {
+	switch t := v.(type) {
+	case []map[string]any:
+		return t
+	case []any:
+		out := make([]map[string]any, 0, len(t))
+		for _, e := range t {
+			if m, ok := e.(map[string]any); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// renameKey renames every occurrence of key from to key to within the tree
+// rooted at v and reports the paths changed.
+func renameKey(v any, path, from, to string) []string {
+	var changes []string
+	switch t := v.(type) {
+	case map[string]any:
+		if old, ok := t[from]; ok {
+			delete(t, from)
+			t[to] = old
+			changes = append(changes, fmt.Sprintf("%s: renamed %s to %s", joinPath(path, from), from, to))
+		}
+		for k, child := range t {
+			changes = append(changes, renameKey(child, joinPath(path, k), from, to)...)
+		}
+	case []any:
+		for i, child := range t {
+			changes = append(changes, renameKey(child, fmt.Sprintf("%s[%d]", path, i), from, to)...)
+		}
+	case []map[string]any:
+		for i, child := range t {
+			changes = append(changes, renameKey(child, fmt.Sprintf("%s[%d]", path, i), from, to)...)
+		}
+	}
+	return changes
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
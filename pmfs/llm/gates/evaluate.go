@@ -12,16 +12,26 @@ type Result struct {
 	FollowUp string
 }
 
+// Context holds project data for gates, keyed by Gate.Context, as text to
+// include in their prompts.
+type Context map[string]string
+
 // Evaluate runs the specified gates against the provided text using the LLM client.
 // It returns a Result for each gate in the same order as gateIDs.
 func Evaluate(client llm.Client, gateIDs []string, text string) ([]Result, error) {
+	return EvaluateWithContext(client, gateIDs, text, nil)
+}
+
+// EvaluateWithContext is Evaluate with project data: gates naming a Context
+// entry get its text appended to their prompt.
+func EvaluateWithContext(client llm.Client, gateIDs []string, text string, ctx Context) ([]Result, error) {
 	var results []Result
 	for _, id := range gateIDs {
 		g, err := GetGate(id)
 		if err != nil {
 			return nil, err
 		}
-		pass, follow, err := interact.RunQuestion(client, "quality_gate", g.ID, text)
+		pass, follow, err := interact.RunQuestionWithContext(client, "quality_gate", g.ID, text, ctx[g.Context])
 		if err != nil {
 			return nil, err
 		}
@@ -11,6 +11,9 @@ type Gate struct {
 	ID       string
 	Question string
 	FollowUp string
+	// Context names the project data the gate is asked with, such as
+	// "glossary"; see EvaluateWithContext.
+	Context string
 }
 
 var (
@@ -22,9 +25,8 @@ func register(g Gate) {
 	registry[g.ID] = g
 	template := fmt.Sprintf("Given the requirement %%s, %s Answer yes or no.", g.Question)
 	gatePrompts = append(gatePrompts, prompts.Prompt{ID: g.ID, Template: template, FollowUp: g.FollowUp})
-}
-
-func init() {
+	// Re-register on every gate so gates from files initialized later are
+	// included as well.
 	prompts.RegisterRole("quality_gate", gatePrompts)
 }
 
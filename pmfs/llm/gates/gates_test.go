@@ -86,3 +86,22 @@ func TestEvaluate(t *testing.T) {
 		t.Fatalf("unexpected follow-up %q", m["duplicate-1"].FollowUp)
 	}
 }
+
+func TestEvaluateWithContext(t *testing.T) {
+	text := "The ECU shall log faults"
+	g, _ := GetGate("glossary-gaps-2")
+	expected := fmt.Sprintf("Given the requirement %s, %s Answer yes or no.\n\nProject glossary:\n- ECU", text, g.Question)
+	c := gemini.ClientFunc{AskFunc: func(prompt string) (string, error) {
+		if prompt != expected {
+			t.Fatalf("unexpected prompt %q", prompt)
+		}
+		return "Yes", nil
+	}}
+	res, err := EvaluateWithContext(c, []string{"glossary-gaps-2"}, text, Context{"glossary": "Project glossary:\n- ECU"})
+	if err != nil {
+		t.Fatalf("EvaluateWithContext: %v", err)
+	}
+	if len(res) != 1 || !res[0].Pass {
+		t.Fatalf("unexpected results %#v", res)
+	}
+}
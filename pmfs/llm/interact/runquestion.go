@@ -16,6 +16,13 @@ import (
 // follow-up question, the follow-up is sent and its response returned alongside
 // the false result.
 func RunQuestion(client llm.Client, role, questionID, text string) (bool, string, error) {
+	return RunQuestionWithContext(client, role, questionID, text, "")
+}
+
+// RunQuestionWithContext is RunQuestion with context, such as a project
+// glossary, appended to the question after a blank line. An empty context
+// asks the plain question.
+func RunQuestionWithContext(client llm.Client, role, questionID, text, context string) (bool, string, error) {
 	ps, err := prompts.GetPrompts(role)
 	if err != nil {
 		return false, "", err
@@ -32,6 +39,9 @@ func RunQuestion(client llm.Client, role, questionID, text string) (bool, string
 	}
 
 	prompt := fmt.Sprintf(p.Template, text)
+	if context != "" {
+		prompt += "\n\n" + context
+	}
 	resp, err := client.Ask(prompt)
 	if err != nil {
 		return false, "", err
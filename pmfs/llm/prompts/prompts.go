@@ -7,6 +7,7 @@ package prompts
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -30,6 +31,16 @@ func RegisterRole(role string, prompts []Prompt) {
 	rolePrompts[strings.ToLower(role)] = prompts
 }
 
+// Roles returns the names of the registered roles in sorted order.
+func Roles() []string {
+	roles := make([]string, 0, len(rolePrompts))
+	for r := range rolePrompts {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
 // SetTestPrompts registers prompts used when GetPrompts is called with role "test".
 // It allows integration tests to supply deterministic questions and follow-ups.
 func SetTestPrompts(ps []Prompt) { testPrompts = ps }
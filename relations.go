@@ -0,0 +1,260 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RelationType is the kind of edge between two requirements.
+type RelationType string
+
+const (
+	// DependsOn means From cannot be fulfilled before To. Depends-on edges
+	// must not form cycles.
+	DependsOn RelationType = "depends-on"
+	// Refines means From details To.
+	Refines RelationType = "refines"
+	// Conflicts means From and To cannot both be fulfilled. The relation is
+	// symmetric.
+	Conflicts RelationType = "conflicts"
+	// Derives means From was derived from To.
+	Derives RelationType = "derives"
+)
+
+// RelationTypes lists the supported relation types.
+var RelationTypes = []RelationType{DependsOn, Refines, Conflicts, Derives}
+
+var (
+	// ErrRelationNotFound is returned when removing an edge that does not exist.
+	ErrRelationNotFound = errors.New("relation not found")
+	// ErrRelationCycle is returned when a depends-on edge would close a cycle.
+	ErrRelationCycle = errors.New("relation would create a depends-on cycle")
+)
+
+// RequirementRelation is a typed edge between two requirements of a project,
+// referenced by requirement ID.
+type RequirementRelation struct {
+	From int          `json:"from" toml:"from"`
+	To   int          `json:"to" toml:"to"`
+	Type RelationType `json:"type" toml:"type"`
+	// Score is the LLM's confidence in the relation, from 0 to 1. It is zero
+	// for relations that were not scored.
+	Score float64 `json:"score,omitempty" toml:"score,omitempty"`
+}
+
+// connects reports whether rel is the edge from -> to of type t, treating
+// conflicts as undirected.
+func (rel RequirementRelation) connects(from, to int, t RelationType) bool {
+	if rel.Type != t {
+		return false
+	}
+	if rel.From == from && rel.To == to {
+		return true
+	}
+	return t == Conflicts && rel.From == to && rel.To == from
+}
+
+func validRelationType(t RelationType) bool {
+	for _, rt := range RelationTypes {
+		if rt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRelation adds the edge from -> to of type t and persists the project.
+// Adding an existing edge only updates its score. Both requirements must
+// exist, and depends-on edges closing a cycle are rejected with
+// ErrRelationCycle.
+func (prj *ProjectType) AddRelation(from, to int, t RelationType, score float64) error {
+	if err := prj.addRelation(RequirementRelation{From: from, To: to, Type: t, Score: score}); err != nil {
+		return err
+	}
+	return prj.Save()
+}
+
+// addRelation implements AddRelation without saving.
+func (prj *ProjectType) addRelation(rel RequirementRelation) error {
+	if !validRelationType(rel.Type) {
+		return fmt.Errorf("unknown relation type %q", rel.Type)
+	}
+	if rel.From == rel.To {
+		return fmt.Errorf("requirement %d cannot relate to itself", rel.From)
+	}
+	if rel.Score < 0 || rel.Score > 1 {
+		return fmt.Errorf("relation score %v outside [0, 1]", rel.Score)
+	}
+	for _, id := range []int{rel.From, rel.To} {
+		if _, err := prj.RequirementByID(id); err != nil {
+			return err
+		}
+	}
+	for i := range prj.D.RequirementRelations {
+		if prj.D.RequirementRelations[i].connects(rel.From, rel.To, rel.Type) {
+			prj.D.RequirementRelations[i].Score = rel.Score
+			return nil
+		}
+	}
+	if rel.Type == DependsOn && prj.dependsOnPath(rel.To, rel.From) {
+		return fmt.Errorf("%d %s %d: %w", rel.From, rel.Type, rel.To, ErrRelationCycle)
+	}
+	prj.D.RequirementRelations = append(prj.D.RequirementRelations, rel)
+	return nil
+}
+
+// RemoveRelation removes the edge from -> to of type t and persists the
+// project.
+func (prj *ProjectType) RemoveRelation(from, to int, t RelationType) error {
+	for i, rel := range prj.D.RequirementRelations {
+		if rel.connects(from, to, t) {
+			prj.D.RequirementRelations = append(prj.D.RequirementRelations[:i], prj.D.RequirementRelations[i+1:]...)
+			return prj.Save()
+		}
+	}
+	return fmt.Errorf("%d %s %d: %w", from, t, to, ErrRelationNotFound)
+}
+
+// removeRelationsOf drops every edge touching the requirement.
+func (prj *ProjectType) removeRelationsOf(id int) {
+	out := prj.D.RequirementRelations[:0]
+	for _, rel := range prj.D.RequirementRelations {
+		if rel.From != id && rel.To != id {
+			out = append(out, rel)
+		}
+	}
+	prj.D.RequirementRelations = out
+}
+
+// Neighbor is a requirement related to another one.
+type Neighbor struct {
+	ID   int          `json:"id"`
+	Type RelationType `json:"type"`
+	// Outgoing is true when the queried requirement is the edge's From.
+	Outgoing bool    `json:"outgoing"`
+	Score    float64 `json:"score,omitempty"`
+}
+
+// Neighbors returns the requirements related to id, in both directions. When
+// types are given only edges of those types are considered.
+func (prj *ProjectType) Neighbors(id int, types ...RelationType) []Neighbor {
+	out := []Neighbor{}
+	for _, rel := range prj.D.RequirementRelations {
+		if len(types) > 0 && !containsType(types, rel.Type) {
+			continue
+		}
+		switch id {
+		case rel.From:
+			out = append(out, Neighbor{ID: rel.To, Type: rel.Type, Outgoing: true, Score: rel.Score})
+		case rel.To:
+			out = append(out, Neighbor{ID: rel.From, Type: rel.Type, Outgoing: false, Score: rel.Score})
+		}
+	}
+	return out
+}
+
+func containsType(types []RelationType, t RelationType) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOn returns the depends-on adjacency of the project.
+func (prj *ProjectType) dependsOn() map[int][]int {
+	adj := map[int][]int{}
+	for _, rel := range prj.D.RequirementRelations {
+		if rel.Type == DependsOn {
+			adj[rel.From] = append(adj[rel.From], rel.To)
+		}
+	}
+	return adj
+}
+
+// dependsOnPath reports whether from reaches to over depends-on edges.
+func (prj *ProjectType) dependsOnPath(from, to int) bool {
+	adj := prj.dependsOn()
+	seen := map[int]bool{}
+	stack := []int{from}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == to {
+			return true
+		}
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		stack = append(stack, adj[n]...)
+	}
+	return false
+}
+
+// DependencyCycles returns the depends-on cycles found by a depth-first
+// search, each as the requirement IDs along it; an empty result means there
+// are none. AddRelation and ImportExcel prevent cycles, but hand-edited
+// project files may still contain them.
+func (prj *ProjectType) DependencyCycles() [][]int {
+	adj := prj.dependsOn()
+	nodes := make([]int, 0, len(adj))
+	for n := range adj {
+		nodes = append(nodes, n)
+	}
+	sort.Ints(nodes)
+
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	state := map[int]int{}
+	var path []int
+	var cycles [][]int
+	var visit func(n int)
+	visit = func(n int) {
+		state[n] = onStack
+		path = append(path, n)
+		for _, m := range adj[n] {
+			switch state[m] {
+			case unvisited:
+				visit(m)
+			case onStack:
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == m {
+						cycles = append(cycles, append([]int(nil), path[i:]...))
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = done
+	}
+	for _, n := range nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return cycles
+}
+
+// Orphans returns the requirements that take part in no relation. Deleted
+// requirements are skipped.
+func (prj *ProjectType) Orphans() []Requirement {
+	linked := map[int]bool{}
+	for _, rel := range prj.D.RequirementRelations {
+		linked[rel.From] = true
+		linked[rel.To] = true
+	}
+	out := []Requirement{}
+	for _, r := range prj.D.Requirements {
+		if !r.Condition.Deleted && !linked[r.ID] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newRelationsProject returns a saved project with requirements 1 to 4.
+func newRelationsProject(t *testing.T) *ProjectType {
+	t.Helper()
+	_, prj, _ := newKeysDB(t)
+	for _, name := range []string{"R1", "R2", "R3", "R4"} {
+		prj.D.Requirements = append(prj.D.Requirements, Requirement{Name: name})
+	}
+	prj.ensureRequirementIDs()
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return prj
+}
+
+func TestRelations(t *testing.T) {
+	prj := newRelationsProject(t)
+	if err := prj.AddRelation(1, 2, DependsOn, 0); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	if err := prj.AddRelation(2, 3, DependsOn, 0.8); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	if err := prj.AddRelation(3, 1, DependsOn, 0); !errors.Is(err, ErrRelationCycle) {
+		t.Fatalf("expected ErrRelationCycle, got %v", err)
+	}
+	if err := prj.AddRelation(3, 2, Conflicts, 0.5); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	// Conflicts are symmetric, so the reverse edge only updates the score.
+	if err := prj.AddRelation(2, 3, Conflicts, 0.9); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	if err := prj.AddRelation(1, 9, Refines, 0); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected ErrRequirementNotFound, got %v", err)
+	}
+	if len(prj.D.RequirementRelations) != 3 {
+		t.Fatalf("relations = %#v", prj.D.RequirementRelations)
+	}
+
+	want := []Neighbor{
+		{ID: 1, Type: DependsOn, Outgoing: false},
+		{ID: 3, Type: DependsOn, Outgoing: true, Score: 0.8},
+		{ID: 3, Type: Conflicts, Outgoing: false, Score: 0.9},
+	}
+	if got := prj.Neighbors(2); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Neighbors = %#v", got)
+	}
+	if got := prj.Neighbors(2, Conflicts); len(got) != 1 {
+		t.Fatalf("filtered Neighbors = %#v", got)
+	}
+	if o := prj.Orphans(); len(o) != 1 || o[0].ID != 4 {
+		t.Fatalf("Orphans = %#v", o)
+	}
+
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(prj.D.RequirementRelations) != 3 {
+		t.Fatalf("relations not persisted: %#v", prj.D.RequirementRelations)
+	}
+	if err := prj.RemoveRelation(3, 2, Conflicts); err != nil {
+		t.Fatalf("RemoveRelation: %v", err)
+	}
+	if err := prj.RemoveRelation(3, 2, Conflicts); !errors.Is(err, ErrRelationNotFound) {
+		t.Fatalf("expected ErrRelationNotFound, got %v", err)
+	}
+}
+
+func TestDependencyCycles(t *testing.T) {
+	prj := &ProjectType{D: ProjectData{RequirementRelations: []RequirementRelation{
+		{From: 1, To: 2, Type: DependsOn},
+		{From: 2, To: 3, Type: DependsOn},
+		{From: 3, To: 1, Type: DependsOn},
+		{From: 3, To: 4, Type: Refines},
+		{From: 4, To: 3, Type: Refines},
+	}}}
+	if got := prj.DependencyCycles(); !reflect.DeepEqual(got, [][]int{{1, 2, 3}}) {
+		t.Fatalf("DependencyCycles = %v", got)
+	}
+	prj.D.RequirementRelations = prj.D.RequirementRelations[:2]
+	if got := prj.DependencyCycles(); len(got) != 0 {
+		t.Fatalf("unexpected cycles %v", got)
+	}
+}
+
+func TestRelationsExcelRoundTrip(t *testing.T) {
+	prj := newRelationsProject(t)
+	if err := prj.AddRelation(1, 2, Refines, 0.25); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "prj.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	pd, err := ImportProjectExcel(path)
+	if err != nil {
+		t.Fatalf("ImportProjectExcel: %v", err)
+	}
+	want := []RequirementRelation{{From: 1, To: 2, Type: Refines, Score: 0.25}}
+	if !reflect.DeepEqual(pd.RequirementRelations, want) {
+		t.Fatalf("relations = %#v", pd.RequirementRelations)
+	}
+
+	// Importing into another project maps the workbook IDs to new ones.
+	other := newRelationsProject(t)
+	other.D.Requirements = other.D.Requirements[:1]
+	other.D.Requirements[0].Key = "other"
+	if err := other.ImportExcel(path, false); err != nil {
+		t.Fatalf("ImportExcel: %v", err)
+	}
+	r1, _ := other.RequirementByKey("PRD1-PRJ1-REQ-0001")
+	r2, _ := other.RequirementByKey("PRD1-PRJ1-REQ-0002")
+	if r1 == nil || r2 == nil || r1.ID == 1 {
+		t.Fatalf("unexpected import: %#v", other.D.Requirements)
+	}
+	got := other.D.RequirementRelations
+	if len(got) != 1 || got[0].From != r1.ID || got[0].To != r2.ID {
+		t.Fatalf("relations not remapped: %#v", got)
+	}
+}
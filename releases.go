@@ -0,0 +1,315 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrReleaseNotFound is returned when no release has the given ID.
+	ErrReleaseNotFound = errors.New("release not found")
+	// ErrScheduleConflict is returned when a requirement would be planned
+	// before a requirement it depends on.
+	ErrScheduleConflict = errors.New("schedule conflict")
+	// ErrOverCapacity is returned when a release has no room left.
+	ErrOverCapacity = errors.New("release over capacity")
+)
+
+// Milestone is a dated checkpoint within a release, such as a feature freeze.
+type Milestone struct {
+	Name string    `json:"name" toml:"name"`
+	Date time.Time `json:"date" toml:"date"`
+}
+
+// Release is a planned delivery requirements are assigned to through
+// Requirement.ReleaseID. Releases are ordered by Date. Capacity limits the
+// number of requirements planned in the release; zero means unlimited.
+type Release struct {
+	ID          int         `json:"id" toml:"id"`
+	Name        string      `json:"name" toml:"name"`
+	Description string      `json:"description,omitempty" toml:"description"`
+	StartDate   time.Time   `json:"start_date" toml:"start_date"`
+	Date        time.Time   `json:"date" toml:"date"` // release date
+	Capacity    int         `json:"capacity,omitempty" toml:"capacity"`
+	Milestones  []Milestone `json:"milestones,omitempty" toml:"milestones"`
+}
+
+// validate checks the release's name and dates.
+func (rel Release) validate() error {
+	if strings.TrimSpace(rel.Name) == "" {
+		return errors.New("release name is empty")
+	}
+	if rel.Date.IsZero() {
+		return fmt.Errorf("release %s: date is missing", rel.Name)
+	}
+	if !rel.StartDate.IsZero() && rel.StartDate.After(rel.Date) {
+		return fmt.Errorf("release %s: starts after its date", rel.Name)
+	}
+	if rel.Capacity < 0 {
+		return fmt.Errorf("release %s: negative capacity %d", rel.Name, rel.Capacity)
+	}
+	return nil
+}
+
+// Releases returns the project's releases ordered by date.
+func (prj *ProjectType) Releases() []Release {
+	out := append([]Release{}, prj.D.Releases...)
+	slices.SortStableFunc(out, func(a, b Release) int { return a.Date.Compare(b.Date) })
+	return out
+}
+
+// ReleaseByID returns the release with the given ID.
+func (prj *ProjectType) ReleaseByID(id int) (*Release, error) {
+	for i := range prj.D.Releases {
+		if prj.D.Releases[i].ID == id {
+			return &prj.D.Releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %d: %w", id, ErrReleaseNotFound)
+}
+
+// nextReleaseID returns the next release ID and advances the project's
+// counter, raising it past existing IDs for projects edited by hand.
+func (prj *ProjectType) nextReleaseID() int {
+	id := max(prj.D.NextReleaseID, 1)
+	for _, rel := range prj.D.Releases {
+		id = max(id, rel.ID+1)
+	}
+	prj.D.NextReleaseID = id + 1
+	return id
+}
+
+// AddRelease adds rel with a new ID and persists the project. It returns the
+// stored release.
+func (prj *ProjectType) AddRelease(rel Release) (*Release, error) {
+	if err := rel.validate(); err != nil {
+		return nil, err
+	}
+	rel.ID = prj.nextReleaseID()
+	prj.D.Releases = append(prj.D.Releases, rel)
+	if err := prj.Save(); err != nil {
+		return nil, err
+	}
+	return &prj.D.Releases[len(prj.D.Releases)-1], nil
+}
+
+// UpdateRelease replaces the release with rel's ID and persists the project.
+// Moving the release date must not break the dependency order or capacity of
+// its requirements.
+func (prj *ProjectType) UpdateRelease(rel Release) error {
+	ex, err := prj.ReleaseByID(rel.ID)
+	if err != nil {
+		return err
+	}
+	if err := rel.validate(); err != nil {
+		return err
+	}
+	if n := len(prj.releaseRequirements(rel.ID)); rel.Capacity > 0 && n > rel.Capacity {
+		return fmt.Errorf("release %s: %d planned, capacity %d: %w", rel.Name, n, rel.Capacity, ErrOverCapacity)
+	}
+	old := *ex
+	*ex = rel
+	if err := prj.checkRelease(rel.ID); err != nil {
+		*ex = old
+		return err
+	}
+	return prj.Save()
+}
+
+// RemoveRelease drops the release, unplanning its requirements, and persists
+// the project. It fails while a planned requirement depends on one of them.
+func (prj *ProjectType) RemoveRelease(id int) error {
+	if _, err := prj.ReleaseByID(id); err != nil {
+		return err
+	}
+	for _, r := range prj.D.Requirements {
+		if r.ReleaseID != id {
+			continue
+		}
+		if err := prj.checkPlan(r.ID, 0); err != nil {
+			return err
+		}
+	}
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		if r.ReleaseID == id {
+			before := r.snapshot()
+			r.ReleaseID = 0
+			r.recordSince(before, prj.user(), "release removed")
+		}
+	}
+	prj.D.Releases = slices.DeleteFunc(prj.D.Releases, func(rel Release) bool { return rel.ID == id })
+	return prj.Save()
+}
+
+// AssignRelease plans the requirement in the release, or unplans it when
+// releaseID is 0, and persists the project. The requirement must not be
+// planned before a requirement it depends on, nor after one depending on it,
+// and the release must have capacity left.
+func (prj *ProjectType) AssignRelease(id, releaseID int) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	if r.ReleaseID == releaseID {
+		return nil
+	}
+	if releaseID != 0 {
+		rel, err := prj.ReleaseByID(releaseID)
+		if err != nil {
+			return err
+		}
+		if rel.Capacity > 0 && len(prj.releaseRequirements(releaseID)) >= rel.Capacity {
+			return fmt.Errorf("release %s: %d requirements: %w", rel.Name, rel.Capacity, ErrOverCapacity)
+		}
+	}
+	if err := prj.checkPlan(id, releaseID); err != nil {
+		return err
+	}
+	before := r.snapshot()
+	r.ReleaseID = releaseID
+	r.recordSince(before, prj.user(), "release assigned")
+	return prj.Save()
+}
+
+// releaseRequirements returns the IDs of the requirements planned in the
+// release.
+func (prj *ProjectType) releaseRequirements(releaseID int) []int {
+	var ids []int
+	for _, r := range prj.D.Requirements {
+		if r.ReleaseID == releaseID && !r.Condition.Deleted {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// ScheduleConflict is a requirement planned before a requirement it depends
+// on. DependencyRelease is 0 when the dependency is not planned at all.
+type ScheduleConflict struct {
+	RequirementID     int `json:"requirement_id"`
+	ReleaseID         int `json:"release_id"`
+	DependsOnID       int `json:"depends_on_id"`
+	DependencyRelease int `json:"dependency_release_id"`
+}
+
+func (c ScheduleConflict) String() string {
+	if c.DependencyRelease == 0 {
+		return fmt.Sprintf("requirement %d (release %d) depends on unplanned requirement %d", c.RequirementID, c.ReleaseID, c.DependsOnID)
+	}
+	return fmt.Sprintf("requirement %d (release %d) depends on requirement %d of later release %d", c.RequirementID, c.ReleaseID, c.DependsOnID, c.DependencyRelease)
+}
+
+// scheduleConflicts returns the depends-on edges that break the release
+// order when the requirements are planned as in plan, by requirement ID.
+func (prj *ProjectType) scheduleConflicts(plan map[int]int) []ScheduleConflict {
+	dates := map[int]time.Time{}
+	for _, rel := range prj.D.Releases {
+		dates[rel.ID] = rel.Date
+	}
+	var out []ScheduleConflict
+	for _, rel := range prj.D.RequirementRelations {
+		if rel.Type != DependsOn {
+			continue
+		}
+		from := plan[rel.From]
+		to, ok := plan[rel.To]
+		if from == 0 || !ok {
+			continue
+		}
+		if to == 0 || dates[to].After(dates[from]) {
+			out = append(out, ScheduleConflict{RequirementID: rel.From, ReleaseID: from, DependsOnID: rel.To, DependencyRelease: to})
+		}
+	}
+	return out
+}
+
+// plan returns the release of every requirement that is not deleted;
+// dependencies on deleted requirements are ignored.
+func (prj *ProjectType) plan() map[int]int {
+	plan := map[int]int{}
+	for _, r := range prj.D.Requirements {
+		if !r.Condition.Deleted {
+			plan[r.ID] = r.ReleaseID
+		}
+	}
+	return plan
+}
+
+// conflictError joins conflicts into an ErrScheduleConflict.
+func conflictError(conflicts []ScheduleConflict) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		msgs[i] = c.String()
+	}
+	return fmt.Errorf("%s: %w", strings.Join(msgs, "; "), ErrScheduleConflict)
+}
+
+// checkPlan reports the new conflicts of planning requirement id in the
+// release.
+func (prj *ProjectType) checkPlan(id, releaseID int) error {
+	plan := prj.plan()
+	plan[id] = releaseID
+	var conflicts []ScheduleConflict
+	for _, c := range prj.scheduleConflicts(plan) {
+		if c.RequirementID == id || c.DependsOnID == id {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflictError(conflicts)
+}
+
+// checkRelease reports the conflicts involving the release's requirements.
+func (prj *ProjectType) checkRelease(releaseID int) error {
+	var conflicts []ScheduleConflict
+	for _, c := range prj.scheduleConflicts(prj.plan()) {
+		if c.ReleaseID == releaseID || c.DependencyRelease == releaseID {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflictError(conflicts)
+}
+
+// ScheduleConflicts returns every planned requirement that depends on a
+// requirement planned in a later release or not planned at all.
+func (prj *ProjectType) ScheduleConflicts() []ScheduleConflict {
+	return prj.scheduleConflicts(prj.plan())
+}
+
+// ReleaseReport is the scope report of a release.
+type ReleaseReport struct {
+	Release        Release            `json:"release"`
+	RequirementIDs []int              `json:"requirement_ids"`
+	Load           int                `json:"load"`               // requirements planned
+	Capacity       int                `json:"capacity,omitempty"` // 0 when unlimited
+	ByStatus       map[string]int     `json:"by_status"`
+	Conflicts      []ScheduleConflict `json:"conflicts"`
+}
+
+// ReleaseScope reports the requirements planned in the release with their
+// workflow states and the schedule conflicts involving them.
+func (prj *ProjectType) ReleaseScope(releaseID int) (ReleaseReport, error) {
+	rel, err := prj.ReleaseByID(releaseID)
+	if err != nil {
+		return ReleaseReport{}, err
+	}
+	sc := ReleaseReport{Release: *rel, RequirementIDs: []int{}, Capacity: rel.Capacity, ByStatus: map[string]int{}, Conflicts: []ScheduleConflict{}}
+	for _, id := range prj.releaseRequirements(releaseID) {
+		r, _ := prj.RequirementByID(id)
+		sc.RequirementIDs = append(sc.RequirementIDs, id)
+		sc.ByStatus[prj.stateOf(r)]++
+	}
+	sc.Load = len(sc.RequirementIDs)
+	for _, c := range prj.ScheduleConflicts() {
+		if c.ReleaseID == releaseID || c.DependencyRelease == releaseID {
+			sc.Conflicts = append(sc.Conflicts, c)
+		}
+	}
+	return sc, nil
+}
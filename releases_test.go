@@ -0,0 +1,95 @@
+package PMFS
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReleasePlanning(t *testing.T) {
+	prj := newRelationsProject(t)
+	// R1 depends on R2.
+	if err := prj.AddRelation(1, 2, DependsOn, 0); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	if _, err := prj.AddRelease(Release{Name: "1.0"}); err == nil {
+		t.Fatalf("expected release without date to be rejected")
+	}
+	v2, err := prj.AddRelease(Release{Name: "2.0", Date: day(20), Milestones: []Milestone{{Name: "Freeze", Date: day(15)}}})
+	if err != nil {
+		t.Fatalf("AddRelease: %v", err)
+	}
+	v1, err := prj.AddRelease(Release{Name: "1.0", StartDate: day(1), Date: day(10), Capacity: 2})
+	if err != nil {
+		t.Fatalf("AddRelease: %v", err)
+	}
+	v1ID, v2ID := v1.ID, v2.ID
+	if rs := prj.Releases(); rs[0].ID != v1ID || rs[1].ID != v2ID {
+		t.Fatalf("releases not ordered by date: %#v", rs)
+	}
+
+	if err := prj.AssignRelease(1, v1ID); !errors.Is(err, ErrScheduleConflict) {
+		t.Fatalf("expected unplanned dependency to conflict, got %v", err)
+	}
+	if err := prj.AssignRelease(2, v2ID); err != nil {
+		t.Fatalf("AssignRelease: %v", err)
+	}
+	if err := prj.AssignRelease(1, v1ID); !errors.Is(err, ErrScheduleConflict) {
+		t.Fatalf("expected later dependency to conflict, got %v", err)
+	}
+	if err := prj.AssignRelease(1, v2ID); err != nil {
+		t.Fatalf("AssignRelease: %v", err)
+	}
+	// Moving the dependency out of the way of its dependent is rejected too.
+	if err := prj.AssignRelease(2, 0); !errors.Is(err, ErrScheduleConflict) {
+		t.Fatalf("expected unplanning a dependency to conflict, got %v", err)
+	}
+	if err := prj.AssignRelease(2, v1ID); err != nil {
+		t.Fatalf("AssignRelease: %v", err)
+	}
+	if err := prj.AssignRelease(3, v1ID); err != nil {
+		t.Fatalf("AssignRelease: %v", err)
+	}
+	if err := prj.AssignRelease(4, v1ID); !errors.Is(err, ErrOverCapacity) {
+		t.Fatalf("expected ErrOverCapacity, got %v", err)
+	}
+	if err := prj.UpdateRelease(Release{ID: v1ID, Name: "1.0", Date: day(25), Capacity: 2}); !errors.Is(err, ErrScheduleConflict) {
+		t.Fatalf("expected moving 1.0 after 2.0 to conflict, got %v", err)
+	}
+	if r, _ := prj.ReleaseByID(v1ID); !r.Date.Equal(day(10)) {
+		t.Fatalf("rejected update changed the release: %#v", r)
+	}
+	if got := prj.ScheduleConflicts(); len(got) != 0 {
+		t.Fatalf("ScheduleConflicts = %v", got)
+	}
+
+	sc, err := prj.ReleaseScope(v1ID)
+	if err != nil {
+		t.Fatalf("ReleaseScope: %v", err)
+	}
+	if sc.Load != 2 || sc.Capacity != 2 || sc.ByStatus["Draft"] != 2 || len(sc.Conflicts) != 0 {
+		t.Fatalf("unexpected scope: %#v", sc)
+	}
+	if r, _ := prj.RequirementByID(2); lastChange(t, r).Comment != "release assigned" {
+		t.Fatalf("assignment not recorded: %#v", r.History)
+	}
+
+	if err := prj.RemoveRelease(v1ID); !errors.Is(err, ErrScheduleConflict) {
+		t.Fatalf("expected removing a dependency's release to conflict, got %v", err)
+	}
+	if err := prj.RemoveRelease(v2ID); err != nil {
+		t.Fatalf("RemoveRelease: %v", err)
+	}
+	if r, _ := prj.RequirementByID(1); r.ReleaseID != 0 {
+		t.Fatalf("requirement still planned: %#v", r)
+	}
+
+	// The ID of a removed last release is not handed out again.
+	if err := prj.RemoveRelease(v1ID); err != nil {
+		t.Fatalf("RemoveRelease: %v", err)
+	}
+	if rel, err := prj.AddRelease(Release{Name: "3.0", Date: day(30)}); err != nil || rel.ID != 3 {
+		t.Fatalf("AddRelease = %#v, %v", rel, err)
+	}
+}
@@ -3,14 +3,22 @@ package PMFS
 import (
 	"encoding/json"
 	"fmt"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
 )
 
 // SuggestOthers asks the client for related potential requirements based on
 // this requirement's description. Returned requirements are appended to the
-// project (if provided) and persisted immediately.
+// project (if provided) as children of this requirement and persisted
+// immediately. The project's LLM client is used; without a project the
+// default database's client is used.
 func (r *Requirement) SuggestOthers(prj *ProjectType) ([]Requirement, error) {
+	c := defaultDB().client()
+	if prj != nil {
+		c = prj.llm()
+	}
 	prompt := fmt.Sprintf("Given the requirement %q, list other potential requirements (JSON array with `name` and `description`).", r.Description)
-	resp, err := DB.LLM.Ask(prompt)
+	resp, err := c.Ask(prompt)
 	if err != nil {
 		return nil, err
 	}
@@ -23,25 +31,20 @@ func (r *Requirement) SuggestOthers(prj *ProjectType) ([]Requirement, error) {
 		return nil, err
 	}
 
-	parentIdx := -1
+	// Give the parent its ID first so the suggestions can refer to it.
 	if prj != nil {
-		for i := range prj.D.Requirements {
-			if &prj.D.Requirements[i] == r {
-				parentIdx = i
-				break
-			}
-		}
+		prj.ensureRequirementIDs()
 	}
 	for i := range reqs {
-		reqs[i].ParentID = parentIdx
+		reqs[i].ParentID = r.ID
 	}
 	if prj != nil {
 		for i := range reqs {
 			reqs[i].Condition.Proposed = true
 			reqs[i].Condition.AIgenerated = true
 		}
-		prj.D.Requirements = Deduplicate(append(prj.D.Requirements, reqs...), false)
-		prj.ensureRequirementIDs()
+		prj.D.Requirements = append(prj.D.Requirements, reqs...)
+		prj.deduplicate(c, false)
 		if err := prj.Save(); err != nil {
 			return nil, err
 		}
@@ -51,10 +54,15 @@ func (r *Requirement) SuggestOthers(prj *ProjectType) ([]Requirement, error) {
 
 // GenerateDesignAspects asks the client for design improvement topics based on
 // the requirement's description. Returned aspects are appended to the
-// requirement and also returned to the caller.
+// requirement and also returned to the caller. The default database's LLM
+// client is used; ProjectType.GenerateDesignAspectsAll uses the project's.
 func (r *Requirement) GenerateDesignAspects() ([]DesignAspect, error) {
+	return r.generateDesignAspects(defaultDB().client())
+}
+
+func (r *Requirement) generateDesignAspects(c llm.Client) ([]DesignAspect, error) {
 	prompt := fmt.Sprintf("Given the requirement %q, list design improvement topics (JSON array with `name` and `description`).", r.Description)
-	resp, err := DB.LLM.Ask(prompt)
+	resp, err := c.Ask(prompt)
 	if err != nil {
 		return nil, err
 	}
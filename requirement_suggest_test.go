@@ -1,6 +1,7 @@
 package PMFS
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -41,8 +42,8 @@ func TestRequirementSuggestOthers(t *testing.T) {
 	if prj.D.Requirements[0].ID != 1 || prj.D.Requirements[1].ID != 2 {
 		t.Fatalf("IDs not assigned: %#v", prj.D.Requirements)
 	}
-	if prj.D.Requirements[1].ParentID != 0 {
-		t.Fatalf("parent index not set: %#v", prj.D.Requirements[1])
+	if prj.D.Requirements[1].ParentID != prj.D.Requirements[0].ID {
+		t.Fatalf("parent ID not set: %#v", prj.D.Requirements[1])
 	}
 	if !prj.D.Requirements[1].Condition.Proposed || !prj.D.Requirements[1].Condition.AIgenerated {
 		t.Fatalf("condition flags not set correctly: %#v", prj.D.Requirements[1].Condition)
@@ -50,7 +51,7 @@ func TestRequirementSuggestOthers(t *testing.T) {
 	var dp struct {
 		D ProjectData `toml:"projectdata"`
 	}
-	path := filepath.Join(projectDir(prj.ProductID, prj.ID), projectTOML)
+	path := filepath.Join(NewFSStore(dir).ProjectPath(prj.ProductID, prj.ID), projectTOML)
 	if err := readTOML(path, &dp); err != nil {
 		t.Fatalf("readTOML: %v", err)
 	}
@@ -104,14 +105,14 @@ func TestRequirementSuggestOthersCodeFence(t *testing.T) {
 	if len(prj.D.Requirements) != 3 {
 		t.Fatalf("requirements not appended: %#v", prj.D.Requirements)
 	}
-	if prj.D.Requirements[1].ParentID != 0 {
-		t.Fatalf("parent index not set: %#v", prj.D.Requirements[1])
+	if prj.D.Requirements[1].ParentID != prj.D.Requirements[0].ID {
+		t.Fatalf("parent ID not set: %#v", prj.D.Requirements[1])
 	}
 
 	var dp2 struct {
 		D ProjectData `toml:"projectdata"`
 	}
-	path := filepath.Join(projectDir(prj.ProductID, prj.ID), projectTOML)
+	path := filepath.Join(NewFSStore(dir).ProjectPath(prj.ProductID, prj.ID), projectTOML)
 	if err := readTOML(path, &dp2); err != nil {
 		t.Fatalf("readTOML: %v", err)
 	}
@@ -120,3 +121,45 @@ func TestRequirementSuggestOthersCodeFence(t *testing.T) {
 	}
 
 }
+
+func TestSuggestOthersDropsDeletedRequirementsCleanly(t *testing.T) {
+	prj := newRelationsProject(t)
+	prj.database().LLM = gemini.ClientFunc{AskFunc: func(prompt string) (string, error) {
+		if strings.Contains(prompt, "Given the requirement") {
+			return `[{"name":"R5","description":"new"}]`, nil
+		}
+		return "no", nil
+	}}
+	if err := prj.AddRelation(1, 2, DependsOn, 0); err != nil {
+		t.Fatalf("AddRelation: %v", err)
+	}
+	if err := prj.DeleteRequirementByID(2); err != nil {
+		t.Fatalf("DeleteRequirementByID: %v", err)
+	}
+	if _, err := prj.D.Requirements[0].SuggestOthers(prj); err != nil {
+		t.Fatalf("SuggestOthers: %v", err)
+	}
+	if _, err := prj.RequirementByID(2); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("deleted requirement kept: %v", err)
+	}
+	if rel := prj.D.RequirementRelations; len(rel) != 0 {
+		t.Fatalf("relation to the dropped requirement kept: %#v", rel)
+	}
+	if r5 := prj.D.Requirements[len(prj.D.Requirements)-1]; r5.Name != "R5" || r5.ID != 5 || prj.D.NextRequirementID != 6 {
+		t.Fatalf("unexpected new requirement %#v, next ID %d", r5, prj.D.NextRequirementID)
+	}
+
+	// A removed requirement's ID is not handed out again.
+	if _, err := prj.database().MoveRequirement(prj.D.Requirements[len(prj.D.Requirements)-1].Key, 1, 2); err != nil {
+		t.Fatalf("MoveRequirement: %v", err)
+	}
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := prj.AddRequirement(Requirement{Name: "R6"}); err != nil {
+		t.Fatalf("AddRequirement: %v", err)
+	}
+	if id := prj.D.Requirements[len(prj.D.Requirements)-1].ID; id != 6 {
+		t.Fatalf("expected ID 6, got %d", id)
+	}
+}
@@ -0,0 +1,61 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrConflict is returned by SaveIfRevision when the stored project was
+// saved by someone else since the expected revision was read.
+var ErrConflict = errors.New("project was modified concurrently")
+
+// storedRevision returns the revision of the project as currently stored, or
+// 0 when the project has not been saved yet.
+func storedRevision(s Store, productID, projectID int) (int, error) {
+	cur := ProjectType{ID: projectID, ProductID: productID}
+	if err := s.LoadProject(&cur); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return cur.Revision, nil
+}
+
+// saveRevision writes the project as revision rev.
+func (prj *ProjectType) saveRevision(rev int) error {
+	prev := prj.Revision
+	prj.Revision = rev
+	if err := prj.store().SaveProject(prj); err != nil {
+		prj.Revision = prev
+		return fmt.Errorf("error writing project TOML: %w", err)
+	}
+	return nil
+}
+
+// SaveIfRevision saves the project only when the stored revision still
+// equals rev, normally the Revision observed when the project was loaded.
+// Otherwise it returns an error wrapping ErrConflict and writes nothing. The
+// project is checked like Save checks it.
+//
+// SaveIfRevision takes the project's write lock; do not call it while
+// holding Lock. Within Edit the project is already protected.
+func (prj *ProjectType) SaveIfRevision(rev int) error {
+	if err := prj.prepareSave(); err != nil {
+		return fmt.Errorf("error writing project TOML: %w", err)
+	}
+	unlock, err := prj.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cur, err := storedRevision(prj.store(), prj.ProductID, prj.ID)
+	if err != nil {
+		return fmt.Errorf("error writing project TOML: %w", err)
+	}
+	if cur != rev {
+		return fmt.Errorf("project %d/%d at revision %d, expected %d: %w", prj.ProductID, prj.ID, cur, rev, ErrConflict)
+	}
+	return prj.saveRevision(cur + 1)
+}
@@ -0,0 +1,87 @@
+package PMFS
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProjectRevisionAndSaveIfRevision(t *testing.T) {
+	db, err := Open(NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if _, err := db.Products[0].NewProject(ProjectData{Name: "prj"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	prj := &db.Products[0].Projects[0]
+	if prj.Revision != 1 {
+		t.Fatalf("new project revision = %d, want 1", prj.Revision)
+	}
+
+	// Two editors load the same revision.
+	a := &ProjectType{ID: prj.ID, ProductID: prj.ProductID, db: db}
+	b := &ProjectType{ID: prj.ID, ProductID: prj.ProductID, db: db}
+	if err := a.Load(); err != nil {
+		t.Fatalf("Load a: %v", err)
+	}
+	if err := b.Load(); err != nil {
+		t.Fatalf("Load b: %v", err)
+	}
+
+	a.D.Scope = "from a"
+	if err := a.SaveIfRevision(a.Revision); err != nil {
+		t.Fatalf("SaveIfRevision a: %v", err)
+	}
+	if a.Revision != 2 {
+		t.Fatalf("revision after save = %d, want 2", a.Revision)
+	}
+
+	b.D.Scope = "from b"
+	if err := b.SaveIfRevision(b.Revision); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if b.Revision != 1 {
+		t.Fatalf("failed save changed revision to %d", b.Revision)
+	}
+
+	check := &ProjectType{ID: prj.ID, ProductID: prj.ProductID, db: db}
+	if err := check.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if check.D.Scope != "from a" || check.Revision != 2 {
+		t.Fatalf("conflicting save was written: %q rev %d", check.D.Scope, check.Revision)
+	}
+
+	// Plain Save still wins but never moves the revision backwards.
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save b: %v", err)
+	}
+	if b.Revision != 3 {
+		t.Fatalf("revision after Save = %d, want 3", b.Revision)
+	}
+}
+
+func TestSaveIfRevisionChecksProject(t *testing.T) {
+	prj := newRelationsProject(t)
+	rev := prj.Revision
+	prj.D.Requirements[0].ParentID = 2
+	prj.D.Requirements[1].ParentID = 1
+	if err := prj.SaveIfRevision(rev); !errors.Is(err, ErrHierarchyCycle) {
+		t.Fatalf("expected ErrHierarchyCycle, got %v", err)
+	}
+	prj.D.Requirements[1].ParentID = 0
+	prj.D.Requirements[2].Status = "Nowhere"
+	if err := prj.SaveIfRevision(rev); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("expected ErrUnknownState, got %v", err)
+	}
+	prj.D.Requirements[2].Status = ""
+	if err := prj.SaveIfRevision(rev); err != nil {
+		t.Fatalf("SaveIfRevision: %v", err)
+	}
+	if r := prj.D.Requirements[0]; r.Level != 2 || r.Key == "" {
+		t.Fatalf("derived fields not set: %#v", r)
+	}
+}
@@ -0,0 +1,326 @@
+package PMFS
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
+)
+
+var (
+	// ErrRiskNotFound is returned when no risk has the given ID.
+	ErrRiskNotFound = errors.New("risk not found")
+	// ErrInvalidRisk is returned for risks with ratings outside 1 to 5.
+	ErrInvalidRisk = errors.New("invalid risk")
+)
+
+// RiskScale is the highest likelihood or impact rating.
+const RiskScale = 5
+
+// Risk is an entry of the project's risk register. Likelihood and Impact are
+// rated from 1 to RiskScale before mitigation; the residual ratings after
+// mitigation default to them when zero. RequirementIDs lists the
+// requirements that mitigate the risk.
+type Risk struct {
+	ID                 int    `json:"id" toml:"id"`
+	Title              string `json:"title" toml:"title"`
+	Description        string `json:"description" toml:"description"`
+	Likelihood         int    `json:"likelihood" toml:"likelihood"`
+	Impact             int    `json:"impact" toml:"impact"`
+	Mitigation         string `json:"mitigation" toml:"mitigation"`
+	Owner              string `json:"owner" toml:"owner"`
+	ResidualLikelihood int    `json:"residual_likelihood,omitempty" toml:"residual_likelihood"`
+	ResidualImpact     int    `json:"residual_impact,omitempty" toml:"residual_impact"`
+	RequirementIDs     []int  `json:"requirement_ids" toml:"requirement_ids"`
+	// IntelligenceID is the intelligence the risk was proposed from, or 0.
+	IntelligenceID int `json:"intelligence_id,omitempty" toml:"intelligence_id"`
+	// Proposed marks risks suggested by the LLM and not yet reviewed.
+	Proposed bool `json:"proposed" toml:"proposed"`
+}
+
+// Score returns Likelihood × Impact.
+func (r Risk) Score() int {
+	return r.Likelihood * r.Impact
+}
+
+// residual returns the residual likelihood and impact.
+func (r Risk) residual() (int, int) {
+	l, i := r.ResidualLikelihood, r.ResidualImpact
+	if l == 0 {
+		l = r.Likelihood
+	}
+	if i == 0 {
+		i = r.Impact
+	}
+	return l, i
+}
+
+// ResidualScore returns the score after mitigation.
+func (r Risk) ResidualScore() int {
+	l, i := r.residual()
+	return l * i
+}
+
+// RiskLevel names the band of a score: "low" up to 4, "medium" up to 9,
+// "high" up to 15 and "critical" above.
+func RiskLevel(score int) string {
+	switch {
+	case score <= 4:
+		return "low"
+	case score <= 9:
+		return "medium"
+	case score <= 15:
+		return "high"
+	}
+	return "critical"
+}
+
+// validate checks the ratings of the risk.
+func (r Risk) validate() error {
+	if strings.TrimSpace(r.Title) == "" {
+		return fmt.Errorf("risk %d: title is empty: %w", r.ID, ErrInvalidRisk)
+	}
+	for _, v := range []struct {
+		name     string
+		val, min int
+	}{
+		{"likelihood", r.Likelihood, 1},
+		{"impact", r.Impact, 1},
+		{"residual likelihood", r.ResidualLikelihood, 0},
+		{"residual impact", r.ResidualImpact, 0},
+	} {
+		if v.val < v.min || v.val > RiskScale {
+			return fmt.Errorf("risk %d: %s %d outside %d to %d: %w", r.ID, v.name, v.val, v.min, RiskScale, ErrInvalidRisk)
+		}
+	}
+	return nil
+}
+
+// nextRiskID returns the next risk ID and advances the project's counter,
+// raising it past existing IDs for projects edited by hand.
+func (prj *ProjectType) nextRiskID() int {
+	id := max(prj.D.NextRiskID, 1)
+	for _, r := range prj.D.Risks {
+		id = max(id, r.ID+1)
+	}
+	prj.D.NextRiskID = id + 1
+	return id
+}
+
+// RiskByID returns the risk with the given ID.
+func (prj *ProjectType) RiskByID(id int) (*Risk, error) {
+	for i := range prj.D.Risks {
+		if prj.D.Risks[i].ID == id {
+			return &prj.D.Risks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("risk %d: %w", id, ErrRiskNotFound)
+}
+
+// checkRiskLinks reports requirements linked to r that the project lacks.
+func (prj *ProjectType) checkRiskLinks(r Risk) error {
+	for _, id := range r.RequirementIDs {
+		if _, err := prj.RequirementByID(id); err != nil {
+			return fmt.Errorf("risk %d: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// AddRisk adds r to the register with a new ID and persists the project. It
+// returns the stored risk.
+func (prj *ProjectType) AddRisk(r Risk) (*Risk, error) {
+	r.ID = prj.nextRiskID()
+	err := r.validate()
+	if err == nil {
+		err = prj.checkRiskLinks(r)
+	}
+	if err != nil {
+		// The rejected risk's ID was never used; hand it out again.
+		prj.D.NextRiskID = r.ID
+		return nil, err
+	}
+	prj.D.Risks = append(prj.D.Risks, r)
+	if err := prj.Save(); err != nil {
+		return nil, err
+	}
+	return &prj.D.Risks[len(prj.D.Risks)-1], nil
+}
+
+// UpdateRisk replaces the risk with r's ID and persists the project.
+func (prj *ProjectType) UpdateRisk(r Risk) error {
+	ex, err := prj.RiskByID(r.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if err := prj.checkRiskLinks(r); err != nil {
+		return err
+	}
+	*ex = r
+	return prj.Save()
+}
+
+// RemoveRisk drops the risk from the register and persists the project.
+func (prj *ProjectType) RemoveRisk(id int) error {
+	if _, err := prj.RiskByID(id); err != nil {
+		return err
+	}
+	prj.D.Risks = slices.DeleteFunc(prj.D.Risks, func(r Risk) bool { return r.ID == id })
+	return prj.Save()
+}
+
+// LinkRisk records that the requirement mitigates the risk and persists the
+// project.
+func (prj *ProjectType) LinkRisk(riskID, requirementID int) error {
+	r, err := prj.RiskByID(riskID)
+	if err != nil {
+		return err
+	}
+	if _, err := prj.RequirementByID(requirementID); err != nil {
+		return err
+	}
+	if !slices.Contains(r.RequirementIDs, requirementID) {
+		r.RequirementIDs = append(r.RequirementIDs, requirementID)
+	}
+	return prj.Save()
+}
+
+// UnlinkRisk removes the link between the risk and the requirement and
+// persists the project.
+func (prj *ProjectType) UnlinkRisk(riskID, requirementID int) error {
+	r, err := prj.RiskByID(riskID)
+	if err != nil {
+		return err
+	}
+	r.RequirementIDs = slices.DeleteFunc(r.RequirementIDs, func(id int) bool { return id == requirementID })
+	return prj.Save()
+}
+
+// removeRiskLinksOf drops the requirement from every risk.
+func (prj *ProjectType) removeRiskLinksOf(requirementID int) {
+	for i := range prj.D.Risks {
+		prj.D.Risks[i].RequirementIDs = slices.DeleteFunc(prj.D.Risks[i].RequirementIDs, func(id int) bool { return id == requirementID })
+	}
+}
+
+// RisksFor returns the risks the requirement mitigates.
+func (prj *ProjectType) RisksFor(requirementID int) []Risk {
+	out := []Risk{}
+	for _, r := range prj.D.Risks {
+		if slices.Contains(r.RequirementIDs, requirementID) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// UnmitigatedRisks returns the risks no requirement mitigates.
+func (prj *ProjectType) UnmitigatedRisks() []Risk {
+	out := []Risk{}
+	for _, r := range prj.D.Risks {
+		if len(r.RequirementIDs) == 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// RiskMatrix places risk IDs by likelihood (rows) and impact (columns), both
+// from 1 to RiskScale at index 0 to RiskScale-1.
+type RiskMatrix [RiskScale][RiskScale][]int
+
+// ResidualRiskMatrix places every risk at its residual likelihood and impact.
+func (prj *ProjectType) ResidualRiskMatrix() RiskMatrix {
+	var m RiskMatrix
+	for _, r := range prj.D.Risks {
+		l, i := r.residual()
+		if l < 1 || l > RiskScale || i < 1 || i > RiskScale {
+			continue
+		}
+		m[l-1][i-1] = append(m[l-1][i-1], r.ID)
+	}
+	return m
+}
+
+// String renders the matrix as a text table of risk counts, highest
+// likelihood first.
+func (m RiskMatrix) String() string {
+	var b strings.Builder
+	b.WriteString("L\\I")
+	for i := 1; i <= RiskScale; i++ {
+		fmt.Fprintf(&b, " %3d", i)
+	}
+	b.WriteString("\n")
+	for l := RiskScale; l >= 1; l-- {
+		fmt.Fprintf(&b, "%3d", l)
+		for i := 1; i <= RiskScale; i++ {
+			fmt.Fprintf(&b, " %3d", len(m[l-1][i-1]))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ProposeRisks asks the project's LLM client for risks based on the
+// summaries of the project's intelligence and adds them to the register as
+// Proposed, traced to the intelligence they came from. It returns the added
+// risks and persists the project.
+func (prj *ProjectType) ProposeRisks() ([]Risk, error) {
+	var summaries []string
+	for _, in := range prj.D.Intelligence {
+		if strings.TrimSpace(in.Description) != "" {
+			summaries = append(summaries, fmt.Sprintf("%d: %s", in.ID, in.Description))
+		}
+	}
+	if len(summaries) == 0 {
+		return nil, nil
+	}
+	proposed, err := risksFromSummaries(prj.llm(), summaries)
+	if err != nil {
+		return nil, err
+	}
+	var out []Risk
+	for _, r := range proposed {
+		if _, err := prj.intelligenceByID(r.IntelligenceID); err != nil {
+			r.IntelligenceID = 0
+		}
+		r.ID = prj.nextRiskID()
+		r.Likelihood = min(max(r.Likelihood, 1), RiskScale)
+		r.Impact = min(max(r.Impact, 1), RiskScale)
+		r.ResidualLikelihood, r.ResidualImpact = 0, 0
+		r.RequirementIDs = nil
+		r.Proposed = true
+		if r.validate() != nil {
+			prj.D.NextRiskID = r.ID
+			continue
+		}
+		prj.D.Risks = append(prj.D.Risks, r)
+		out = append(out, r)
+	}
+	return out, prj.Save()
+}
+
+// risksFromSummaries asks the LLM for risks in the given intelligence
+// summaries, each prefixed with its intelligence ID.
+func risksFromSummaries(c llm.Client, summaries []string) ([]Risk, error) {
+	prompt := fmt.Sprintf("Given these intelligence summaries, each prefixed with its ID:\n%s\nlist the project risks they reveal (JSON array with `title`, `description`, `likelihood` and `impact` from 1 to %d, `mitigation` and the `intelligence_id` of the summary).", strings.Join(summaries, "\n"), RiskScale)
+	resp, err := c.Ask(prompt)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := parseLLMJSON(resp)
+	if err != nil {
+		return nil, err
+	}
+	var risks []Risk
+	if err := json.Unmarshal(raw, &risks); err != nil {
+		return nil, err
+	}
+	return risks, nil
+}
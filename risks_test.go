@@ -0,0 +1,99 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestRiskRegister(t *testing.T) {
+	prj := newRelationsProject(t)
+	if _, err := prj.AddRisk(Risk{Title: "Belt jams", Likelihood: 6, Impact: 2}); !errors.Is(err, ErrInvalidRisk) {
+		t.Fatalf("expected ErrInvalidRisk, got %v", err)
+	}
+	if _, err := prj.AddRisk(Risk{Title: "Belt jams", Likelihood: 2, Impact: 2, RequirementIDs: []int{9}}); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected ErrRequirementNotFound, got %v", err)
+	}
+	jam, err := prj.AddRisk(Risk{Title: "Belt jams", Likelihood: 4, Impact: 4, ResidualLikelihood: 2, Owner: "ops", RequirementIDs: []int{1}})
+	if err != nil {
+		t.Fatalf("AddRisk: %v", err)
+	}
+	if jam.ID != 1 || jam.Score() != 16 || jam.ResidualScore() != 8 || RiskLevel(jam.Score()) != "critical" || RiskLevel(jam.ResidualScore()) != "medium" {
+		t.Fatalf("unexpected scores for %#v: %d, %d", jam, jam.Score(), jam.ResidualScore())
+	}
+	if _, err := prj.AddRisk(Risk{Title: "Power loss", Likelihood: 1, Impact: 5}); err != nil {
+		t.Fatalf("AddRisk: %v", err)
+	}
+	for _, req := range []int{1, 2} {
+		if err := prj.LinkRisk(2, req); err != nil {
+			t.Fatalf("LinkRisk: %v", err)
+		}
+	}
+	if got := prj.RisksFor(1); len(got) != 2 {
+		t.Fatalf("RisksFor(1) = %#v", got)
+	}
+	if err := prj.UnlinkRisk(1, 1); err != nil {
+		t.Fatalf("UnlinkRisk: %v", err)
+	}
+	if got := prj.UnmitigatedRisks(); len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("UnmitigatedRisks = %#v", got)
+	}
+
+	m := prj.ResidualRiskMatrix()
+	if len(m[1][3]) != 1 || m[1][3][0] != 1 || len(m[0][4]) != 1 || m[0][4][0] != 2 {
+		t.Fatalf("unexpected matrix: %v", m)
+	}
+	if lines := strings.Split(m.String(), "\n"); len(lines) != RiskScale+2 || !strings.HasPrefix(lines[RiskScale], "  1   0   0   0   0   1") {
+		t.Fatalf("unexpected rendering:\n%s", m)
+	}
+
+	// The register round-trips through Excel, following requirement IDs.
+	path := filepath.Join(t.TempDir(), "risks.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	pd, err := ImportProjectExcel(path)
+	if err != nil {
+		t.Fatalf("ImportProjectExcel: %v", err)
+	}
+	if len(pd.Risks) != 2 || pd.Risks[0].Owner != "ops" || pd.Risks[0].ResidualLikelihood != 2 || len(pd.Risks[1].RequirementIDs) != 2 {
+		t.Fatalf("risks not exported: %#v", pd.Risks)
+	}
+	if err := prj.RemoveRisk(2); err != nil {
+		t.Fatalf("RemoveRisk: %v", err)
+	}
+	if err := prj.ImportExcel(path, false); err != nil {
+		t.Fatalf("ImportExcel: %v", err)
+	}
+	// The removed risk comes back under a new ID; its old one is not reused.
+	if _, err := prj.RiskByID(2); !errors.Is(err, ErrRiskNotFound) {
+		t.Fatalf("removed risk ID reused: %v", err)
+	}
+	if r, err := prj.RiskByID(3); err != nil || r.Title != "Power loss" || len(r.RequirementIDs) != 2 {
+		t.Fatalf("risk not imported: %#v, %v", r, err)
+	}
+}
+
+func TestProposeRisks(t *testing.T) {
+	db, prj, _ := newKeysDB(t)
+	db.LLM = gemini.ClientFunc{AskFunc: func(prompt string) (string, error) {
+		if !strings.Contains(prompt, "7: Operators reach into the running belt.") {
+			return "", errors.New("summary missing from prompt")
+		}
+		return `[{"title":"Crush injury","likelihood":3,"impact":9,"mitigation":"Guards","intelligence_id":7},{"title":""}]`, nil
+	}}
+	prj.D.Intelligence = []Intelligence{{ID: 7, Description: "Operators reach into the running belt."}, {ID: 8}}
+	risks, err := prj.ProposeRisks()
+	if err != nil {
+		t.Fatalf("ProposeRisks: %v", err)
+	}
+	if len(risks) != 1 || !risks[0].Proposed || risks[0].IntelligenceID != 7 || risks[0].Impact != RiskScale {
+		t.Fatalf("unexpected proposals: %#v", risks)
+	}
+	if len(prj.D.Risks) != 1 {
+		t.Fatalf("proposal not stored: %#v", prj.D.Risks)
+	}
+}
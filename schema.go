@@ -0,0 +1,222 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// SchemaVersion is the version of the index.toml and project.toml formats
+// written by this package. Documents without a schema_version key are
+// version 0.
+const SchemaVersion = 11
+
+// DocKind identifies the kind of document a migration applies to.
+type DocKind string
+
+const (
+	IndexDoc   DocKind = "index"
+	ProjectDoc DocKind = "project"
+)
+
+// ErrSchemaTooNew is returned when a document was written by a newer release
+// than this one.
+var ErrSchemaTooNew = errors.New("document schema is newer than supported")
+
+// ErrNoBackup is returned by Migrate when the store cannot take a backup.
+var ErrNoBackup = errors.New("store cannot take backups")
+
+// Migration upgrades one kind of document from version From to From+1. Apply
+// works on the raw TOML tree and returns a human readable line per change.
+type Migration struct {
+	Kind        DocKind
+	From        int
+	Description string
+	Apply       func(doc map[string]any) ([]string, error)
+}
+
+// MigrationStep records a migration applied, or planned, for one document.
+type MigrationStep struct {
+	Document    string   `json:"document"`
+	From        int      `json:"from"`
+	To          int      `json:"to"`
+	Description string   `json:"description"`
+	Changes     []string `json:"changes,omitempty"`
+}
+
+// MigrationReport describes the work done, or planned, by a migration run.
+type MigrationReport struct {
+	Steps []MigrationStep `json:"steps"`
+	// Backup is where the store was backed up before writing. It is empty
+	// for dry runs and when nothing needed migrating.
+	Backup string `json:"backup,omitempty"`
+}
+
+// Empty reports whether no document needs migrating.
+func (r *MigrationReport) Empty() bool { return len(r.Steps) == 0 }
+
+// String renders the report one step per line followed by its changes.
+func (r *MigrationReport) String() string {
+	if r.Empty() {
+		return "schema up to date"
+	}
+	var sb strings.Builder
+	for _, st := range r.Steps {
+		fmt.Fprintf(&sb, "%s: v%d -> v%d: %s\n", st.Document, st.From, st.To, st.Description)
+		for _, c := range st.Changes {
+			fmt.Fprintf(&sb, "  - %s\n", c)
+		}
+	}
+	if r.Backup != "" {
+		fmt.Fprintf(&sb, "backup: %s\n", r.Backup)
+	}
+	return sb.String()
+}
+
+// Backuper is implemented by stores that can snapshot their TOML documents
+// before a migration rewrites them. Backup returns where the copy was kept.
+type Backuper interface {
+	Backup(label string) (string, error)
+}
+
+// migrations holds the registered migrations per kind, indexed by From.
+var migrations = map[DocKind][]Migration{}
+
+// registerMigration adds m to the registry. Migrations must be registered in
+// version order without gaps.
+func registerMigration(m Migration) {
+	if len(migrations[m.Kind]) != m.From {
+		panic(fmt.Sprintf("PMFS: %s migration from v%d registered out of order", m.Kind, m.From))
+	}
+	migrations[m.Kind] = append(migrations[m.Kind], m)
+}
+
+// docVersion returns the schema_version of a raw document.
+func docVersion(doc map[string]any) (int, error) {
+	v, ok := doc["schema_version"]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("schema_version has type %T", v)
+	}
+	return int(n), nil
+}
+
+// migrateDoc upgrades doc in place to SchemaVersion and returns the steps
+// applied.
+func migrateDoc(kind DocKind, key string, doc map[string]any) ([]MigrationStep, error) {
+	from, err := docVersion(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	if from > SchemaVersion {
+		return nil, fmt.Errorf("%s is at v%d, this release reads up to v%d: %w", key, from, SchemaVersion, ErrSchemaTooNew)
+	}
+	if len(migrations[kind]) < SchemaVersion {
+		return nil, fmt.Errorf("no %s migration to v%d registered", kind, SchemaVersion)
+	}
+	var steps []MigrationStep
+	for v := from; v < SchemaVersion; v++ {
+		m := migrations[kind][v]
+		changes, err := m.Apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: migrate v%d -> v%d: %w", key, v, v+1, err)
+		}
+		doc["schema_version"] = int64(v + 1)
+		steps = append(steps, MigrationStep{Document: key, From: v, To: v + 1, Description: m.Description, Changes: changes})
+	}
+	return steps, nil
+}
+
+// decodeMigrated decodes b into v. Documents at an older schema version are
+// migrated in memory first; the applied steps are returned so callers can
+// persist the upgrade.
+func decodeMigrated(kind DocKind, key string, b []byte, v any) ([]MigrationStep, error) {
+	var doc map[string]any
+	if err := decodeTOMLStrict(b, &doc); err != nil {
+		return nil, err
+	}
+	if ver, err := docVersion(doc); err == nil && ver == SchemaVersion {
+		return nil, toml.Unmarshal(b, v)
+	}
+	steps, err := migrateDoc(kind, key, doc)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := toml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: encode migrated document: %w", key, err)
+	}
+	return steps, toml.Unmarshal(mb, v)
+}
+
+// PlanMigrations reports what Migrate would change in s without writing
+// anything.
+func PlanMigrations(s Store) (*MigrationReport, error) {
+	rep, _, _, err := planMigrations(s)
+	return rep, err
+}
+
+// planMigrations loads the index and every listed project, returning the
+// report together with the migrated documents.
+func planMigrations(s Store) (*MigrationReport, *Database, []*ProjectType, error) {
+	rep := &MigrationReport{}
+	db := newDatabase(s)
+	if err := s.LoadIndex(db); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return rep, nil, nil, nil
+		}
+		return nil, nil, nil, fmt.Errorf("read index.toml: %w", err)
+	}
+	rep.Steps = append(rep.Steps, db.migrated...)
+	var stale []*ProjectType
+	for _, prd := range db.Products {
+		for _, p := range prd.Projects {
+			prj := &ProjectType{ID: p.ID, ProductID: prd.ID, db: db}
+			if err := s.LoadProject(prj); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return nil, nil, nil, fmt.Errorf("read project %s: %w", projectFileKey(prd.ID, p.ID), err)
+			}
+			if len(prj.migrated) > 0 {
+				rep.Steps = append(rep.Steps, prj.migrated...)
+				stale = append(stale, prj)
+			}
+		}
+	}
+	return rep, db, stale, nil
+}
+
+// Migrate upgrades every document in s to SchemaVersion. When anything needs
+// migrating the store is backed up first; stores that are not Backupers are
+// refused with ErrNoBackup. Project revisions are left unchanged.
+func Migrate(s Store) (*MigrationReport, error) {
+	rep, db, stale, err := planMigrations(s)
+	if err != nil || rep.Empty() {
+		return rep, err
+	}
+	b, ok := s.(Backuper)
+	if !ok {
+		return nil, ErrNoBackup
+	}
+	label := fmt.Sprintf("schema-v%d-%s", SchemaVersion, time.Now().UTC().Format("20060102T150405Z"))
+	if rep.Backup, err = b.Backup(label); err != nil {
+		return nil, fmt.Errorf("backup before migration: %w", err)
+	}
+	for _, prj := range stale {
+		if err := s.SaveProject(prj); err != nil {
+			return nil, fmt.Errorf("write migrated %s: %w", projectFileKey(prj.ProductID, prj.ID), err)
+		}
+	}
+	if err := s.SaveIndex(db); err != nil {
+		return nil, fmt.Errorf("write migrated index.toml: %w", err)
+	}
+	return rep, nil
+}
@@ -0,0 +1,131 @@
+package PMFS
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const legacyIndex = `[[products]]
+id = 1
+name = "prod"
+
+[[products.projects]]
+id = 1
+name = "prj"
+`
+
+const legacyProject = `id = 1
+productid = 1
+name = "prj"
+
+[projectdata]
+name = "prj"
+
+[[projectdata.requirements]]
+id = 1
+name = "R1"
+
+[[projectdata.requirements.requirementdesignaspects]]
+name = "Belt width"
+description = "How wide?"
+`
+
+// writeLegacyDB lays out a database written before schema versioning.
+func writeLegacyDB(t *testing.T, dir string) (indexPath, projectPath string) {
+	t.Helper()
+	s := NewFSStore(dir)
+	indexPath = filepath.Join(dir, filepath.FromSlash(indexKey()))
+	projectPath = filepath.Join(s.ProjectPath(1, 1), projectTOML)
+	for p, body := range map[string]string{indexPath: legacyIndex, projectPath: legacyProject} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	return indexPath, projectPath
+}
+
+func TestPlanMigrationsIsDryRun(t *testing.T) {
+	dir := t.TempDir()
+	indexPath, projectPath := writeLegacyDB(t, dir)
+
+	rep, err := PlanMigrations(NewFSStore(dir))
+	if err != nil {
+		t.Fatalf("PlanMigrations: %v", err)
+	}
+	// Every index step comes first, then every project step.
+	if len(rep.Steps) != 2*SchemaVersion || rep.Backup != "" {
+		t.Fatalf("unexpected plan: %#v", rep)
+	}
+	prjStep := rep.Steps[SchemaVersion]
+	if prjStep.Document != projectFileKey(1, 1) || prjStep.From != 0 || prjStep.To != 1 {
+		t.Fatalf("unexpected project step: %#v", prjStep)
+	}
+	if len(prjStep.Changes) != 1 || !strings.Contains(prjStep.Changes[0], "requirementdesignaspects") {
+		t.Fatalf("rename not reported: %#v", prjStep.Changes)
+	}
+
+	for p, want := range map[string]string{indexPath: legacyIndex, projectPath: legacyProject} {
+		got, err := os.ReadFile(p)
+		if err != nil || string(got) != want {
+			t.Fatalf("dry run modified %s: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backups")); !os.IsNotExist(err) {
+		t.Fatalf("dry run took a backup: %v", err)
+	}
+}
+
+func TestLoadSetupMigratesLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	_, projectPath := writeLegacyDB(t, dir)
+
+	db, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	prj, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	rc := prj.D.Requirements[0].RecommendedChanges
+	if len(rc) != 1 || rc[0].Name != "Belt width" {
+		t.Fatalf("recommended changes lost: %#v", rc)
+	}
+
+	b, err := os.ReadFile(projectPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Contains(b, []byte(fmt.Sprintf("schema_version = %d", SchemaVersion))) || bytes.Contains(b, []byte("requirementdesignaspects")) {
+		t.Fatalf("project.toml not migrated:\n%s", b)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "backups", "*", filepath.FromSlash(projectFileKey(1, 1))))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected one backup of project.toml, got %v (%v)", backups, err)
+	}
+	if old, _ := os.ReadFile(backups[0]); string(old) != legacyProject {
+		t.Fatalf("backup does not hold the legacy document:\n%s", old)
+	}
+
+	rep, err := PlanMigrations(NewFSStore(dir))
+	if err != nil || !rep.Empty() {
+		t.Fatalf("database still needs migrating: %v %v", rep, err)
+	}
+}
+
+func TestLoadRejectsNewerSchema(t *testing.T) {
+	s := NewMemoryStore()
+	s.put(indexKey(), []byte("schema_version = 99\nproducts = []\n"))
+	if _, err := Open(s); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package PMFS
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
+)
+
+var (
+	// ErrUnknownModel is returned for scoring models that are not registered.
+	ErrUnknownModel = errors.New("unknown scoring model")
+	// ErrUnknownFactor is returned for factors no scoring model uses.
+	ErrUnknownFactor = errors.New("unknown scoring factor")
+	// ErrInvalidFactor is returned for factor values outside their range.
+	ErrInvalidFactor = errors.New("invalid scoring factor")
+	// ErrMissingFactors is returned when a requirement lacks factors the
+	// scoring model needs.
+	ErrMissingFactors = errors.New("missing scoring factors")
+)
+
+// ScoringFactor is an input of a scoring model. Values range from Min to
+// Max; a Max of 0 leaves the range open.
+type ScoringFactor struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max,omitempty"`
+}
+
+// check reports whether v is a valid value of the factor.
+func (f ScoringFactor) check(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < f.Min || (f.Max != 0 && v > f.Max) {
+		if f.Max == 0 {
+			return fmt.Errorf("%s %g below %g: %w", f.Name, v, f.Min, ErrInvalidFactor)
+		}
+		return fmt.Errorf("%s %g outside %g to %g: %w", f.Name, v, f.Min, f.Max, ErrInvalidFactor)
+	}
+	return nil
+}
+
+// ScoringModel ranks requirements by a score computed from factors kept in
+// Requirement.Factors; higher scores rank first. Models sharing a factor
+// name should define it alike.
+type ScoringModel struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Factors     []ScoringFactor `json:"factors"`
+	// Score computes the score from valid values of every factor.
+	Score func(f map[string]float64) float64 `json:"-"`
+}
+
+// Missing returns the names of the model's factors f lacks.
+func (m ScoringModel) Missing(f map[string]float64) []string {
+	var out []string
+	for _, fac := range m.Factors {
+		if _, ok := f[fac.Name]; !ok {
+			out = append(out, fac.Name)
+		}
+	}
+	return out
+}
+
+// Evaluate scores f, failing with ErrMissingFactors when factors are missing.
+func (m ScoringModel) Evaluate(f map[string]float64) (float64, error) {
+	if missing := m.Missing(f); len(missing) > 0 {
+		return 0, fmt.Errorf("%s: %s: %w", m.Name, strings.Join(missing, ", "), ErrMissingFactors)
+	}
+	return m.Score(f), nil
+}
+
+// factorEffort is shared by the built-in models dividing by effort.
+var factorEffort = ScoringFactor{Name: "effort", Description: "job size or person-months of work", Min: 0.5}
+
+var scoringModels = map[string]ScoringModel{
+	"moscow": {
+		Name:        "moscow",
+		Description: "MoSCoW category: must before should before could before won't.",
+		Factors: []ScoringFactor{
+			{Name: "moscow", Description: "3 must have, 2 should have, 1 could have, 0 won't have", Min: 0, Max: 3},
+		},
+		Score: func(f map[string]float64) float64 { return math.Round(f["moscow"]) },
+	},
+	"wsjf": {
+		Name:        "wsjf",
+		Description: "Weighted shortest job first: cost of delay divided by effort.",
+		Factors: []ScoringFactor{
+			{Name: "value", Description: "business or user value"},
+			{Name: "time_criticality", Description: "how fast the value decays"},
+			{Name: "risk_reduction", Description: "risk reduced or opportunity enabled"},
+			factorEffort,
+		},
+		Score: func(f map[string]float64) float64 {
+			return (f["value"] + f["time_criticality"] + f["risk_reduction"]) / f["effort"]
+		},
+	},
+	"rice": {
+		Name:        "rice",
+		Description: "Reach × impact × confidence divided by effort.",
+		Factors: []ScoringFactor{
+			{Name: "reach", Description: "users or events affected per period"},
+			{Name: "impact", Description: "impact per user: 0.25 minimal to 3 massive", Max: 3},
+			{Name: "confidence", Description: "confidence in the estimates from 0 to 1", Max: 1},
+			factorEffort,
+		},
+		Score: func(f map[string]float64) float64 {
+			return f["reach"] * f["impact"] * f["confidence"] / f["effort"]
+		},
+	},
+}
+
+// RegisterScoringModel makes a scoring model available under its lowercase
+// name, replacing any model registered before. Register models during
+// initialization.
+func RegisterScoringModel(m ScoringModel) {
+	m.Name = strings.ToLower(m.Name)
+	scoringModels[m.Name] = m
+}
+
+// ScoringModels returns the registered scoring models ordered by name.
+func ScoringModels() []ScoringModel {
+	out := make([]ScoringModel, 0, len(scoringModels))
+	for _, m := range scoringModels {
+		out = append(out, m)
+	}
+	slices.SortFunc(out, func(a, b ScoringModel) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+// LookupScoringModel returns the scoring model registered under name.
+func LookupScoringModel(name string) (ScoringModel, error) {
+	m, ok := scoringModels[strings.ToLower(name)]
+	if !ok {
+		return ScoringModel{}, fmt.Errorf("%q: %w", name, ErrUnknownModel)
+	}
+	return m, nil
+}
+
+// scoringFactor returns the named factor as defined by the first model, in
+// name order, that uses it.
+func scoringFactor(name string) (ScoringFactor, bool) {
+	for _, m := range ScoringModels() {
+		for _, f := range m.Factors {
+			if f.Name == name {
+				return f, true
+			}
+		}
+	}
+	return ScoringFactor{}, false
+}
+
+// validateFactors checks that every factor is used by a scoring model and
+// within its range.
+func validateFactors(factors map[string]float64) error {
+	var errs []error
+	for _, name := range sortedKeys(factors) {
+		def, ok := scoringFactor(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%q: %w", name, ErrUnknownFactor))
+			continue
+		}
+		if err := def.check(factors[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetFactors replaces the scoring factors of the requirement and their
+// justification, records the change and persists the project.
+func (prj *ProjectType) SetFactors(id int, factors map[string]float64, justification string) error {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	if err := validateFactors(factors); err != nil {
+		return fmt.Errorf("requirement %d: %w", id, err)
+	}
+	before := r.snapshot()
+	r.Factors = nil
+	if len(factors) > 0 {
+		r.Factors = make(map[string]float64, len(factors))
+		for k, v := range factors {
+			r.Factors[k] = v
+		}
+	}
+	r.FactorJustification = justification
+	r.recordSince(before, prj.user(), "scoring factors updated")
+	return prj.Save()
+}
+
+// ScoreRequirement scores the requirement with the named model.
+func (prj *ProjectType) ScoreRequirement(id int, model string) (float64, error) {
+	m, err := LookupScoringModel(model)
+	if err != nil {
+		return 0, err
+	}
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return 0, err
+	}
+	score, err := m.Evaluate(r.Factors)
+	if err != nil {
+		return 0, fmt.Errorf("requirement %d: %w", id, err)
+	}
+	return score, nil
+}
+
+// RankedRequirement is a requirement's place in a ranked backlog. Rank is 0
+// and Missing lists the factors to fill in for requirements that cannot be
+// scored.
+type RankedRequirement struct {
+	Rank          int      `json:"rank"`
+	RequirementID int      `json:"requirement_id"`
+	Name          string   `json:"name"`
+	Priority      int      `json:"priority"`
+	Score         float64  `json:"score"`
+	Missing       []string `json:"missing,omitempty"`
+}
+
+// RankedBacklog scores the requirements that are not deleted with the named
+// model and returns them by descending score, ties broken by Priority and
+// ID. Requirements missing factors follow, unranked, by Priority and ID.
+func (prj *ProjectType) RankedBacklog(model string) ([]RankedRequirement, error) {
+	m, err := LookupScoringModel(model)
+	if err != nil {
+		return nil, err
+	}
+	var scored, unscored []RankedRequirement
+	for _, r := range prj.D.Requirements {
+		if r.Condition.Deleted {
+			continue
+		}
+		rr := RankedRequirement{RequirementID: r.ID, Name: r.Name, Priority: r.Priority}
+		if rr.Missing = m.Missing(r.Factors); len(rr.Missing) > 0 {
+			unscored = append(unscored, rr)
+			continue
+		}
+		rr.Score = m.Score(r.Factors)
+		scored = append(scored, rr)
+	}
+	byPriority := func(a, b RankedRequirement) int {
+		if a.Priority != b.Priority {
+			return a.Priority - b.Priority
+		}
+		return a.RequirementID - b.RequirementID
+	}
+	slices.SortFunc(scored, func(a, b RankedRequirement) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return byPriority(a, b)
+	})
+	slices.SortFunc(unscored, byPriority)
+	for i := range scored {
+		scored[i].Rank = i + 1
+	}
+	return append(scored, unscored...), nil
+}
+
+// FactorProposal is a set of factor values suggested by the LLM.
+type FactorProposal struct {
+	Factors       map[string]float64 `json:"factors"`
+	Justification string             `json:"justification"`
+}
+
+// ProposeFactors asks the project's LLM client for the named model's factors
+// of the requirement. The proposed values, clamped to their ranges, replace
+// the model's factors on the requirement together with the justification;
+// other factors are kept. It returns the applied proposal and persists the
+// project.
+func (prj *ProjectType) ProposeFactors(id int, model string) (FactorProposal, error) {
+	m, err := LookupScoringModel(model)
+	if err != nil {
+		return FactorProposal{}, err
+	}
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return FactorProposal{}, err
+	}
+	p, err := proposeFactors(prj.llm(), m, r.Description)
+	if err != nil {
+		return FactorProposal{}, err
+	}
+	before := r.snapshot()
+	if r.Factors == nil {
+		r.Factors = map[string]float64{}
+	}
+	for k, v := range p.Factors {
+		r.Factors[k] = v
+	}
+	r.FactorJustification = p.Justification
+	r.recordSince(before, ActorAI, "proposed scoring factors")
+	return p, prj.Save()
+}
+
+// proposeFactors asks the LLM for m's factors of the requirement description,
+// one estimate with its reason per factor. Factors the model does not use
+// are dropped and the reasons are joined into the justification.
+func proposeFactors(c llm.Client, m ScoringModel, description string) (FactorProposal, error) {
+	lines := make([]string, len(m.Factors))
+	for i, f := range m.Factors {
+		rng := fmt.Sprintf("at least %g", f.Min)
+		if f.Max != 0 {
+			rng = fmt.Sprintf("%g to %g", f.Min, f.Max)
+		}
+		lines[i] = fmt.Sprintf("- %s: %s (%s)", f.Name, f.Description, rng)
+	}
+	prompt := fmt.Sprintf("Estimate the %s prioritization factors of the requirement %q:\n%s\nAnswer as a JSON array with `factor`, `value` and a short `reason` per factor.", m.Name, description, strings.Join(lines, "\n"))
+	resp, err := c.Ask(prompt)
+	if err != nil {
+		return FactorProposal{}, err
+	}
+	raw, err := parseLLMJSON(resp)
+	if err != nil {
+		return FactorProposal{}, err
+	}
+	var estimates []struct {
+		Factor string  `json:"factor"`
+		Value  float64 `json:"value"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.Unmarshal(raw, &estimates); err != nil {
+		return FactorProposal{}, err
+	}
+	out := FactorProposal{Factors: map[string]float64{}}
+	var reasons []string
+	for _, f := range m.Factors {
+		for _, e := range estimates {
+			if e.Factor != f.Name || math.IsNaN(e.Value) || math.IsInf(e.Value, 0) {
+				continue
+			}
+			v := max(e.Value, f.Min)
+			if f.Max != 0 {
+				v = min(v, f.Max)
+			}
+			out.Factors[f.Name] = v
+			if r := strings.TrimSpace(e.Reason); r != "" {
+				reasons = append(reasons, f.Name+": "+r)
+			}
+			break
+		}
+	}
+	out.Justification = strings.Join(reasons, "\n")
+	return out, nil
+}
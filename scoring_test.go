@@ -0,0 +1,97 @@
+package PMFS
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestRankedBacklog(t *testing.T) {
+	prj := newRelationsProject(t)
+	if err := prj.SetFactors(1, map[string]float64{"value": 8, "time_criticality": 5, "risk_reduction": 2, "effort": 5}, "Blocks the pilot."); err != nil {
+		t.Fatalf("SetFactors: %v", err)
+	}
+	if err := prj.SetFactors(2, map[string]float64{"value": 3, "time_criticality": 2, "risk_reduction": 1, "effort": 1}, ""); err != nil {
+		t.Fatalf("SetFactors: %v", err)
+	}
+	if err := prj.SetFactors(3, map[string]float64{"value": 1}, ""); err != nil {
+		t.Fatalf("SetFactors: %v", err)
+	}
+	if err := prj.SetFactors(4, map[string]float64{"effort": 0}, ""); !errors.Is(err, ErrInvalidFactor) {
+		t.Fatalf("expected ErrInvalidFactor, got %v", err)
+	}
+	if err := prj.SetFactors(4, map[string]float64{"fun": 1}, ""); !errors.Is(err, ErrUnknownFactor) {
+		t.Fatalf("expected ErrUnknownFactor, got %v", err)
+	}
+	if r, _ := prj.RequirementByID(1); lastChange(t, r).Comment != "scoring factors updated" {
+		t.Fatalf("factors not recorded: %#v", r.History)
+	}
+
+	ranked, err := prj.RankedBacklog("WSJF")
+	if err != nil {
+		t.Fatalf("RankedBacklog: %v", err)
+	}
+	var order []int
+	for _, rr := range ranked {
+		order = append(order, rr.RequirementID)
+	}
+	if len(ranked) != 4 || ranked[0].RequirementID != 2 || ranked[0].Score != 6 || ranked[1].Score != 3 || ranked[2].Rank != 0 {
+		t.Fatalf("unexpected ranking %v: %#v", order, ranked)
+	}
+	if strings.Join(ranked[2].Missing, ",") != "time_criticality,risk_reduction,effort" {
+		t.Fatalf("Missing = %v", ranked[2].Missing)
+	}
+	if _, err := prj.ScoreRequirement(3, "wsjf"); !errors.Is(err, ErrMissingFactors) {
+		t.Fatalf("expected ErrMissingFactors, got %v", err)
+	}
+	if _, err := prj.RankedBacklog("kano"); !errors.Is(err, ErrUnknownModel) {
+		t.Fatalf("expected ErrUnknownModel, got %v", err)
+	}
+
+	// Factors round-trip through Excel; scores are informational.
+	path := filepath.Join(t.TempDir(), "scores.xlsx")
+	if err := prj.ExportExcel(path); err != nil {
+		t.Fatalf("ExportExcel: %v", err)
+	}
+	pd, err := ImportProjectExcel(path)
+	if err != nil {
+		t.Fatalf("ImportProjectExcel: %v", err)
+	}
+	if r := pd.Requirements[0]; r.Factors["effort"] != 5 || r.FactorJustification != "Blocks the pilot." || len(pd.Requirements[2].Factors) != 1 {
+		t.Fatalf("factors not exported: %#v", pd.Requirements)
+	}
+}
+
+func TestProposeFactors(t *testing.T) {
+	db, prj, _ := newKeysDB(t)
+	db.LLM = gemini.ClientFunc{AskFunc: func(prompt string) (string, error) {
+		if !strings.Contains(prompt, "- confidence: confidence in the estimates from 0 to 1 (0 to 1)") {
+			return "", errors.New("factors missing from prompt")
+		}
+		return `[{"factor":"reach","value":500,"reason":"All operators."},{"factor":"impact","value":2},{"factor":"confidence","value":1.5,"reason":"Measured."},{"factor":"effort","value":2},{"factor":"mood","value":3}]`, nil
+	}}
+	if err := prj.AddRequirement(Requirement{Name: "R1", Description: "Show belt speed on the HMI."}); err != nil {
+		t.Fatalf("AddRequirement: %v", err)
+	}
+	id := prj.D.Requirements[0].ID
+	if err := prj.SetFactors(id, map[string]float64{"value": 4}, ""); err != nil {
+		t.Fatalf("SetFactors: %v", err)
+	}
+	p, err := prj.ProposeFactors(id, "rice")
+	if err != nil {
+		t.Fatalf("ProposeFactors: %v", err)
+	}
+	if len(p.Factors) != 4 || p.Factors["confidence"] != 1 || p.Justification != "reach: All operators.\nconfidence: Measured." {
+		t.Fatalf("unexpected proposal: %#v", p)
+	}
+	r, _ := prj.RequirementByID(id)
+	if r.Factors["value"] != 4 || lastChange(t, r).User != ActorAI {
+		t.Fatalf("proposal not applied: %#v", r)
+	}
+	if score, err := prj.ScoreRequirement(id, "rice"); err != nil || score != 500 {
+		t.Fatalf("ScoreRequirement = %v, %v", score, err)
+	}
+}
@@ -0,0 +1,318 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Store persists the database index, project documents and attachment files.
+// All PMFS persistence goes through a Store so the on-disk layout can be
+// swapped without touching the domain model.
+//
+// Missing documents are reported with an error wrapping fs.ErrNotExist.
+// Attachment paths are relative to the project, e.g. "attachments/3/spec.pdf".
+type Store interface {
+	// LoadIndex decodes the product index into db.
+	LoadIndex(db *Database) error
+	// SaveIndex persists the product index of db.
+	SaveIndex(db *Database) error
+	// InitProduct prepares storage for a newly created product.
+	InitProduct(productID int) error
+	// DeleteProduct removes everything stored for the product, including
+	// its projects. Deleting a product that has no data is not an error.
+	DeleteProduct(productID int) error
+
+	// LoadProject decodes the project identified by prj.ProductID and
+	// prj.ID into prj.
+	LoadProject(prj *ProjectType) error
+	// SaveProject persists prj including its ProjectData.
+	SaveProject(prj *ProjectType) error
+	// DeleteProject removes the project document and its attachments.
+	// Deleting a project that has no data is not an error.
+	DeleteProject(productID, projectID int) error
+
+	// SaveBaseline stores a new baseline of the project. Baselines are
+	// immutable; saving a name that already exists fails with an error
+	// wrapping fs.ErrExist.
+	SaveBaseline(productID, projectID int, b *Baseline) error
+	// LoadBaseline returns the named baseline of the project.
+	LoadBaseline(productID, projectID int, name string) (*Baseline, error)
+	// BaselineNames lists the project's baselines in ascending order.
+	BaselineNames(productID, projectID int) ([]string, error)
+
+	// WriteAttachment stores data under relPath for the project.
+	WriteAttachment(productID, projectID int, relPath string, data []byte) error
+	// ReadAttachment returns the content stored under relPath.
+	ReadAttachment(productID, projectID int, relPath string) ([]byte, error)
+	// RemoveAttachment deletes the content stored under relPath.
+	RemoveAttachment(productID, projectID int, relPath string) error
+	// AttachmentIDs lists the numeric attachment folders in ascending order.
+	AttachmentIDs(productID, projectID int) ([]int, error)
+}
+
+// localStore is implemented by stores that keep attachments as plain files.
+// It lets LLM uploads and file moves work on the files directly instead of
+// going through temporary copies.
+type localStore interface {
+	ProjectPath(productID, projectID int) string
+	ImportAttachment(productID, projectID int, relPath, src string) error
+}
+
+// ErrNoLocalFiles is returned by operations that need a filesystem-backed
+// store, such as scanning a project's input folder.
+var ErrNoLocalFiles = errors.New("store does not keep project files on disk")
+
+// -----------------------------------------------------------------------------
+// Layout & encoding shared by all stores
+// -----------------------------------------------------------------------------
+
+// indexKey is the slash-separated location of the index within a store.
+func indexKey() string {
+	return path.Join(productsDir, indexFilename)
+}
+
+func productKey(productID int) string {
+	return path.Join(productsDir, strconv.Itoa(productID))
+}
+
+func projectKey(productID, projectID int) string {
+	return path.Join(productKey(productID), "projects", strconv.Itoa(projectID))
+}
+
+func projectFileKey(productID, projectID int) string {
+	return path.Join(projectKey(productID, projectID), projectTOML)
+}
+
+func baselinesKey(productID, projectID int) string {
+	return path.Join(projectKey(productID, projectID), baselinesDir)
+}
+
+func baselineKey(productID, projectID int, name string) (string, error) {
+	if !validBaselineName(name) {
+		return "", fmt.Errorf("invalid baseline name %q", name)
+	}
+	return path.Join(baselinesKey(productID, projectID), name+".toml"), nil
+}
+
+// validBaselineName reports whether name can be used as a baseline file name:
+// letters, digits, '.', '_' and '-', not starting with '.'.
+func validBaselineName(name string) bool {
+	if name == "" || name[0] == '.' {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func attachmentKey(productID, projectID int, relPath string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(relPath))
+	if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid attachment path %q", relPath)
+	}
+	return path.Join(projectKey(productID, projectID), clean), nil
+}
+
+// diskProject is the on-disk form of a project. ProjectData is included even
+// though the field is tagged with toml:"-" in ProjectType.
+type diskProject struct {
+	SchemaVersion int         `toml:"schema_version"`
+	ID            int         `toml:"id"`
+	ProductID     int         `toml:"productid"`
+	Name          string      `toml:"name"`
+	Revision      int         `toml:"revision"`
+	D             ProjectData `toml:"projectdata"`
+}
+
+// diskBaseline is the on-disk form of a baseline. It mirrors diskProject so
+// the project migrations apply to baselines as well.
+type diskBaseline struct {
+	SchemaVersion int         `toml:"schema_version"`
+	ID            int         `toml:"id"`
+	ProductID     int         `toml:"productid"`
+	Baseline      string      `toml:"baseline"`
+	CreatedAt     time.Time   `toml:"created_at"`
+	CreatedBy     string      `toml:"created_by"`
+	Revision      int         `toml:"revision"`
+	D             ProjectData `toml:"projectdata"`
+}
+
+// diskIndex is the on-disk form of the database index.
+type diskIndex struct {
+	SchemaVersion int           `toml:"schema_version"`
+	NextProductID int           `toml:"next_product_id"`
+	Products      []ProductType `toml:"products"`
+}
+
+// apply copies the decoded project into prj.
+func (dp *diskProject) apply(prj *ProjectType) {
+	prj.ID = dp.ID
+	prj.ProductID = dp.ProductID
+	prj.Name = dp.Name
+	prj.Revision = dp.Revision
+	prj.D = dp.D
+}
+
+func encodeIndex(db *Database) ([]byte, error) {
+	idx := diskIndex{SchemaVersion: SchemaVersion, NextProductID: db.NextProductID, Products: db.Products}
+	b, err := toml.Marshal(&idx)
+	if err != nil {
+		return nil, fmt.Errorf("toml marshal: %w", err)
+	}
+	return b, nil
+}
+
+// decodeIndex decodes b into db, migrating older schema versions in memory.
+func decodeIndex(b []byte, db *Database) error {
+	var idx diskIndex
+	steps, err := decodeMigrated(IndexDoc, indexKey(), b, &idx)
+	if err != nil {
+		return err
+	}
+	db.Products = idx.Products
+	db.NextProductID = idx.NextProductID
+	if db.Products == nil {
+		db.Products = []ProductType{}
+	}
+	db.migrated = steps
+	return nil
+}
+
+func encodeProject(prj *ProjectType) ([]byte, error) {
+	dp := diskProject{
+		SchemaVersion: SchemaVersion,
+		ID:            prj.ID,
+		ProductID:     prj.ProductID,
+		Name:          prj.Name,
+		Revision:      prj.Revision,
+		D:             prj.D,
+	}
+	b, err := toml.Marshal(&dp)
+	if err != nil {
+		return nil, fmt.Errorf("toml marshal: %w", err)
+	}
+	return b, nil
+}
+
+// decodeProject decodes b into prj, migrating older schema versions in
+// memory.
+func decodeProject(b []byte, prj *ProjectType) error {
+	var dp diskProject
+	steps, err := decodeMigrated(ProjectDoc, projectFileKey(prj.ProductID, prj.ID), b, &dp)
+	if err != nil {
+		return err
+	}
+	dp.apply(prj)
+	prj.migrated = steps
+	return nil
+}
+
+func encodeBaseline(productID, projectID int, b *Baseline) ([]byte, error) {
+	db := diskBaseline{
+		SchemaVersion: SchemaVersion,
+		ID:            projectID,
+		ProductID:     productID,
+		Baseline:      b.Name,
+		CreatedAt:     b.CreatedAt,
+		CreatedBy:     b.CreatedBy,
+		Revision:      b.Revision,
+		D:             b.D,
+	}
+	out, err := toml.Marshal(&db)
+	if err != nil {
+		return nil, fmt.Errorf("toml marshal: %w", err)
+	}
+	return out, nil
+}
+
+// decodeBaseline decodes a stored baseline. Baselines are never rewritten, so
+// older schema versions are migrated in memory on every load.
+func decodeBaseline(key string, b []byte) (*Baseline, error) {
+	var db diskBaseline
+	if _, err := decodeMigrated(ProjectDoc, key, b, &db); err != nil {
+		return nil, err
+	}
+	return &Baseline{Name: db.Baseline, CreatedAt: db.CreatedAt, CreatedBy: db.CreatedBy, Revision: db.Revision, D: db.D}, nil
+}
+
+// baselineNamesFromKeys extracts baseline names from keys below prefix
+// ("…/baselines/").
+func baselineNamesFromKeys(keys []string, prefix string) []string {
+	out := []string{}
+	for _, k := range keys {
+		name, ok := strings.CutPrefix(k, prefix)
+		if !ok || strings.Contains(name, "/") || path.Ext(name) != ".toml" {
+			continue
+		}
+		out = append(out, strings.TrimSuffix(name, ".toml"))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// attachmentIDsFromKeys extracts numeric attachment folder IDs from keys
+// below prefix ("…/attachments/").
+func attachmentIDsFromKeys(keys []string, prefix string) []int {
+	seen := map[int]bool{}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		seg, _, _ := strings.Cut(strings.TrimPrefix(k, prefix), "/")
+		if id, err := strconv.Atoi(seg); err == nil && id > 0 {
+			seen[id] = true
+		}
+	}
+	out := make([]int, 0, len(seen))
+	for id := range seen {
+		out = append(out, id)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// notExist wraps fs.ErrNotExist with the missing key.
+func notExist(key string) error {
+	return fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+}
+
+// withAttachmentFile calls fn with a local path holding the attachment at
+// relPath. Filesystem stores hand out the stored file directly; other stores
+// materialize a temporary copy which is removed afterwards.
+func withAttachmentFile(s Store, prj *ProjectType, relPath string, fn func(path string) error) error {
+	if ls, ok := s.(localStore); ok {
+		return fn(filepath.Join(ls.ProjectPath(prj.ProductID, prj.ID), filepath.FromSlash(relPath)))
+	}
+	data, err := s.ReadAttachment(prj.ProductID, prj.ID, relPath)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "pmfs-*"+path.Ext(relPath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return fn(tmp.Name())
+}
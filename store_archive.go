@@ -0,0 +1,171 @@
+package PMFS
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ArchiveStore keeps the whole database in a single zip file. Entries use the
+// same layout as FSStore, so unpacking the archive yields a directory that
+// NewFSStore can open. The archive is rewritten atomically after every
+// mutation; it suits small databases that should travel as one file.
+type ArchiveStore struct {
+	path string
+	mu   sync.Mutex // serializes mutations and archive rewrites
+	mem  *MemoryStore
+}
+
+// OpenArchiveStore opens the archive at path, creating an empty store when
+// the file does not exist yet.
+func OpenArchiveStore(path string) (*ArchiveStore, error) {
+	s := &ArchiveStore{path: path, mem: NewMemoryStore()}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("open archive %s: %w", path, err)
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s from archive: %w", f.Name, err)
+		}
+		s.mem.put(f.Name, data)
+	}
+	return s, nil
+}
+
+// Path returns the location of the archive file.
+func (s *ArchiveStore) Path() string { return s.path }
+
+// flush rewrites the archive from the in-memory documents.
+func (s *ArchiveStore) flush() error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, k := range s.mem.keys() {
+		w, err := zw.Create(k)
+		if err != nil {
+			return err
+		}
+		data, err := s.mem.get(k)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf.Bytes(), 0o644)
+}
+
+// mutate applies fn to the in-memory documents and persists the archive.
+func (s *ArchiveStore) mutate(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// LoadIndex decodes the archived index into db.
+func (s *ArchiveStore) LoadIndex(db *Database) error { return s.mem.LoadIndex(db) }
+
+// SaveIndex stores the index and rewrites the archive.
+func (s *ArchiveStore) SaveIndex(db *Database) error {
+	return s.mutate(func() error { return s.mem.SaveIndex(db) })
+}
+
+// InitProduct is a no-op; products need no preparation in an archive.
+func (s *ArchiveStore) InitProduct(productID int) error { return nil }
+
+// LoadProject decodes the archived project into prj.
+func (s *ArchiveStore) LoadProject(prj *ProjectType) error { return s.mem.LoadProject(prj) }
+
+// SaveProject stores the project and rewrites the archive.
+func (s *ArchiveStore) SaveProject(prj *ProjectType) error {
+	return s.mutate(func() error { return s.mem.SaveProject(prj) })
+}
+
+// WriteAttachment stores data under relPath and rewrites the archive.
+func (s *ArchiveStore) WriteAttachment(productID, projectID int, relPath string, data []byte) error {
+	return s.mutate(func() error { return s.mem.WriteAttachment(productID, projectID, relPath, data) })
+}
+
+// ReadAttachment returns the archived data stored under relPath.
+func (s *ArchiveStore) ReadAttachment(productID, projectID int, relPath string) ([]byte, error) {
+	return s.mem.ReadAttachment(productID, projectID, relPath)
+}
+
+// RemoveAttachment deletes relPath from the archive.
+func (s *ArchiveStore) RemoveAttachment(productID, projectID int, relPath string) error {
+	return s.mutate(func() error { return s.mem.RemoveAttachment(productID, projectID, relPath) })
+}
+
+// AttachmentIDs lists the numeric attachment folders of the project.
+func (s *ArchiveStore) AttachmentIDs(productID, projectID int) ([]int, error) {
+	return s.mem.AttachmentIDs(productID, projectID)
+}
+
+// Backup copies the archive file next to itself as <name>.<label><ext>.
+func (s *ArchiveStore) Backup(label string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("backup %s: %w", s.path, err)
+	}
+	ext := filepath.Ext(s.path)
+	dst := strings.TrimSuffix(s.path, ext) + "." + label + ext
+	if err := writeFileAtomic(dst, b, 0o644); err != nil {
+		return "", fmt.Errorf("backup %s: %w", s.path, err)
+	}
+	return dst, nil
+}
+
+// DeleteProduct removes the product from the archive.
+func (s *ArchiveStore) DeleteProduct(productID int) error {
+	return s.mutate(func() error { return s.mem.DeleteProduct(productID) })
+}
+
+// DeleteProject removes the project from the archive.
+func (s *ArchiveStore) DeleteProject(productID, projectID int) error {
+	return s.mutate(func() error { return s.mem.DeleteProject(productID, projectID) })
+}
+
+// SaveBaseline stores a new baseline and rewrites the archive.
+func (s *ArchiveStore) SaveBaseline(productID, projectID int, b *Baseline) error {
+	return s.mutate(func() error { return s.mem.SaveBaseline(productID, projectID, b) })
+}
+
+// LoadBaseline decodes the named archived baseline.
+func (s *ArchiveStore) LoadBaseline(productID, projectID int, name string) (*Baseline, error) {
+	return s.mem.LoadBaseline(productID, projectID, name)
+}
+
+// BaselineNames lists the archived baselines of the project.
+func (s *ArchiveStore) BaselineNames(productID, projectID int) ([]string, error) {
+	return s.mem.BaselineNames(productID, projectID)
+}
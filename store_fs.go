@@ -0,0 +1,241 @@
+package PMFS
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FSStore keeps the database as a directory tree of TOML files:
+//
+//	<base>/products/index.toml
+//	<base>/products/<productID>/projects/<projectID>/project.toml
+//	<base>/products/<productID>/projects/<projectID>/baselines/<name>.toml
+//	<base>/products/<productID>/projects/<projectID>/attachments/<id>/<file>
+//
+// Every TOML write is atomic and keeps the previous generation as *.bak.
+type FSStore struct {
+	baseDir string
+}
+
+// NewFSStore returns a filesystem store rooted at baseDir.
+func NewFSStore(baseDir string) *FSStore {
+	return &FSStore{baseDir: baseDir}
+}
+
+// BaseDir returns the directory the store is rooted at.
+func (s *FSStore) BaseDir() string { return s.baseDir }
+
+func (s *FSStore) path(key string) string {
+	return filepath.Join(s.baseDir, filepath.FromSlash(key))
+}
+
+// LoadIndex reads index.toml into db, recovering from its backup if needed.
+func (s *FSStore) LoadIndex(db *Database) error {
+	return readRecover(s.path(indexKey()), func(b []byte) error {
+		return decodeIndex(b, db)
+	})
+}
+
+// SaveIndex writes index.toml, creating the products folder when missing.
+func (s *FSStore) SaveIndex(db *Database) error {
+	p := s.path(indexKey())
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("mkdir %s: %w", filepath.Dir(p), err)
+	}
+	b, err := encodeIndex(db)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, b, 0o644)
+}
+
+// InitProduct creates the product's projects folder.
+func (s *FSStore) InitProduct(productID int) error {
+	if err := os.MkdirAll(filepath.Join(s.path(productKey(productID)), "projects"), 0o755); err != nil {
+		return fmt.Errorf("mkdir product/projects: %w", err)
+	}
+	return nil
+}
+
+// LoadProject reads project.toml into prj, recovering from its backup if
+// needed.
+func (s *FSStore) LoadProject(prj *ProjectType) error {
+	return readRecover(s.path(projectFileKey(prj.ProductID, prj.ID)), func(b []byte) error {
+		return decodeProject(b, prj)
+	})
+}
+
+// SaveProject writes project.toml, creating the project folder when missing.
+func (s *FSStore) SaveProject(prj *ProjectType) error {
+	dir := s.ProjectPath(prj.ProductID, prj.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("mkdir project dir: %w", err)
+	}
+	b, err := encodeProject(prj)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, projectTOML), b, 0o644)
+}
+
+func (s *FSStore) attachmentPath(productID, projectID int, relPath string) (string, error) {
+	key, err := attachmentKey(productID, projectID, relPath)
+	if err != nil {
+		return "", err
+	}
+	return s.path(key), nil
+}
+
+// WriteAttachment writes data to the attachment file at relPath.
+func (s *FSStore) WriteAttachment(productID, projectID int, relPath string, data []byte) error {
+	p, err := s.attachmentPath(productID, projectID, relPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("mkdir attachment dir: %w", err)
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+// ReadAttachment returns the content of the attachment file at relPath.
+func (s *FSStore) ReadAttachment(productID, projectID int, relPath string) ([]byte, error) {
+	p, err := s.attachmentPath(productID, projectID, relPath)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// RemoveAttachment deletes the attachment file at relPath.
+func (s *FSStore) RemoveAttachment(productID, projectID int, relPath string) error {
+	p, err := s.attachmentPath(productID, projectID, relPath)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// AttachmentIDs lists the numeric folders below the project's attachments/.
+func (s *FSStore) AttachmentIDs(productID, projectID int) ([]int, error) {
+	return numericSubdirs(filepath.Join(s.ProjectPath(productID, projectID), "attachments"))
+}
+
+// ProjectPath returns the project's folder on disk.
+func (s *FSStore) ProjectPath(productID, projectID int) string {
+	return s.path(projectKey(productID, projectID))
+}
+
+// ImportAttachment moves src into the project at relPath.
+func (s *FSStore) ImportAttachment(productID, projectID int, relPath, src string) error {
+	dst, err := s.attachmentPath(productID, projectID, relPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("mkdir attachment dir: %w", err)
+	}
+	return moveFile(src, dst)
+}
+
+// Backup copies every TOML document below products/ to
+// backups/<label>/products/. Attachments are not copied; migrations never
+// touch them.
+func (s *FSStore) Backup(label string) (string, error) {
+	src := s.path(productsDir)
+	dst := filepath.Join(s.baseDir, "backups", label)
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".toml" {
+			return nil
+		}
+		rel, err := filepath.Rel(s.baseDir, p)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return err
+		}
+		return writeFileAtomic(out, b, 0o644)
+	})
+	if err != nil {
+		return "", fmt.Errorf("backup %s: %w", src, err)
+	}
+	return dst, nil
+}
+
+// DeleteProduct removes the product's folder.
+func (s *FSStore) DeleteProduct(productID int) error {
+	return os.RemoveAll(s.path(productKey(productID)))
+}
+
+// DeleteProject removes the project's folder.
+func (s *FSStore) DeleteProject(productID, projectID int) error {
+	return os.RemoveAll(s.ProjectPath(productID, projectID))
+}
+
+// SaveBaseline writes baselines/<name>.toml in the project folder. Existing
+// baselines are never replaced; callers sharing the project hold its lock.
+func (s *FSStore) SaveBaseline(productID, projectID int, bl *Baseline) error {
+	key, err := baselineKey(productID, projectID, bl.Name)
+	if err != nil {
+		return err
+	}
+	p := s.path(key)
+	if ok, err := fileExists(p); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%s: %w", key, fs.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("mkdir baselines dir: %w", err)
+	}
+	b, err := encodeBaseline(productID, projectID, bl)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, b, 0o644)
+}
+
+// LoadBaseline reads baselines/<name>.toml from the project folder.
+func (s *FSStore) LoadBaseline(productID, projectID int, name string) (*Baseline, error) {
+	key, err := baselineKey(productID, projectID, name)
+	if err != nil {
+		return nil, err
+	}
+	var bl *Baseline
+	err = readRecover(s.path(key), func(b []byte) error {
+		bl, err = decodeBaseline(key, b)
+		return err
+	})
+	return bl, err
+}
+
+// BaselineNames lists the *.toml files below the project's baselines/.
+func (s *FSStore) BaselineNames(productID, projectID int) ([]string, error) {
+	entries, err := os.ReadDir(s.path(baselinesKey(productID, projectID)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	out := []string{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".toml")
+		if ok && !e.IsDir() && validBaselineName(name) {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
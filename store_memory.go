@@ -0,0 +1,207 @@
+package PMFS
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps every document in memory. It is intended for tests and
+// short-lived tools. Documents are stored in their encoded form so loading
+// always yields an independent copy, exactly like reading from disk.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	docs map[string][]byte
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{docs: map[string][]byte{}}
+}
+
+func (s *MemoryStore) get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.docs[key]
+	if !ok {
+		return nil, notExist(key)
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (s *MemoryStore) put(key string, b []byte) {
+	s.mu.Lock()
+	s.docs[key] = append([]byte(nil), b...)
+	s.mu.Unlock()
+}
+
+func (s *MemoryStore) keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.docs))
+	for k := range s.docs {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// LoadIndex decodes the stored index into db.
+func (s *MemoryStore) LoadIndex(db *Database) error {
+	b, err := s.get(indexKey())
+	if err != nil {
+		return err
+	}
+	return decodeIndex(b, db)
+}
+
+// SaveIndex stores the encoded index of db.
+func (s *MemoryStore) SaveIndex(db *Database) error {
+	b, err := encodeIndex(db)
+	if err != nil {
+		return err
+	}
+	s.put(indexKey(), b)
+	return nil
+}
+
+// InitProduct is a no-op; products need no preparation in memory.
+func (s *MemoryStore) InitProduct(productID int) error { return nil }
+
+// LoadProject decodes the stored project into prj.
+func (s *MemoryStore) LoadProject(prj *ProjectType) error {
+	b, err := s.get(projectFileKey(prj.ProductID, prj.ID))
+	if err != nil {
+		return err
+	}
+	return decodeProject(b, prj)
+}
+
+// SaveProject stores the encoded project.
+func (s *MemoryStore) SaveProject(prj *ProjectType) error {
+	b, err := encodeProject(prj)
+	if err != nil {
+		return err
+	}
+	s.put(projectFileKey(prj.ProductID, prj.ID), b)
+	return nil
+}
+
+// WriteAttachment stores data under relPath.
+func (s *MemoryStore) WriteAttachment(productID, projectID int, relPath string, data []byte) error {
+	key, err := attachmentKey(productID, projectID, relPath)
+	if err != nil {
+		return err
+	}
+	s.put(key, data)
+	return nil
+}
+
+// ReadAttachment returns the data stored under relPath.
+func (s *MemoryStore) ReadAttachment(productID, projectID int, relPath string) ([]byte, error) {
+	key, err := attachmentKey(productID, projectID, relPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.get(key)
+}
+
+// RemoveAttachment deletes the data stored under relPath.
+func (s *MemoryStore) RemoveAttachment(productID, projectID int, relPath string) error {
+	key, err := attachmentKey(productID, projectID, relPath)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.docs[key]; !ok {
+		return notExist(key)
+	}
+	delete(s.docs, key)
+	return nil
+}
+
+// AttachmentIDs lists the numeric attachment folders of the project.
+func (s *MemoryStore) AttachmentIDs(productID, projectID int) ([]int, error) {
+	prefix := projectKey(productID, projectID) + "/attachments/"
+	return attachmentIDsFromKeys(s.keys(), prefix), nil
+}
+
+// Backup copies every TOML document to backups/<label>/ within the store.
+func (s *MemoryStore) Backup(label string) (string, error) {
+	prefix := path.Join("backups", label)
+	for _, k := range s.keys() {
+		if strings.HasPrefix(k, "backups/") || path.Ext(k) != ".toml" {
+			continue
+		}
+		b, err := s.get(k)
+		if err != nil {
+			return "", err
+		}
+		s.put(path.Join(prefix, k), b)
+	}
+	return prefix, nil
+}
+
+// deletePrefix removes every document below prefix.
+func (s *MemoryStore) deletePrefix(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.docs {
+		if strings.HasPrefix(k, prefix+"/") {
+			delete(s.docs, k)
+		}
+	}
+}
+
+// DeleteProduct removes every document of the product.
+func (s *MemoryStore) DeleteProduct(productID int) error {
+	s.deletePrefix(productKey(productID))
+	return nil
+}
+
+// DeleteProject removes every document of the project.
+func (s *MemoryStore) DeleteProject(productID, projectID int) error {
+	s.deletePrefix(projectKey(productID, projectID))
+	return nil
+}
+
+// SaveBaseline stores a new baseline, refusing to replace an existing one.
+func (s *MemoryStore) SaveBaseline(productID, projectID int, bl *Baseline) error {
+	key, err := baselineKey(productID, projectID, bl.Name)
+	if err != nil {
+		return err
+	}
+	b, err := encodeBaseline(productID, projectID, bl)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.docs[key]; ok {
+		return fmt.Errorf("%s: %w", key, fs.ErrExist)
+	}
+	s.docs[key] = b
+	return nil
+}
+
+// LoadBaseline decodes the named baseline.
+func (s *MemoryStore) LoadBaseline(productID, projectID int, name string) (*Baseline, error) {
+	key, err := baselineKey(productID, projectID, name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBaseline(key, b)
+}
+
+// BaselineNames lists the baselines stored for the project.
+func (s *MemoryStore) BaselineNames(productID, projectID int) ([]string, error) {
+	return baselineNamesFromKeys(s.keys(), baselinesKey(productID, projectID)+"/"), nil
+}
@@ -0,0 +1,179 @@
+package PMFS
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	llm "github.com/rjboer/PMFS/pmfs/llm"
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+// storeCases returns a fresh instance of every bundled Store implementation.
+func storeCases(t *testing.T) map[string]func() Store {
+	t.Helper()
+	dir := t.TempDir()
+	return map[string]func() Store{
+		"fs":     func() Store { return NewFSStore(filepath.Join(dir, "fs")) },
+		"memory": func() Store { return NewMemoryStore() },
+		"archive": func() Store {
+			s, err := OpenArchiveStore(filepath.Join(dir, "db.zip"))
+			if err != nil {
+				t.Fatalf("OpenArchiveStore: %v", err)
+			}
+			return s
+		},
+	}
+}
+
+func TestStoresRoundTripProductsAndProjects(t *testing.T) {
+	for name, newStore := range storeCases(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStore()
+			db, err := Open(s)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+				t.Fatalf("NewProduct: %v", err)
+			}
+			prd := &db.Products[0]
+			id, err := prd.NewProject(ProjectData{Name: "prj", Scope: "scope"})
+			if err != nil {
+				t.Fatalf("NewProject: %v", err)
+			}
+			prj, err := prd.Project(id)
+			if err != nil {
+				t.Fatalf("Project: %v", err)
+			}
+			prj.D.Requirements = []Requirement{{ID: 1, Name: "R1"}}
+			if err := prj.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			db2, err := Open(s)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			if len(db2.Products) != 1 || len(db2.Products[0].Projects) != 1 {
+				t.Fatalf("index not persisted: %#v", db2.Products)
+			}
+			reload := ProjectType{ID: id, ProductID: prd.ID}
+			if err := reload.Load(); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if reload.D.Scope != "scope" || len(reload.D.Requirements) != 1 {
+				t.Fatalf("project not persisted: %#v", reload.D)
+			}
+
+			missing := ProjectType{ID: 99, ProductID: prd.ID}
+			if err := missing.Load(); !errors.Is(err, ErrProjectNotFound) {
+				t.Fatalf("expected ErrProjectNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoresAttachments(t *testing.T) {
+	orig := llm.SetClient(gemini.ClientFunc{
+		AnalyzeAttachmentFunc: func(path string) ([]gemini.Requirement, error) {
+			return []gemini.Requirement{{Name: "R1", Description: "from " + filepath.Ext(path)}}, nil
+		},
+		AskFunc: func(prompt string) (string, error) { return "[]", nil },
+	})
+	defer llm.SetClient(orig)
+
+	for name, newStore := range storeCases(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStore()
+			db, err := Open(s)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+				t.Fatalf("NewProduct: %v", err)
+			}
+			if _, err := db.Products[0].NewProject(ProjectData{Name: "prj"}); err != nil {
+				t.Fatalf("NewProject: %v", err)
+			}
+			prj := &db.Products[0].Projects[0]
+
+			att, err := prj.AddAttachmentFromText("hello")
+			if err != nil {
+				t.Fatalf("AddAttachmentFromText: %v", err)
+			}
+			if att.ID != 1 || att.RelPath != "attachments/1/note.txt" || !att.Analyzed {
+				t.Fatalf("unexpected attachment: %#v", att)
+			}
+			if len(prj.D.Requirements) != 1 || prj.D.Requirements[0].Description != "from .txt" {
+				t.Fatalf("attachment not analyzed through store: %#v", prj.D.Requirements)
+			}
+			att2, err := prj.AddAttachmentData("spec.md", []byte("# spec"))
+			if err != nil {
+				t.Fatalf("AddAttachmentData: %v", err)
+			}
+			if att2.ID != 2 {
+				t.Fatalf("expected second attachment ID 2, got %d", att2.ID)
+			}
+			ids, err := s.AttachmentIDs(prj.ProductID, prj.ID)
+			if err != nil || len(ids) != 2 {
+				t.Fatalf("AttachmentIDs = %v, %v", ids, err)
+			}
+			_, data, err := prj.ReadAttachment(1)
+			if err != nil || string(data) != "hello" {
+				t.Fatalf("ReadAttachment = %q, %v", data, err)
+			}
+			if err := prj.RemoveAttachment(1); err != nil {
+				t.Fatalf("RemoveAttachment: %v", err)
+			}
+			if _, err := s.ReadAttachment(prj.ProductID, prj.ID, att.RelPath); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("attachment still stored: %v", err)
+			}
+			if _, _, err := prj.ReadAttachment(1); !errors.Is(err, ErrAttachmentNotFound) {
+				t.Fatalf("expected ErrAttachmentNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveStoreSurvivesReopen(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "pmfs.zip")
+	s, err := OpenArchiveStore(p)
+	if err != nil {
+		t.Fatalf("OpenArchiveStore: %v", err)
+	}
+	db, err := Open(s)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if err := s.WriteAttachment(1, 1, "attachments/1/a.bin", []byte{0, 1, 2}); err != nil {
+		t.Fatalf("WriteAttachment: %v", err)
+	}
+
+	s2, err := OpenArchiveStore(p)
+	if err != nil {
+		t.Fatalf("reopen archive: %v", err)
+	}
+	db2, err := Open(s2)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(db2.Products) != 1 || db2.Products[0].Name != "prod" {
+		t.Fatalf("index not persisted in archive: %#v", db2.Products)
+	}
+	data, err := s2.ReadAttachment(1, 1, "attachments/1/a.bin")
+	if err != nil || len(data) != 3 || data[2] != 2 {
+		t.Fatalf("attachment not persisted in archive: %v, %v", data, err)
+	}
+}
+
+func TestAttachmentPathMustStayInsideProject(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.WriteAttachment(1, 1, "../../escape", nil); err == nil {
+		t.Fatalf("expected error for path escaping the project")
+	}
+}
@@ -0,0 +1,415 @@
+package PMFS
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTestCaseNotFound is returned when no test case has the given ID.
+	ErrTestCaseNotFound = errors.New("test case not found")
+	// ErrInvalidTestCase is returned for test cases without a name or with
+	// an unknown result.
+	ErrInvalidTestCase = errors.New("invalid test case")
+	// ErrNotVerified is returned by the "tests-passed" workflow guard while
+	// a requirement is not verified by its test cases.
+	ErrNotVerified = errors.New("requirement not verified")
+)
+
+// TestResult is the outcome of a test case's last execution.
+type TestResult string
+
+// Test results; a test case that never ran has TestNotRun.
+const (
+	TestNotRun  TestResult = ""
+	TestPassed  TestResult = "passed"
+	TestFailed  TestResult = "failed"
+	TestSkipped TestResult = "skipped"
+)
+
+// TestStep is an action of a test case with the result it should produce.
+type TestStep struct {
+	Action   string `json:"action" toml:"action"`
+	Expected string `json:"expected" toml:"expected"`
+}
+
+// TestCase verifies the requirements in RequirementIDs. Automation is the
+// name of the automated test reporting its results, matched against JUnit
+// test cases as "classname.name" or "name"; when empty the test case's Name
+// is matched instead.
+type TestCase struct {
+	ID             int        `json:"id" toml:"id"`
+	Name           string     `json:"name" toml:"name"`
+	Description    string     `json:"description" toml:"description"`
+	Steps          []TestStep `json:"steps" toml:"steps"`
+	RequirementIDs []int      `json:"requirement_ids" toml:"requirement_ids"`
+	Automation     string     `json:"automation,omitempty" toml:"automation"`
+	LastResult     TestResult `json:"last_result" toml:"last_result"`
+	LastRunAt      time.Time  `json:"last_run_at" toml:"last_run_at"`
+	LastMessage    string     `json:"last_message,omitempty" toml:"last_message"` // failure or skip message
+}
+
+// The "tests-passed" guard lets a requirement move, e.g. to Verified, only
+// once every test case verifying it passed.
+func init() {
+	RegisterGuard("tests-passed", func(prj *ProjectType, r *Requirement) error {
+		if v := prj.VerificationOf(r.ID); v != VerificationVerified {
+			return fmt.Errorf("%s: %w", v, ErrNotVerified)
+		}
+		return nil
+	})
+}
+
+// validate checks the name and result of the test case.
+func (tc TestCase) validate() error {
+	if strings.TrimSpace(tc.Name) == "" {
+		return fmt.Errorf("test case %d: name is empty: %w", tc.ID, ErrInvalidTestCase)
+	}
+	switch tc.LastResult {
+	case TestNotRun, TestPassed, TestFailed, TestSkipped:
+	default:
+		return fmt.Errorf("test case %d: result %q: %w", tc.ID, tc.LastResult, ErrInvalidTestCase)
+	}
+	return nil
+}
+
+// nextTestCaseID returns the next test case ID and advances the project's
+// counter, raising it past existing IDs for projects edited by hand.
+func (prj *ProjectType) nextTestCaseID() int {
+	id := max(prj.D.NextTestCaseID, 1)
+	for _, tc := range prj.D.TestCases {
+		id = max(id, tc.ID+1)
+	}
+	prj.D.NextTestCaseID = id + 1
+	return id
+}
+
+// TestCaseByID returns the test case with the given ID.
+func (prj *ProjectType) TestCaseByID(id int) (*TestCase, error) {
+	for i := range prj.D.TestCases {
+		if prj.D.TestCases[i].ID == id {
+			return &prj.D.TestCases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("test case %d: %w", id, ErrTestCaseNotFound)
+}
+
+// checkTestLinks reports requirements linked to tc that the project lacks.
+func (prj *ProjectType) checkTestLinks(tc TestCase) error {
+	for _, id := range tc.RequirementIDs {
+		if _, err := prj.RequirementByID(id); err != nil {
+			return fmt.Errorf("test case %d: %w", tc.ID, err)
+		}
+	}
+	return nil
+}
+
+// AddTestCase adds tc with a new ID and persists the project. It returns the
+// stored test case.
+func (prj *ProjectType) AddTestCase(tc TestCase) (*TestCase, error) {
+	tc.ID = 0
+	if err := tc.validate(); err != nil {
+		return nil, err
+	}
+	if err := prj.checkTestLinks(tc); err != nil {
+		return nil, err
+	}
+	tc.ID = prj.nextTestCaseID()
+	prj.D.TestCases = append(prj.D.TestCases, tc)
+	if err := prj.Save(); err != nil {
+		return nil, err
+	}
+	return &prj.D.TestCases[len(prj.D.TestCases)-1], nil
+}
+
+// UpdateTestCase replaces the test case with tc's ID and persists the
+// project.
+func (prj *ProjectType) UpdateTestCase(tc TestCase) error {
+	ex, err := prj.TestCaseByID(tc.ID)
+	if err != nil {
+		return err
+	}
+	if err := tc.validate(); err != nil {
+		return err
+	}
+	if err := prj.checkTestLinks(tc); err != nil {
+		return err
+	}
+	*ex = tc
+	return prj.Save()
+}
+
+// RemoveTestCase drops the test case and persists the project.
+func (prj *ProjectType) RemoveTestCase(id int) error {
+	if _, err := prj.TestCaseByID(id); err != nil {
+		return err
+	}
+	prj.D.TestCases = slices.DeleteFunc(prj.D.TestCases, func(tc TestCase) bool { return tc.ID == id })
+	return prj.Save()
+}
+
+// LinkTestCase records that the test case verifies the requirement and
+// persists the project.
+func (prj *ProjectType) LinkTestCase(testCaseID, requirementID int) error {
+	tc, err := prj.TestCaseByID(testCaseID)
+	if err != nil {
+		return err
+	}
+	if _, err := prj.RequirementByID(requirementID); err != nil {
+		return err
+	}
+	if !slices.Contains(tc.RequirementIDs, requirementID) {
+		tc.RequirementIDs = append(tc.RequirementIDs, requirementID)
+	}
+	return prj.Save()
+}
+
+// UnlinkTestCase removes the link between the test case and the requirement
+// and persists the project.
+func (prj *ProjectType) UnlinkTestCase(testCaseID, requirementID int) error {
+	tc, err := prj.TestCaseByID(testCaseID)
+	if err != nil {
+		return err
+	}
+	tc.RequirementIDs = slices.DeleteFunc(tc.RequirementIDs, func(id int) bool { return id == requirementID })
+	return prj.Save()
+}
+
+// removeTestLinksOf drops the requirement from every test case.
+func (prj *ProjectType) removeTestLinksOf(requirementID int) {
+	for i := range prj.D.TestCases {
+		prj.D.TestCases[i].RequirementIDs = slices.DeleteFunc(prj.D.TestCases[i].RequirementIDs, func(id int) bool { return id == requirementID })
+	}
+}
+
+// TestCasesFor returns the test cases verifying the requirement.
+func (prj *ProjectType) TestCasesFor(requirementID int) []TestCase {
+	out := []TestCase{}
+	for _, tc := range prj.D.TestCases {
+		if slices.Contains(tc.RequirementIDs, requirementID) {
+			out = append(out, tc)
+		}
+	}
+	return out
+}
+
+// RecordTestResult stores the outcome of a run of the test case at the
+// current time and persists the project.
+func (prj *ProjectType) RecordTestResult(id int, result TestResult, message string) error {
+	tc, err := prj.TestCaseByID(id)
+	if err != nil {
+		return err
+	}
+	upd := *tc
+	upd.LastResult, upd.LastRunAt, upd.LastMessage = result, time.Now().UTC(), message
+	if err := upd.validate(); err != nil {
+		return err
+	}
+	*tc = upd
+	return prj.Save()
+}
+
+// Verification summarizes the test results of a requirement.
+type Verification string
+
+// Verification states, from the results of the requirement's test cases.
+const (
+	// VerificationUntested means the requirement has no test case.
+	VerificationUntested Verification = "untested"
+	// VerificationPending means no test failed but some did not pass yet.
+	VerificationPending Verification = "pending"
+	// VerificationVerified means every test case passed.
+	VerificationVerified Verification = "verified"
+	// VerificationFailing means at least one test case failed.
+	VerificationFailing Verification = "failing"
+)
+
+// VerificationOf returns the verification state of the requirement from the
+// last results of its test cases.
+func (prj *ProjectType) VerificationOf(requirementID int) Verification {
+	tests := prj.TestCasesFor(requirementID)
+	if len(tests) == 0 {
+		return VerificationUntested
+	}
+	state := VerificationVerified
+	for _, tc := range tests {
+		switch tc.LastResult {
+		case TestFailed:
+			return VerificationFailing
+		case TestPassed:
+		default:
+			state = VerificationPending
+		}
+	}
+	return state
+}
+
+// CoverageRow is a requirement with the test cases verifying it.
+type CoverageRow struct {
+	RequirementID int          `json:"requirement_id"`
+	Key           string       `json:"key"`
+	Name          string       `json:"name"`
+	TestCaseIDs   []int        `json:"test_case_ids"`
+	Verification  Verification `json:"verification"`
+}
+
+// CoverageReport is the requirement coverage matrix of a project.
+type CoverageReport struct {
+	Rows []CoverageRow `json:"rows"`
+	// Untested lists active requirements without test cases.
+	Untested []int `json:"untested"`
+	// Orphans lists test cases linked to no requirement.
+	Orphans []int `json:"orphans"`
+}
+
+// Coverage reports the test cases and verification state of every active
+// requirement, the active requirements no test case verifies and the test
+// cases verifying no requirement.
+func (prj *ProjectType) Coverage() CoverageReport {
+	rep := CoverageReport{Rows: []CoverageRow{}, Untested: []int{}, Orphans: []int{}}
+	for _, r := range prj.D.Requirements {
+		if !r.Condition.Active || r.Condition.Deleted {
+			continue
+		}
+		row := CoverageRow{RequirementID: r.ID, Key: r.Key, Name: r.Name, TestCaseIDs: []int{}, Verification: prj.VerificationOf(r.ID)}
+		for _, tc := range prj.TestCasesFor(r.ID) {
+			row.TestCaseIDs = append(row.TestCaseIDs, tc.ID)
+		}
+		if len(row.TestCaseIDs) == 0 {
+			rep.Untested = append(rep.Untested, r.ID)
+		}
+		rep.Rows = append(rep.Rows, row)
+	}
+	for _, tc := range prj.D.TestCases {
+		if len(tc.RequirementIDs) == 0 {
+			rep.Orphans = append(rep.Orphans, tc.ID)
+		}
+	}
+	return rep
+}
+
+// junitCase is a <testcase> element of a JUnit XML report.
+type junitCase struct {
+	Name      string    `xml:"name,attr"`
+	ClassName string    `xml:"classname,attr"`
+	Failure   *junitMsg `xml:"failure"`
+	Error     *junitMsg `xml:"error"`
+	Skipped   *junitMsg `xml:"skipped"`
+}
+
+type junitMsg struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (m *junitMsg) String() string {
+	if m.Message != "" {
+		return m.Message
+	}
+	return strings.TrimSpace(m.Text)
+}
+
+// junitSuite is a <testsuite> element; suites may nest.
+type junitSuite struct {
+	Cases  []junitCase  `xml:"testcase"`
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+func (s junitSuite) cases() []junitCase {
+	out := s.Cases
+	for _, sub := range s.Suites {
+		out = append(out, sub.cases()...)
+	}
+	return out
+}
+
+// result maps the JUnit outcome to a TestResult and message.
+func (c junitCase) result() (TestResult, string) {
+	switch {
+	case c.Failure != nil:
+		return TestFailed, c.Failure.String()
+	case c.Error != nil:
+		return TestFailed, c.Error.String()
+	case c.Skipped != nil:
+		return TestSkipped, c.Skipped.String()
+	}
+	return TestPassed, ""
+}
+
+// JUnitImport reports the outcome of ImportJUnit.
+type JUnitImport struct {
+	// Updated lists the test cases whose results were recorded.
+	Updated []int `json:"updated"`
+	// Unmatched lists the JUnit test cases, as "classname.name", no test
+	// case is automated by.
+	Unmatched []string `json:"unmatched"`
+}
+
+// ImportJUnit records the results of a JUnit XML report, with a
+// <testsuites> or <testsuite> root, on the test cases automated by its test
+// cases and persists the project. Failures and errors are recorded as
+// TestFailed; a test case matching several JUnit test cases fails when any
+// of them fails. The results are applied through Update, so the project is
+// left unchanged when they cannot be saved.
+func (prj *ProjectType) ImportJUnit(r io.Reader) (JUnitImport, error) {
+	var root junitSuite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return JUnitImport{}, fmt.Errorf("parse JUnit report: %w", err)
+	}
+	now := time.Now().UTC()
+	out := JUnitImport{Updated: []int{}, Unmatched: []string{}}
+	err := prj.Update(func(tx *ProjectTx) error {
+		for _, c := range root.cases() {
+			full := c.Name
+			if c.ClassName != "" {
+				full = c.ClassName + "." + c.Name
+			}
+			res, msg := c.result()
+			matched := false
+			for i := range tx.work.D.TestCases {
+				tc := &tx.work.D.TestCases[i]
+				name := tc.Automation
+				if name == "" {
+					name = tc.Name
+				}
+				if name != full && name != c.Name {
+					continue
+				}
+				matched = true
+				// A test case reported more than once keeps its failure.
+				if slices.Contains(out.Updated, tc.ID) {
+					if tc.LastResult == TestFailed {
+						continue
+					}
+				} else {
+					out.Updated = append(out.Updated, tc.ID)
+				}
+				tc.LastResult, tc.LastRunAt, tc.LastMessage = res, now, msg
+			}
+			if !matched {
+				out.Unmatched = append(out.Unmatched, full)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return JUnitImport{}, err
+	}
+	return out, nil
+}
+
+// ImportJUnitFile reads the JUnit XML report at path; see ImportJUnit.
+func (prj *ProjectType) ImportJUnitFile(path string) (JUnitImport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return JUnitImport{}, err
+	}
+	defer f.Close()
+	return prj.ImportJUnit(f)
+}
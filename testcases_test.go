@@ -0,0 +1,128 @@
+package PMFS
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const junitReport = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="belt">
+    <testcase classname="belt.Stop" name="TestEmergencyStop"/>
+    <testcase classname="belt.Speed" name="TestSpeedDisplay">
+      <failure message="speed shown in m/min">expected m/s</failure>
+    </testcase>
+    <testsuite name="nested">
+      <testcase classname="belt.Speed" name="TestSpeedLimit"><skipped/></testcase>
+      <testcase classname="belt.Misc" name="TestUnknown"/>
+    </testsuite>
+  </testsuite>
+</testsuites>`
+
+func TestCoverage(t *testing.T) {
+	prj := newRelationsProject(t)
+	for i := range prj.D.Requirements[:3] {
+		prj.D.Requirements[i].Status = "Implemented"
+	}
+	if _, err := prj.AddTestCase(TestCase{Name: " "}); !errors.Is(err, ErrInvalidTestCase) {
+		t.Fatalf("expected ErrInvalidTestCase, got %v", err)
+	}
+	if _, err := prj.AddTestCase(TestCase{Name: "Stop", RequirementIDs: []int{9}}); !errors.Is(err, ErrRequirementNotFound) {
+		t.Fatalf("expected ErrRequirementNotFound, got %v", err)
+	}
+	stop, err := prj.AddTestCase(TestCase{
+		Name:           "Emergency stop",
+		Steps:          []TestStep{{Action: "Press the stop button", Expected: "Belt halts within 1 s"}},
+		RequirementIDs: []int{1},
+		Automation:     "belt.Stop.TestEmergencyStop",
+	})
+	if err != nil {
+		t.Fatalf("AddTestCase: %v", err)
+	}
+	stopID := stop.ID
+	for _, tc := range []TestCase{
+		{Name: "TestSpeedDisplay", RequirementIDs: []int{2}},
+		{Name: "TestSpeedLimit", RequirementIDs: []int{2}},
+		{Name: "Manual inspection"},
+	} {
+		if _, err := prj.AddTestCase(tc); err != nil {
+			t.Fatalf("AddTestCase: %v", err)
+		}
+	}
+	if err := prj.LinkTestCase(stopID, 4); err != nil {
+		t.Fatalf("LinkTestCase: %v", err)
+	}
+
+	cov := prj.Coverage()
+	if len(cov.Rows) != 3 || len(cov.Untested) != 1 || cov.Untested[0] != 3 || len(cov.Orphans) != 1 || cov.Orphans[0] != 4 {
+		t.Fatalf("unexpected coverage: %#v", cov)
+	}
+	if got := prj.VerificationOf(1); got != VerificationPending {
+		t.Fatalf("VerificationOf(1) = %q before any run", got)
+	}
+
+	res, err := prj.ImportJUnit(strings.NewReader(junitReport))
+	if err != nil {
+		t.Fatalf("ImportJUnit: %v", err)
+	}
+	if len(res.Updated) != 3 || len(res.Unmatched) != 1 || res.Unmatched[0] != "belt.Misc.TestUnknown" {
+		t.Fatalf("unexpected import: %#v", res)
+	}
+	if tc, _ := prj.TestCaseByID(2); tc.LastResult != TestFailed || tc.LastMessage != "speed shown in m/min" || tc.LastRunAt.IsZero() {
+		t.Fatalf("failure not recorded: %#v", tc)
+	}
+	if got := prj.VerificationOf(1); got != VerificationVerified {
+		t.Fatalf("VerificationOf(1) = %q", got)
+	}
+	if got := prj.VerificationOf(2); got != VerificationFailing {
+		t.Fatalf("VerificationOf(2) = %q", got)
+	}
+	if got := prj.VerificationOf(3); got != VerificationUntested {
+		t.Fatalf("VerificationOf(3) = %q", got)
+	}
+	if err := prj.RecordTestResult(2, "flaky", ""); !errors.Is(err, ErrInvalidTestCase) {
+		t.Fatalf("expected ErrInvalidTestCase, got %v", err)
+	}
+	if err := prj.RecordTestResult(2, TestPassed, ""); err != nil {
+		t.Fatalf("RecordTestResult: %v", err)
+	}
+	if got := prj.VerificationOf(2); got != VerificationPending {
+		t.Fatalf("VerificationOf(2) = %q with a skipped test", got)
+	}
+
+	r1, _ := prj.RequirementByID(1)
+	r2, _ := prj.RequirementByID(2)
+	if err := guards["tests-passed"](prj, r1); err != nil {
+		t.Fatalf("tests-passed guard on a verified requirement: %v", err)
+	}
+	if err := guards["tests-passed"](prj, r2); !errors.Is(err, ErrNotVerified) {
+		t.Fatalf("expected ErrNotVerified, got %v", err)
+	}
+
+	if err := prj.UnlinkTestCase(stopID, 1); err != nil {
+		t.Fatalf("UnlinkTestCase: %v", err)
+	}
+	if err := prj.RemoveTestCase(4); err != nil {
+		t.Fatalf("RemoveTestCase: %v", err)
+	}
+	if cov := prj.Coverage(); len(cov.Untested) != 2 || len(cov.Orphans) != 0 {
+		t.Fatalf("unexpected coverage: %#v", cov)
+	}
+
+	// The ID of the removed last test case is not handed out again.
+	tc, err := prj.AddTestCase(TestCase{Name: "Manual inspection"})
+	if err != nil || tc.ID != 5 {
+		t.Fatalf("AddTestCase = %#v, %v", tc, err)
+	}
+
+	// Results are not kept when the project cannot be saved.
+	prj.D.Requirements[0].ParentID = 2
+	prj.D.Requirements[1].ParentID = 1
+	if _, err := prj.ImportJUnit(strings.NewReader(junitReport)); !errors.Is(err, ErrHierarchyCycle) {
+		t.Fatalf("expected ErrHierarchyCycle, got %v", err)
+	}
+	if tc, _ := prj.TestCaseByID(2); tc.LastResult != TestPassed {
+		t.Fatalf("failed import changed the project: %#v", tc)
+	}
+}
@@ -0,0 +1,109 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIntelligenceNotFound is returned when no intelligence has the given ID.
+var ErrIntelligenceNotFound = errors.New("intelligence not found")
+
+// IntelligenceLink traces a requirement to the intelligence, and the
+// attachment behind it, that produced or backs it. All references are IDs
+// within the project.
+type IntelligenceLink struct {
+	IntelligenceID int `json:"intelligence_id" toml:"intelligence_id"`
+	AttachmentID   int `json:"attachment_id" toml:"attachment_id"` // 0 when unknown
+	RequirementID  int `json:"requirement_id" toml:"requirement_id"`
+}
+
+// nextIntelligenceID returns one more than the highest intelligence ID.
+func (prj *ProjectType) nextIntelligenceID() int {
+	id := 0
+	for _, in := range prj.D.Intelligence {
+		id = max(id, in.ID)
+	}
+	return id + 1
+}
+
+// intelligenceByID returns the project's intelligence with the given ID.
+func (prj *ProjectType) intelligenceByID(id int) (*Intelligence, error) {
+	for i := range prj.D.Intelligence {
+		if prj.D.Intelligence[i].ID == id {
+			return &prj.D.Intelligence[i], nil
+		}
+	}
+	return nil, fmt.Errorf("intelligence %d: %w", id, ErrIntelligenceNotFound)
+}
+
+// addIntelligenceLink appends l unless the same link already exists.
+func (prj *ProjectType) addIntelligenceLink(l IntelligenceLink) {
+	for _, ex := range prj.D.IntelligenceLinks {
+		if ex == l {
+			return
+		}
+	}
+	prj.D.IntelligenceLinks = append(prj.D.IntelligenceLinks, l)
+}
+
+// removeIntelligenceLinksOf drops every link to the requirement.
+func (prj *ProjectType) removeIntelligenceLinksOf(requirementID int) {
+	out := prj.D.IntelligenceLinks[:0]
+	for _, l := range prj.D.IntelligenceLinks {
+		if l.RequirementID != requirementID {
+			out = append(out, l)
+		}
+	}
+	prj.D.IntelligenceLinks = out
+}
+
+// LinkIntelligence records that the intelligence backs the requirement and
+// persists the project. The link also carries the intelligence's attachment.
+// Attachment.GenerateRequirements links the requirements it produces itself.
+func (prj *ProjectType) LinkIntelligence(intelligenceID, requirementID int) error {
+	in, err := prj.intelligenceByID(intelligenceID)
+	if err != nil {
+		return err
+	}
+	if _, err := prj.RequirementByID(requirementID); err != nil {
+		return err
+	}
+	prj.addIntelligenceLink(IntelligenceLink{IntelligenceID: in.ID, AttachmentID: in.AttachmentID, RequirementID: requirementID})
+	return prj.Save()
+}
+
+// RequirementsFromAttachment returns the requirements linked to the
+// attachment with the given ID, in project order.
+func (prj *ProjectType) RequirementsFromAttachment(attachmentID int) []Requirement {
+	ids := map[int]bool{}
+	for _, l := range prj.D.IntelligenceLinks {
+		if l.AttachmentID == attachmentID {
+			ids[l.RequirementID] = true
+		}
+	}
+	out := []Requirement{}
+	for _, r := range prj.D.Requirements {
+		if ids[r.ID] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// IntelligenceFor returns the intelligence linked to the requirement with the
+// given ID, in project order.
+func (prj *ProjectType) IntelligenceFor(requirementID int) []Intelligence {
+	ids := map[int]bool{}
+	for _, l := range prj.D.IntelligenceLinks {
+		if l.RequirementID == requirementID {
+			ids[l.IntelligenceID] = true
+		}
+	}
+	out := []Intelligence{}
+	for _, in := range prj.D.Intelligence {
+		if ids[in.ID] {
+			out = append(out, in)
+		}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package PMFS
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gemini "github.com/rjboer/PMFS/pmfs/llm/gemini"
+)
+
+func TestGenerateRequirementsLinksIntelligence(t *testing.T) {
+	dir := t.TempDir()
+	db, err := LoadSetup(dir)
+	if err != nil {
+		t.Fatalf("LoadSetup: %v", err)
+	}
+	db.LLM = gemini.ClientFunc{
+		AnalyzeAttachmentFunc: func(string) ([]gemini.Requirement, error) {
+			return []gemini.Requirement{{Name: "R1", Description: "new"}, {Name: "R0 again", Description: "known"}}, nil
+		},
+		AskFunc: func(prompt string) (string, error) {
+			switch {
+			case strings.HasPrefix(prompt, "Summarize"):
+				return "summary", nil
+			case strings.HasPrefix(prompt, "Given the intelligence summary"):
+				return "[]", nil
+			}
+			// Duplicate check: only identical descriptions match.
+			if strings.Contains(prompt, "1. known\n2. known") {
+				return "yes", nil
+			}
+			return "no", nil
+		},
+	}
+	if _, err := db.NewProduct(ProductData{Name: "prod"}); err != nil {
+		t.Fatalf("NewProduct: %v", err)
+	}
+	if _, err := db.Products[0].NewProject(ProjectData{Name: "prj"}); err != nil {
+		t.Fatalf("NewProject: %v", err)
+	}
+	prj, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	prj.D.Requirements = []Requirement{{ID: 1, Name: "R0", Description: "known"}}
+	prj.D.Intelligence = []Intelligence{{ID: 4}}
+	rel := filepath.ToSlash(filepath.Join("attachments", "3", "spec.txt"))
+	prj.D.Attachments = []Attachment{{ID: 3, RelPath: rel}}
+	full := filepath.Join(NewFSStore(dir).ProjectPath(1, 1), rel)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(full, []byte("spec"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := prj.D.Attachments[0].GenerateRequirements(prj, ""); err != nil {
+		t.Fatalf("GenerateRequirements: %v", err)
+	}
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	in := prj.D.Intelligence[1]
+	if in.ID != 5 || in.AttachmentID != 3 {
+		t.Fatalf("unexpected intelligence: %#v", in)
+	}
+	// The merged duplicate links the existing requirement.
+	got := prj.RequirementsFromAttachment(3)
+	if len(got) != 2 || got[0].Name != "R0" || got[1].Name != "R1" {
+		t.Fatalf("RequirementsFromAttachment = %#v", got)
+	}
+	if backs := prj.IntelligenceFor(got[1].ID); len(backs) != 1 || backs[0].ID != 5 {
+		t.Fatalf("IntelligenceFor = %#v", backs)
+	}
+
+	if err := prj.LinkIntelligence(4, 1); err != nil {
+		t.Fatalf("LinkIntelligence: %v", err)
+	}
+	if backs := prj.IntelligenceFor(1); len(backs) != 2 {
+		t.Fatalf("manual link missing: %#v", backs)
+	}
+	if err := prj.LinkIntelligence(9, 1); !errors.Is(err, ErrIntelligenceNotFound) {
+		t.Fatalf("expected ErrIntelligenceNotFound, got %v", err)
+	}
+}
+
+func TestMigrateRequirementIntelligenceLinks(t *testing.T) {
+	s := NewMemoryStore()
+	s.put(indexKey(), []byte(legacyIndex))
+	s.put(projectFileKey(1, 1), []byte(`schema_version = 2
+id = 1
+productid = 1
+
+[projectdata]
+[[projectdata.attachments]]
+id = 3
+rel_path = "attachments/3/spec.txt"
+
+[[projectdata.intelligence]]
+id = 7
+Filepath = "attachments/3/spec.txt"
+
+[[projectdata.requirements]]
+id = 2
+key = "PRD1-PRJ1-REQ-0002"
+
+[[projectdata.requirements.intelligence_links]]
+id = 7
+Filepath = "attachments/3/spec.txt"
+`))
+	db, err := Open(s)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	prj, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	want := IntelligenceLink{IntelligenceID: 7, AttachmentID: 3, RequirementID: 2}
+	if l := prj.D.IntelligenceLinks; len(l) != 1 || l[0] != want {
+		t.Fatalf("links = %#v", l)
+	}
+	if prj.D.Intelligence[0].AttachmentID != 3 {
+		t.Fatalf("attachment not resolved: %#v", prj.D.Intelligence[0])
+	}
+}
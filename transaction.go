@@ -0,0 +1,169 @@
+package PMFS
+
+import (
+	"fmt"
+)
+
+// ProjectTx is a batch of changes to a project made through Update. Its
+// mutators change a working copy of the project and return typed errors,
+// such as ErrRequirementNotFound, ErrIllegalTransition or ErrGuardFailed;
+// nothing is stored until the batch succeeds.
+type ProjectTx struct {
+	work *ProjectType
+}
+
+// Update applies fn to a copy of the project. When fn succeeds the copy is
+// checked like Save checks a project, persisted once and adopted by prj. When
+// fn, the checks or the write fail, prj and the stored project are left
+// unchanged and the error is returned.
+//
+// Like Save, Update overwrites changes others stored since prj was loaded;
+// use UpdateIfRevision when others may change the project concurrently.
+func (prj *ProjectType) Update(fn func(tx *ProjectTx) error) error {
+	return prj.update(fn, (*ProjectType).Save)
+}
+
+// UpdateIfRevision is Update saving through SaveIfRevision: the batch is
+// only stored when the stored revision still equals rev, normally
+// prj.Revision. Otherwise it fails with an error wrapping ErrConflict and
+// prj is left unchanged; reload and retry the batch.
+func (prj *ProjectType) UpdateIfRevision(rev int, fn func(tx *ProjectTx) error) error {
+	return prj.update(fn, func(work *ProjectType) error {
+		return work.SaveIfRevision(rev)
+	})
+}
+
+// update applies fn to a copy of the project, stores the copy with save and
+// adopts it.
+func (prj *ProjectType) update(fn func(tx *ProjectTx) error, save func(work *ProjectType) error) error {
+	work, err := prj.clone()
+	if err != nil {
+		return err
+	}
+	if err := fn(&ProjectTx{work: work}); err != nil {
+		return err
+	}
+	if err := save(work); err != nil {
+		return err
+	}
+	// Requirements are copied into prj's own slice so pointers obtained
+	// from RequirementByID before the update see the result.
+	reqs := append(prj.D.Requirements[:0], work.D.Requirements...)
+	prj.D = work.D
+	prj.D.Requirements = reqs
+	prj.Name = work.Name
+	prj.Revision = work.Revision
+	return nil
+}
+
+// clone returns a deep copy of the project, made through its stored encoding.
+func (prj *ProjectType) clone() (*ProjectType, error) {
+	b, err := encodeProject(prj)
+	if err != nil {
+		return nil, fmt.Errorf("copy project %d/%d: %w", prj.ProductID, prj.ID, err)
+	}
+	cp := &ProjectType{ID: prj.ID, ProductID: prj.ProductID, Archived: prj.Archived, db: prj.db}
+	if err := decodeProject(b, cp); err != nil {
+		return nil, fmt.Errorf("copy project %d/%d: %w", prj.ProductID, prj.ID, err)
+	}
+	return cp, nil
+}
+
+// Requirement returns the requirement with the given ID in the working copy.
+func (tx *ProjectTx) Requirement(id int) (*Requirement, error) {
+	return tx.work.RequirementByID(id)
+}
+
+// Requirements returns the requirements of the working copy. Changes made
+// through the returned slice are part of the batch but are not recorded in
+// the history; use UpdateRequirement for that.
+func (tx *ProjectTx) Requirements() []Requirement {
+	return tx.work.D.Requirements
+}
+
+// AddRequirement appends r with a new ID and returns the ID. With
+// FixedCategories set, categories outside the catalog fail with
+// ErrUnknownCategory.
+func (tx *ProjectTx) AddRequirement(r Requirement) (int, error) {
+	if err := tx.work.CheckCategory(r.Category); err != nil {
+		return 0, err
+	}
+	r.ID = 0
+	tx.work.D.Requirements = append(tx.work.D.Requirements, r)
+	tx.work.ensureRequirementIDs()
+	return tx.work.D.Requirements[len(tx.work.D.Requirements)-1].ID, nil
+}
+
+// UpdateRequirement applies fn to the requirement with the given ID and
+// records the changed fields in its history. The ID and status cannot be
+// changed this way; use Transition for the status. A changed category must
+// be in the catalog when FixedCategories is set; attributes and parents are
+// checked when the batch is saved.
+func (tx *ProjectTx) UpdateRequirement(id int, fn func(r *Requirement)) error {
+	r, err := tx.work.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	orig := *r
+	before := r.snapshot()
+	fn(r)
+	r.ID, r.Status, r.Condition.Proposed, r.Condition.Active, r.Condition.Deleted =
+		orig.ID, orig.Status, orig.Condition.Proposed, orig.Condition.Active, orig.Condition.Deleted
+	if r.Category != orig.Category {
+		if err := tx.work.CheckCategory(r.Category); err != nil {
+			*r = orig
+			return fmt.Errorf("requirement %d: %w", id, err)
+		}
+	}
+	r.recordSince(before, tx.work.user(), "updated")
+	return nil
+}
+
+// Transition moves the requirement to state to, like ProjectType.Transition.
+func (tx *ProjectTx) Transition(id int, to string) error {
+	r, err := tx.work.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	return tx.work.transition(r, to, "status "+to)
+}
+
+// Activate moves the requirement into the nearest active state of its
+// workflow, like ActivateRequirementByID.
+func (tx *ProjectTx) Activate(id int) error {
+	r, err := tx.work.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	return tx.work.transitionToKind(r, StateActive, "activated")
+}
+
+// Delete retires the requirement, like DeleteRequirementByID.
+func (tx *ProjectTx) Delete(id int) error {
+	r, err := tx.work.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	return tx.work.transitionToKind(r, StateRetired, "deleted")
+}
+
+// Restore moves a retired requirement along the first transition out of its
+// state, like RestoreRequirementByID. Requirements that are not retired are
+// left unchanged.
+func (tx *ProjectTx) Restore(id int) error {
+	r, err := tx.work.RequirementByID(id)
+	if err != nil {
+		return err
+	}
+	wf := tx.work.Workflow()
+	from := tx.work.stateOf(r)
+	if st, _ := wf.State(from); st.Kind != StateRetired {
+		return nil
+	}
+	for _, t := range wf.Transitions {
+		if t.From == from {
+			return tx.work.transition(r, t.To, "restored")
+		}
+	}
+	return fmt.Errorf("requirement %d: no transition out of %s: %w", id, from, ErrIllegalTransition)
+}
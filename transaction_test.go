@@ -0,0 +1,131 @@
+package PMFS
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	prj := newRelationsProject(t)
+	rev := prj.Revision
+	r1, _ := prj.RequirementByID(1)
+
+	var added int
+	err := prj.Update(func(tx *ProjectTx) error {
+		var err error
+		if added, err = tx.AddRequirement(Requirement{Name: "R5", Description: "Log belt stops."}); err != nil {
+			return err
+		}
+		if err := tx.UpdateRequirement(added, func(r *Requirement) { r.ParentID = 1; r.ID = 42 }); err != nil {
+			return err
+		}
+		if err := tx.Transition(1, "Review"); err != nil {
+			return err
+		}
+		return tx.Delete(2)
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if prj.Revision != rev+1 {
+		t.Fatalf("revision %d, want one save after %d", prj.Revision, rev)
+	}
+	if stored, _ := storedRevision(prj.store(), prj.ProductID, prj.ID); stored != prj.Revision {
+		t.Fatalf("stored revision %d, want %d", stored, prj.Revision)
+	}
+	if r1.Status != "Review" {
+		t.Fatalf("pointer taken before Update is stale: %#v", r1)
+	}
+	if r, err := prj.RequirementByID(added); err != nil || r.Level != 2 || lastChange(t, r).Comment != "updated" {
+		t.Fatalf("added requirement not updated: %#v, %v", r, err)
+	}
+	if r, _ := prj.RequirementByID(2); !r.Condition.Deleted {
+		t.Fatalf("requirement 2 not deleted: %#v", r)
+	}
+
+	// A failing mutator or invariant rolls the whole batch back.
+	rev = prj.Revision
+	for name, fn := range map[string]func(tx *ProjectTx) error{
+		"missing": func(tx *ProjectTx) error {
+			if err := tx.Restore(2); err != nil {
+				return err
+			}
+			return tx.Activate(99)
+		},
+		"cycle": func(tx *ProjectTx) error {
+			return tx.UpdateRequirement(1, func(r *Requirement) { r.ParentID = added })
+		},
+	} {
+		err := prj.Update(fn)
+		want := map[string]error{"missing": ErrRequirementNotFound, "cycle": ErrHierarchyCycle}[name]
+		if !errors.Is(err, want) {
+			t.Fatalf("%s: expected %v, got %v", name, want, err)
+		}
+	}
+	if prj.Revision != rev {
+		t.Fatalf("failed batches were saved: revision %d, want %d", prj.Revision, rev)
+	}
+	if r, _ := prj.RequirementByID(2); !r.Condition.Deleted {
+		t.Fatalf("restore not rolled back: %#v", r)
+	}
+	if r, _ := prj.RequirementByID(1); r.ParentID != 0 {
+		t.Fatalf("parent not rolled back: %#v", r)
+	}
+
+	err = prj.Update(func(tx *ProjectTx) error {
+		if err := tx.Transition(3, "Nowhere"); !errors.Is(err, ErrUnknownState) {
+			t.Errorf("expected ErrUnknownState, got %v", err)
+		}
+		if err := tx.Transition(3, "Verified"); !errors.Is(err, ErrIllegalTransition) {
+			t.Errorf("expected ErrIllegalTransition, got %v", err)
+		}
+		// Activating from Draft passes through Review; a failed guard on
+		// the way leaves the requirement in Draft.
+		r, _ := tx.Requirement(3)
+		r.Condition.GateResults = map[string]bool{"clarity-form-1": false}
+		if err := tx.Activate(3); !errors.Is(err, ErrGuardFailed) {
+			t.Errorf("expected ErrGuardFailed, got %v", err)
+		}
+		if r.Status != "Draft" {
+			t.Errorf("failed activation left status %q", r.Status)
+		}
+		r.Condition.GateResults = nil
+		return tx.Activate(3)
+	})
+	if err != nil {
+		t.Fatalf("activating from Draft: %v", err)
+	}
+	if r, _ := prj.RequirementByID(3); r.Status != "Approved" || len(r.History) != 2 {
+		t.Fatalf("unexpected activated requirement: %#v", r)
+	}
+}
+
+func TestUpdateIfRevision(t *testing.T) {
+	prj := newRelationsProject(t)
+	other := &ProjectType{ID: prj.ID, ProductID: prj.ProductID, db: prj.db}
+	if err := other.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := other.UpdateIfRevision(other.Revision, func(tx *ProjectTx) error {
+		return tx.UpdateRequirement(1, func(r *Requirement) { r.Name = "R1 renamed" })
+	}); err != nil {
+		t.Fatalf("UpdateIfRevision: %v", err)
+	}
+
+	rev := prj.Revision
+	err := prj.UpdateIfRevision(rev, func(tx *ProjectTx) error {
+		return tx.UpdateRequirement(2, func(r *Requirement) { r.Name = "R2 renamed" })
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if r, _ := prj.RequirementByID(2); r.Name != "R2" || prj.Revision != rev {
+		t.Fatalf("conflicting batch adopted: %#v, revision %d", r, prj.Revision)
+	}
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if r, _ := prj.RequirementByID(1); r.Name != "R1 renamed" {
+		t.Fatalf("other writer's change lost: %#v", r)
+	}
+}
@@ -0,0 +1,425 @@
+package PMFS
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Requirement lifecycle: Requirement.Status holds the name of a state in the
+// project's workflow. The Proposed, Active and Deleted condition flags are
+// derived from the state's kind on every save so existing readers keep
+// working; set them only on requirements that have no status yet.
+
+var (
+	// ErrUnknownState is returned when a status is not a state of the workflow.
+	ErrUnknownState = errors.New("unknown workflow state")
+	// ErrIllegalTransition is returned when the workflow has no transition
+	// between two states.
+	ErrIllegalTransition = errors.New("illegal status transition")
+	// ErrGuardFailed is returned when a guard blocks a transition.
+	ErrGuardFailed = errors.New("transition guard failed")
+	// ErrInvalidWorkflow is returned by Workflow.Validate.
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+)
+
+// StateKind maps a workflow state onto the requirement's condition flags.
+type StateKind string
+
+const (
+	StateOpen     StateKind = "open"     // none of the flags; the default
+	StateProposed StateKind = "proposed" // Condition.Proposed
+	StateActive   StateKind = "active"   // Condition.Active
+	StateRetired  StateKind = "retired"  // Condition.Deleted
+)
+
+// WorkflowState is one state of a requirement workflow.
+type WorkflowState struct {
+	Name string    `json:"name" toml:"name"`
+	Kind StateKind `json:"kind,omitempty" toml:"kind"` // StateOpen when empty
+}
+
+// Transition allows requirements to move From one state To another once all
+// named guards pass.
+type Transition struct {
+	From   string   `json:"from" toml:"from"`
+	To     string   `json:"to" toml:"to"`
+	Guards []string `json:"guards,omitempty" toml:"guards"`
+}
+
+// Workflow is the state machine requirements of a project move through.
+type Workflow struct {
+	// Initial is the state of new requirements that carry no flags.
+	Initial     string          `json:"initial" toml:"initial"`
+	States      []WorkflowState `json:"states" toml:"states"`
+	Transitions []Transition    `json:"transitions" toml:"transitions"`
+	// BlockingGates lists the gate IDs the "gates-passed" guard requires to
+	// pass. When empty, every gate evaluated on the requirement must pass.
+	BlockingGates []string `json:"blocking_gates,omitempty" toml:"blocking_gates"`
+}
+
+// DefaultWorkflow returns the workflow used by projects without their own:
+// Draft → Review → Approved → Implemented → Verified, with Retired reachable
+// from every state and AI suggestions starting as Proposed. Entering Approved
+// requires passed gates and the project's approval policy.
+func DefaultWorkflow() *Workflow {
+	t := func(from, to string, guards ...string) Transition {
+		return Transition{From: from, To: to, Guards: guards}
+	}
+	return &Workflow{
+		Initial: "Draft",
+		States: []WorkflowState{
+			{Name: "Proposed", Kind: StateProposed},
+			{Name: "Draft", Kind: StateOpen},
+			{Name: "Review", Kind: StateOpen},
+			{Name: "Approved", Kind: StateActive},
+			{Name: "Implemented", Kind: StateActive},
+			{Name: "Verified", Kind: StateActive},
+			{Name: "Retired", Kind: StateRetired},
+		},
+		Transitions: []Transition{
+			t("Proposed", "Approved", "gates-passed", "approved"),
+			t("Proposed", "Draft"),
+			t("Proposed", "Retired"),
+			t("Draft", "Review"),
+			t("Draft", "Retired"),
+			t("Review", "Approved", "gates-passed", "approved"),
+			t("Review", "Draft"),
+			t("Review", "Retired"),
+			t("Approved", "Implemented"),
+			t("Approved", "Review"),
+			t("Approved", "Retired"),
+			t("Implemented", "Verified"),
+			t("Implemented", "Retired"),
+			t("Verified", "Retired"),
+			t("Retired", "Draft"),
+		},
+	}
+}
+
+// Guard checks whether a requirement may enter a state. It returns nil to
+// allow the transition.
+type Guard func(prj *ProjectType, r *Requirement) error
+
+var guards = map[string]Guard{
+	"gates-passed":    guardGatesPassed,
+	"ai-analyzed":     guardAIAnalyzed,
+	"has-description": guardHasDescription,
+}
+
+// RegisterGuard makes a guard available to workflows under name, replacing
+// any guard registered before. Register guards during initialization.
+func RegisterGuard(name string, g Guard) {
+	guards[name] = g
+}
+
+func guardGatesPassed(prj *ProjectType, r *Requirement) error {
+	blocking := prj.Workflow().BlockingGates
+	if len(blocking) == 0 {
+		for id, pass := range r.Condition.GateResults {
+			if !pass {
+				blocking = append(blocking, id)
+			}
+		}
+	}
+	var failed []string
+	for _, id := range blocking {
+		if !r.Condition.GateResults[id] {
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("gates not passed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func guardAIAnalyzed(_ *ProjectType, r *Requirement) error {
+	if !r.Condition.AIanalyzed {
+		return errors.New("requirement not analyzed")
+	}
+	return nil
+}
+
+func guardHasDescription(_ *ProjectType, r *Requirement) error {
+	if strings.TrimSpace(r.Description) == "" {
+		return errors.New("requirement has no description")
+	}
+	return nil
+}
+
+// Validate checks that states are named uniquely with known kinds, that the
+// initial state and every transition refer to states, and that all guards
+// are registered.
+func (wf *Workflow) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, st := range wf.States {
+		switch {
+		case st.Name == "":
+			errs = append(errs, errors.New("state without a name"))
+		case seen[st.Name]:
+			errs = append(errs, fmt.Errorf("state %q defined twice", st.Name))
+		}
+		seen[st.Name] = true
+		switch st.Kind {
+		case "", StateOpen, StateProposed, StateActive, StateRetired:
+		default:
+			errs = append(errs, fmt.Errorf("state %q: unknown kind %q", st.Name, st.Kind))
+		}
+	}
+	if !seen[wf.Initial] {
+		errs = append(errs, fmt.Errorf("initial state %q not defined", wf.Initial))
+	}
+	for _, t := range wf.Transitions {
+		if !seen[t.From] || !seen[t.To] {
+			errs = append(errs, fmt.Errorf("transition %s -> %s: undefined state", t.From, t.To))
+		}
+		for _, g := range t.Guards {
+			if _, ok := guards[g]; !ok {
+				errs = append(errs, fmt.Errorf("transition %s -> %s: unknown guard %q", t.From, t.To, g))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWorkflow, err)
+	}
+	return nil
+}
+
+// State returns the state with the given name.
+func (wf *Workflow) State(name string) (WorkflowState, bool) {
+	for _, st := range wf.States {
+		if st.Name == name {
+			if st.Kind == "" {
+				st.Kind = StateOpen
+			}
+			return st, true
+		}
+	}
+	return WorkflowState{}, false
+}
+
+// transition returns the transition from one state to another.
+func (wf *Workflow) transition(from, to string) (Transition, bool) {
+	for _, t := range wf.Transitions {
+		if t.From == from && t.To == to {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// stateFor returns the state matching legacy condition flags: the first
+// state of the flagged kind, or Initial without flags.
+func (wf *Workflow) stateFor(c ConditionType) string {
+	kind := StateOpen
+	switch {
+	case c.Deleted:
+		kind = StateRetired
+	case c.Active:
+		kind = StateActive
+	case c.Proposed:
+		kind = StateProposed
+	default:
+		return wf.Initial
+	}
+	for _, st := range wf.States {
+		if st.Kind == kind {
+			return st.Name
+		}
+	}
+	return wf.Initial
+}
+
+// resolve maps a free-text status and legacy condition flags onto a state.
+// A status naming a state, ignoring case, is kept unless the deleted or
+// active flag calls for another kind of state; then, and for statuses naming
+// no state, the state follows the flags. The second result reports whether
+// the status was kept.
+func (wf *Workflow) resolve(status string, c ConditionType) (string, bool) {
+	for _, st := range wf.States {
+		if !strings.EqualFold(st.Name, strings.TrimSpace(status)) {
+			continue
+		}
+		if (c.Deleted && st.Kind != StateRetired) || (c.Active && !c.Deleted && st.Kind != StateActive) {
+			break
+		}
+		return st.Name, true
+	}
+	return wf.stateFor(c), false
+}
+
+// applyState sets the requirement's status and condition flags to st.
+func applyState(r *Requirement, st WorkflowState) {
+	r.Status = st.Name
+	r.Condition.Proposed = st.Kind == StateProposed
+	r.Condition.Active = st.Kind == StateActive
+	r.Condition.Deleted = st.Kind == StateRetired
+}
+
+// Workflow returns the project's workflow, or DefaultWorkflow when the
+// project has none.
+func (prj *ProjectType) Workflow() *Workflow {
+	if prj.D.Workflow != nil {
+		return prj.D.Workflow
+	}
+	return DefaultWorkflow()
+}
+
+// SetWorkflow replaces the project's workflow and persists the project.
+// Every requirement's status must be a state of the new workflow.
+func (prj *ProjectType) SetWorkflow(wf *Workflow) error {
+	if err := wf.Validate(); err != nil {
+		return err
+	}
+	for _, r := range prj.D.Requirements {
+		if _, ok := wf.State(r.Status); r.Status != "" && !ok {
+			return fmt.Errorf("requirement %d: %q: %w", r.ID, r.Status, ErrUnknownState)
+		}
+	}
+	prj.D.Workflow = wf
+	return prj.Save()
+}
+
+// ensureWorkflow gives requirements without a status the state matching
+// their flags and derives the flags of every requirement from its state.
+func (prj *ProjectType) ensureWorkflow() error {
+	wf := prj.Workflow()
+	if prj.D.Workflow != nil {
+		if err := wf.Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range prj.D.Requirements {
+		r := &prj.D.Requirements[i]
+		if r.Status == "" {
+			r.Status = wf.stateFor(r.Condition)
+		}
+		st, ok := wf.State(r.Status)
+		if !ok {
+			return fmt.Errorf("requirement %d: %q: %w", r.ID, r.Status, ErrUnknownState)
+		}
+		applyState(r, st)
+	}
+	return nil
+}
+
+// stateOf returns the requirement's current state name.
+func (prj *ProjectType) stateOf(r *Requirement) string {
+	if r.Status == "" {
+		return prj.Workflow().stateFor(r.Condition)
+	}
+	return r.Status
+}
+
+// AllowedTransitions returns the states the requirement may move to next, in
+// workflow order, without evaluating guards.
+func (prj *ProjectType) AllowedTransitions(id int) ([]string, error) {
+	r, err := prj.RequirementByID(id)
+	if err != nil {
+		return nil, err
+	}
+	from := prj.stateOf(r)
+	out := []string{}
+	for _, t := range prj.Workflow().Transitions {
+		if t.From == from {
+			out = append(out, t.To)
+		}
+	}
+	return out, nil
+}
+
+// Transition moves the requirement to state to and persists the project.
+// It fails with ErrIllegalTransition when the workflow has no such
+// transition and with ErrGuardFailed when a guard blocks it.
+func (prj *ProjectType) Transition(id int, to string) error {
+	return prj.Update(func(tx *ProjectTx) error { return tx.Transition(id, to) })
+}
+
+// transition checks and applies a transition and records it in the
+// requirement's history.
+func (prj *ProjectType) transition(r *Requirement, to, comment string) error {
+	wf := prj.Workflow()
+	from := prj.stateOf(r)
+	st, ok := wf.State(to)
+	if !ok {
+		return fmt.Errorf("requirement %d: %q: %w", r.ID, to, ErrUnknownState)
+	}
+	t, ok := wf.transition(from, to)
+	if !ok {
+		return fmt.Errorf("requirement %d: %s -> %s: %w", r.ID, from, to, ErrIllegalTransition)
+	}
+	for _, name := range t.Guards {
+		g, ok := guards[name]
+		if !ok {
+			return fmt.Errorf("requirement %d: %s -> %s: guard %q: %w", r.ID, from, to, name, ErrInvalidWorkflow)
+		}
+		if err := g(prj, r); err != nil {
+			return fmt.Errorf("requirement %d: %s -> %s: %s: %w: %w", r.ID, from, to, name, ErrGuardFailed, err)
+		}
+	}
+	before := r.snapshot()
+	applyState(r, st)
+	r.recordSince(before, prj.user(), comment)
+	return nil
+}
+
+// transitionToKind moves the requirement along the shortest path of
+// transitions from its current state into a state of the given kind, e.g.
+// Draft -> Review -> Approved, checking the guards of every step. Paths only
+// pass through retired states when retiring. It does nothing when the
+// requirement is already in such a state and leaves it unchanged when a step
+// fails.
+func (prj *ProjectType) transitionToKind(r *Requirement, kind StateKind, comment string) error {
+	wf := prj.Workflow()
+	from := prj.stateOf(r)
+	if st, ok := wf.State(from); ok && st.Kind == kind {
+		return nil
+	}
+	path := wf.pathToKind(from, kind)
+	if path == nil {
+		return fmt.Errorf("requirement %d: %s -> %s state: %w", r.ID, from, kind, ErrIllegalTransition)
+	}
+	orig := *r
+	for _, to := range path {
+		if err := prj.transition(r, to, comment); err != nil {
+			*r = orig
+			return err
+		}
+	}
+	return nil
+}
+
+// pathToKind returns the states of the shortest transition path from state
+// from to a state of the given kind, or nil when there is none.
+func (wf *Workflow) pathToKind(from string, kind StateKind) []string {
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, t := range wf.Transitions {
+			if t.From != cur {
+				continue
+			}
+			if _, seen := prev[t.To]; seen {
+				continue
+			}
+			st, ok := wf.State(t.To)
+			if !ok || (st.Kind == StateRetired && kind != StateRetired) {
+				continue
+			}
+			prev[t.To] = cur
+			if st.Kind == kind {
+				var path []string
+				for s := t.To; s != from; s = prev[s] {
+					path = append([]string{s}, path...)
+				}
+				return path
+			}
+			queue = append(queue, t.To)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package PMFS
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWorkflowTransitions(t *testing.T) {
+	prj := newRelationsProject(t)
+	r := &prj.D.Requirements[0]
+	if r.Status != "Draft" || r.Condition.Proposed || r.Condition.Active {
+		t.Fatalf("new requirement not in Draft: %#v", r)
+	}
+	if err := prj.Transition(1, "Approved"); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected ErrIllegalTransition, got %v", err)
+	}
+	if err := prj.Transition(1, "Done"); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("expected ErrUnknownState, got %v", err)
+	}
+	if err := prj.Transition(1, "Review"); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+
+	r.Condition.GateResults = map[string]bool{"completeness-1": false}
+	if err := prj.Transition(1, "Approved"); !errors.Is(err, ErrGuardFailed) {
+		t.Fatalf("expected ErrGuardFailed, got %v", err)
+	}
+	r.Condition.GateResults["completeness-1"] = true
+	if err := prj.Transition(1, "Approved"); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	if !r.Condition.Active || r.Condition.Proposed || r.Condition.Deleted {
+		t.Fatalf("flags not derived from Approved: %#v", r.Condition)
+	}
+	next, err := prj.AllowedTransitions(1)
+	if err != nil || len(next) != 3 || next[0] != "Implemented" {
+		t.Fatalf("AllowedTransitions = %v, %v", next, err)
+	}
+
+	// Direct flag edits do not survive a save once the status is set.
+	r.Condition.Deleted = true
+	if err := prj.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if r.Condition.Deleted {
+		t.Fatalf("flag not reset from status: %#v", r.Condition)
+	}
+	r.Status = "Done"
+	if err := prj.Save(); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("expected Save to reject unknown status, got %v", err)
+	}
+}
+
+func TestCustomWorkflow(t *testing.T) {
+	prj := newRelationsProject(t)
+	wf := &Workflow{
+		Initial: "Open",
+		States: []WorkflowState{
+			{Name: "Open"},
+			{Name: "Accepted", Kind: StateActive},
+			{Name: "Rejected", Kind: StateRetired},
+		},
+		Transitions: []Transition{
+			{From: "Open", To: "Accepted", Guards: []string{"gates-passed", "has-description"}},
+			{From: "Open", To: "Rejected"},
+		},
+		BlockingGates: []string{"testability-1"},
+	}
+	if err := prj.SetWorkflow(wf); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("expected statuses outside the workflow to be rejected, got %v", err)
+	}
+	for i := range prj.D.Requirements {
+		prj.D.Requirements[i].Status = "Open"
+	}
+	if err := prj.SetWorkflow(&Workflow{Initial: "Open", States: wf.States, Transitions: []Transition{{From: "Open", To: "Gone"}}}); !errors.Is(err, ErrInvalidWorkflow) {
+		t.Fatalf("expected ErrInvalidWorkflow, got %v", err)
+	}
+	if err := prj.SetWorkflow(wf); err != nil {
+		t.Fatalf("SetWorkflow: %v", err)
+	}
+
+	r := &prj.D.Requirements[0]
+	r.Description = "The belt stops within 1 s."
+	if err := prj.ActivateRequirementByID(1); !errors.Is(err, ErrGuardFailed) {
+		t.Fatalf("expected missing blocking gate to fail, got %v", err)
+	}
+	r.Condition.GateResults = map[string]bool{"testability-1": true, "completeness-1": false}
+	if err := prj.ActivateRequirementByID(1); err != nil {
+		t.Fatalf("ActivateRequirementByID: %v", err)
+	}
+	if err := prj.DeleteRequirementByID(2); err != nil {
+		t.Fatalf("DeleteRequirementByID: %v", err)
+	}
+	if err := prj.RestoreRequirementByID(2); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected Rejected to be final, got %v", err)
+	}
+
+	if err := prj.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if prj.D.Workflow == nil || prj.D.Requirements[0].Status != "Accepted" || !prj.D.Requirements[1].Condition.Deleted {
+		t.Fatalf("workflow state not persisted: %#v", prj.D)
+	}
+}
+
+func TestMigrateConditionFlagsToStatus(t *testing.T) {
+	s := NewMemoryStore()
+	s.put(indexKey(), []byte(legacyIndex))
+	s.put(projectFileKey(1, 1), []byte(`schema_version = 4
+id = 1
+productid = 1
+
+[projectdata]
+[[projectdata.requirements]]
+id = 1
+status = "review"
+[projectdata.requirements.condition]
+proposed = true
+
+[[projectdata.requirements]]
+id = 2
+status = "Confirmed"
+[projectdata.requirements.condition]
+proposed = true
+active = true
+deleted = true
+
+[[projectdata.requirements]]
+id = 3
+[projectdata.requirements.condition]
+active = true
+
+[[projectdata.requirements]]
+id = 4
+status = "Draft"
+[projectdata.requirements.condition]
+deleted = true
+
+[[projectdata.requirements]]
+id = 5
+status = "Proposed"
+[projectdata.requirements.condition]
+active = true
+`))
+	db, err := Open(s)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	prj, err := db.Products[0].Project(1)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	r := prj.D.Requirements
+	if r[0].Status != "Review" || r[0].Condition.Proposed {
+		t.Fatalf("named status not kept: %#v", r[0])
+	}
+	if c := r[1].Condition; r[1].Status != "Retired" || c.Proposed || c.Active || !c.Deleted {
+		t.Fatalf("conflicting flags not resolved: %#v", r[1])
+	}
+	if r[2].Status != "Approved" || !r[2].Condition.Active {
+		t.Fatalf("active flag not migrated: %#v", r[2])
+	}
+	// The flags win over a status naming another kind of state, which is
+	// kept in the history.
+	if r[3].Status != "Retired" || !r[3].Condition.Deleted {
+		t.Fatalf("deleted requirement revived: %#v", r[3])
+	}
+	if r[4].Status != "Approved" || !r[4].Condition.Active {
+		t.Fatalf("active requirement demoted: %#v", r[4])
+	}
+	if h := r[3].History; len(h) != 1 || len(h[0].Fields) != 1 || h[0].Fields[0].Before != "Draft" {
+		t.Fatalf("replaced status not recorded: %#v", h)
+	}
+}